@@ -3,8 +3,14 @@ package msmtpd
 import (
 	"fmt"
 	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
 )
 
+// Good read - https://www.rfc-editor.org/rfc/rfc6531
+
 func parseAddress(src string) (addr *mail.Address, err error) {
 	// While a RFC5321 mailbox specification is not the same as an RFC5322
 	// email address specification, it is better to accept that format and
@@ -15,7 +21,68 @@ func parseAddress(src string) (addr *mail.Address, err error) {
 	// though not RFC compliant.
 	addr, err = mail.ParseAddress(src)
 	if err != nil {
-		err = fmt.Errorf("malformed e-mail address: %s", src)
+		return nil, fmt.Errorf("malformed e-mail address: %s", src)
+	}
+	// ensure internationalized domain names are valid IDNA
+	_, domain := SplitAddress(addr.Address)
+	if !isASCII(domain) || strings.Contains(strings.ToLower(domain), "xn--") {
+		_, err = NormalizeDomain(domain)
+		if err != nil {
+			return nil, fmt.Errorf("malformed e-mail address domain: %s", src)
+		}
+	}
+	return addr, nil
+}
+
+// isASCII returns true, if string has only ASCII symbols, so it can be used without SMTPUTF8 extension
+func isASCII(input string) bool {
+	for i := 0; i < len(input); i++ {
+		if input[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// SplitAddress splits email address like `somebody@example.org` into local part `somebody` and domain `example.org`
+func SplitAddress(address string) (localPart, domain string) {
+	at := strings.LastIndex(address, "@")
+	if at == -1 {
+		return address, ""
+	}
+	return address[:at], address[at+1:]
+}
+
+// NormalizeDomain returns domain in lower case IDNA A-label form, for example,
+// both `Почта.рф` and `xn--80a1acny.xn--p1ai` are normalized into `xn--80a1acny.xn--p1ai`,
+// so plugins can compare domains consistently and resolve them via DNS.
+// Address literals like `[127.0.0.1]` are returned as is.
+func NormalizeDomain(domain string) (string, error) {
+	if strings.HasPrefix(domain, "[") {
+		return domain, nil
+	}
+	return idna.Lookup.ToASCII(strings.ToLower(domain))
+}
+
+// DomainToUnicode returns domain in lower case IDNA U-label form, for example,
+// both `Почта.рф` and `xn--80a1acny.xn--p1ai` are converted into `почта.рф`
+func DomainToUnicode(domain string) (string, error) {
+	if strings.HasPrefix(domain, "[") {
+		return domain, nil
+	}
+	return idna.Lookup.ToUnicode(strings.ToLower(domain))
+}
+
+// NormalizeAddress returns email address with domain part normalized by NormalizeDomain,
+// local part is preserved as is, since it can be case-sensitive
+func NormalizeAddress(address string) (string, error) {
+	localPart, domain := SplitAddress(address)
+	if domain == "" {
+		return address, nil
+	}
+	normalized, err := NormalizeDomain(domain)
+	if err != nil {
+		return "", err
 	}
-	return
+	return localPart + "@" + normalized, nil
 }
@@ -0,0 +1,91 @@
+package msmtpd
+
+import "testing"
+
+func TestSplitAddress(t *testing.T) {
+	cases := map[string][2]string{
+		"somebody@example.org":   {"somebody", "example.org"},
+		"иван@почта.рф":          {"иван", "почта.рф"},
+		"\"a@b\"@example.org":    {"\"a@b\"", "example.org"},
+		"postmaster":             {"postmaster", ""},
+		"somebody@[127.0.0.1]":   {"somebody", "[127.0.0.1]"},
+		"somebody@Example.ORG":   {"somebody", "Example.ORG"},
+		"a.b.c@xn--p1ai":         {"a.b.c", "xn--p1ai"},
+		"somebody@sub.domain.ru": {"somebody", "sub.domain.ru"},
+	}
+	for k, v := range cases {
+		localPart, domain := SplitAddress(k)
+		if localPart != v[0] || domain != v[1] {
+			t.Errorf("address %s is split into %s and %s instead of %s and %s",
+				k, localPart, domain, v[0], v[1])
+		}
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	cases := map[string]string{
+		"example.org":            "example.org",
+		"Example.ORG":            "example.org",
+		"почта.рф":               "xn--80a1acny.xn--p1ai",
+		"Почта.РФ":               "xn--80a1acny.xn--p1ai",
+		"xn--80a1acny.xn--p1ai":  "xn--80a1acny.xn--p1ai",
+		"XN--80A1ACNY.XN--P1AI":  "xn--80a1acny.xn--p1ai",
+		"[127.0.0.1]":            "[127.0.0.1]",
+		"localhost":              "localhost",
+		"mail.vodolaz095.ru":     "mail.vodolaz095.ru",
+		"bücher.example":         "xn--bcher-kva.example",
+		"xn--bcher-kva.example":  "xn--bcher-kva.example",
+		"sub.xn--bcher-kva.test": "sub.xn--bcher-kva.test",
+	}
+	for k, v := range cases {
+		normalized, err := NormalizeDomain(k)
+		if err != nil {
+			t.Errorf("%s : while normalizing %s", err, k)
+			continue
+		}
+		if normalized != v {
+			t.Errorf("domain %s is normalized into %s instead of %s", k, normalized, v)
+		}
+	}
+	_, err := NormalizeDomain("xn--что-то.рф")
+	if err == nil {
+		t.Errorf("malformed domain is normalized")
+	}
+}
+
+func TestDomainToUnicode(t *testing.T) {
+	cases := map[string]string{
+		"example.org":           "example.org",
+		"почта.рф":              "почта.рф",
+		"Почта.РФ":              "почта.рф",
+		"xn--80a1acny.xn--p1ai": "почта.рф",
+	}
+	for k, v := range cases {
+		converted, err := DomainToUnicode(k)
+		if err != nil {
+			t.Errorf("%s : while converting %s", err, k)
+			continue
+		}
+		if converted != v {
+			t.Errorf("domain %s is converted into %s instead of %s", k, converted, v)
+		}
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	cases := map[string]string{
+		"Somebody@Example.ORG": "Somebody@example.org",
+		"иван@Почта.рф":        "иван@xn--80a1acny.xn--p1ai",
+		"postmaster":           "postmaster",
+	}
+	for k, v := range cases {
+		normalized, err := NormalizeAddress(k)
+		if err != nil {
+			t.Errorf("%s : while normalizing %s", err, k)
+			continue
+		}
+		if normalized != v {
+			t.Errorf("address %s is normalized into %s instead of %s", k, normalized, v)
+		}
+	}
+}
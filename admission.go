@@ -0,0 +1,108 @@
+package msmtpd
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Single botnet IP address can occupy every connection slot of Server.MaxConnections, so
+// concurrent connections are also limited per client IP address and per /24 IPv4 or /64 IPv6 subnet.
+// When all slots are busy, connection can wait for free one for Server.ConnectionQueueTimeout.
+// Goroutines blocked on sending to channel are woken in order they started waiting,
+// so connections waiting in queue are admitted fairly.
+
+// ErrTooManyConnectionsFromAddress means client IP address or its subnet has too many concurrent connections
+var ErrTooManyConnectionsFromAddress = ErrorSMTP{
+	Code:         421,
+	EnhancedCode: "4.7.0",
+	Message:      "Too many concurrent connections from your network. Try again later, please.",
+}
+
+// SubnetOf returns /24 subnet of IPv4 address or /64 subnet of IPv6 one, like 192.0.2.0/24,
+// which is used to limit neighbouring addresses, usually controlled by the same party, together
+func SubnetOf(ip net.IP) string {
+	if ipv4 := ip.To4(); ipv4 != nil {
+		mask := net.CIDRMask(24, 32)
+		return (&net.IPNet{IP: ipv4.Mask(mask), Mask: mask}).String()
+	}
+	mask := net.CIDRMask(64, 128)
+	return (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+}
+
+// admitAddress accounts connection from client address and returns keys to be released
+// by releaseAddress, when connection is closed. ErrTooManyConnectionsFromAddress is returned,
+// if client address or its subnet has too many concurrent connections
+func (srv *Server) admitAddress(t *Transaction) (keys []string, err error) {
+	maxPerIP := t.listener.MaxConnectionsPerIP
+	maxPerSubnet := t.listener.MaxConnectionsPerSubnet
+	if maxPerIP <= 0 && maxPerSubnet <= 0 {
+		return nil, nil
+	}
+	// local clients connected via unix domain socket are not limited
+	ip := t.RemoteIP()
+	if ip == nil {
+		return nil, nil
+	}
+	// connections are counted for every listener separately
+	ipKey := t.listener.Name + "|ip|" + ip.String()
+	subnetKey := t.listener.Name + "|subnet|" + SubnetOf(ip)
+	srv.addressesMu.Lock()
+	defer srv.addressesMu.Unlock()
+	if srv.addresses == nil {
+		srv.addresses = make(map[string]int)
+	}
+	if maxPerIP > 0 && srv.addresses[ipKey] >= maxPerIP {
+		atomic.AddUint64(&srv.connectionsRejectedByIP, 1)
+		t.LogWarn("Too many concurrent connections (%v) from %s", srv.addresses[ipKey], ip)
+		return nil, ErrTooManyConnectionsFromAddress
+	}
+	if maxPerSubnet > 0 && srv.addresses[subnetKey] >= maxPerSubnet {
+		atomic.AddUint64(&srv.connectionsRejectedBySubnet, 1)
+		t.LogWarn("Too many concurrent connections (%v) from subnet %s", srv.addresses[subnetKey], SubnetOf(ip))
+		return nil, ErrTooManyConnectionsFromAddress
+	}
+	srv.addresses[ipKey]++
+	srv.addresses[subnetKey]++
+	return []string{ipKey, subnetKey}, nil
+}
+
+// releaseAddress forgets connection accounted by admitAddress
+func (srv *Server) releaseAddress(keys []string) {
+	srv.addressesMu.Lock()
+	defer srv.addressesMu.Unlock()
+	for _, key := range keys {
+		srv.addresses[key]--
+		if srv.addresses[key] <= 0 {
+			delete(srv.addresses, key)
+		}
+	}
+}
+
+// waitForSlot takes slot from limiter, waiting for ListenerConfig.ConnectionQueueTimeout, if all slots are busy.
+// It returns false, if slot is not taken
+func (srv *Server) waitForSlot(t *Transaction, limiter chan struct{}) bool {
+	select {
+	case limiter <- struct{}{}:
+		return true
+	default:
+	}
+	if t.listener.ConnectionQueueTimeout <= 0 {
+		atomic.AddUint64(&srv.connectionsRejectedByLimit, 1)
+		return false
+	}
+	t.LogDebug("All %v connection slots are busy, waiting for free one...", cap(limiter))
+	atomic.AddInt32(&srv.connectionsQueued, 1)
+	defer atomic.AddInt32(&srv.connectionsQueued, -1)
+	timer := time.NewTimer(t.listener.ConnectionQueueTimeout)
+	defer timer.Stop()
+	select {
+	case limiter <- struct{}{}:
+		return true
+	case <-timer.C:
+		atomic.AddUint64(&srv.connectionsRejectedByLimit, 1)
+		return false
+	case <-srv.getDoneChan():
+		return false
+	}
+}
@@ -0,0 +1,179 @@
+package msmtpd
+
+import (
+	"net"
+	"net/smtp"
+	"testing"
+	"time"
+)
+
+func TestSubnetOf(t *testing.T) {
+	testCases := map[string]string{
+		"192.168.1.3":       "192.168.1.0/24",
+		"::ffff:10.0.0.200": "10.0.0.0/24",
+		"2001:db8:1:2:3::4": "2001:db8:1:2::/64",
+	}
+	for ip, expected := range testCases {
+		if subnet := SubnetOf(net.ParseIP(ip)); subnet != expected {
+			t.Errorf("wrong subnet %s instead of %s for %s", subnet, expected, ip)
+		}
+	}
+}
+
+// concurrentAddresses returns number of addresses and subnets having connections accounted
+func (srv *Server) concurrentAddresses() int {
+	srv.addressesMu.Lock()
+	defer srv.addressesMu.Unlock()
+	return len(srv.addresses)
+}
+
+// waitForTransactionsClosed waits until server closes all transactions, so they do not log after test is completed
+func waitForTransactionsClosed(srv *Server) {
+	for i := 0; i < 50 && (srv.GetActiveTransactionsCount() > 0 || srv.concurrentAddresses() > 0); i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestMaxConnectionsPerAddress(t *testing.T) {
+	testCases := []struct {
+		name   string
+		server *Server
+	}{
+		{"ip", &Server{MaxConnectionsPerIP: 1}},
+		{"subnet", &Server{MaxConnectionsPerSubnet: 1}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, closer := RunTestServerWithoutTLS(t, tc.server)
+			defer closer()
+			c, err := smtp.Dial(addr)
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			_, err = smtp.Dial(addr)
+			if err == nil {
+				t.Errorf("second concurrent connection is accepted")
+			} else if err.Error() != ErrTooManyConnectionsFromAddress.Error() {
+				t.Errorf("wrong error for second concurrent connection: %s", err)
+			}
+			if err = c.Quit(); err != nil {
+				t.Errorf("Quit failed: %v", err)
+			}
+			// slot of address is released after connection is closed
+			waitForTransactionsClosed(tc.server)
+			c, err = smtp.Dial(addr)
+			if err != nil {
+				t.Fatalf("Dial failed after first connection is closed: %v", err)
+			}
+			if err = c.Quit(); err != nil {
+				t.Errorf("Quit failed: %v", err)
+			}
+			waitForTransactionsClosed(tc.server)
+			_, byIP, bySubnet := tc.server.GetRejectedConnectionsCount()
+			if byIP+bySubnet != 1 {
+				t.Errorf("wrong number of connections rejected by address %v and subnet %v", byIP, bySubnet)
+			}
+		})
+	}
+}
+
+func TestMaxConnectionsPerAddressForListener(t *testing.T) {
+	server := &Server{
+		Logger:              &TestLogger{Suite: t},
+		MaxConnectionsPerIP: 1,
+	}
+	mx := serveTestListener(t, server, ListenerConfig{Name: "mx"})
+	submission := serveTestListener(t, server, ListenerConfig{Name: "submission", MaxConnectionsPerIP: 2})
+	c1, err := smtp.Dial(mx)
+	if err != nil {
+		t.Fatalf("Dial to mx failed: %v", err)
+	}
+	// busy mx listener does not starve submission one for the same client
+	c2, err := smtp.Dial(submission)
+	if err != nil {
+		t.Fatalf("Dial to submission failed: %v", err)
+	}
+	c3, err := smtp.Dial(submission)
+	if err != nil {
+		t.Fatalf("second Dial to submission failed: %v", err)
+	}
+	_, err = smtp.Dial(submission)
+	if err == nil {
+		t.Errorf("third concurrent connection to submission is accepted")
+	} else if err.Error() != ErrTooManyConnectionsFromAddress.Error() {
+		t.Errorf("wrong error for third concurrent connection: %s", err)
+	}
+	_, err = smtp.Dial(mx)
+	if err == nil {
+		t.Errorf("second concurrent connection to mx is accepted")
+	}
+	for _, c := range []*smtp.Client{c1, c2, c3} {
+		if err = c.Quit(); err != nil {
+			t.Errorf("Quit failed: %v", err)
+		}
+	}
+	waitForTransactionsClosed(server)
+}
+
+func TestConnectionQueue(t *testing.T) {
+	server := &Server{
+		MaxConnections:         1,
+		ConnectionQueueTimeout: 5 * time.Second,
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	queued := make(chan error, 1)
+	go func() {
+		c2, err2 := smtp.Dial(addr)
+		if err2 != nil {
+			queued <- err2
+			return
+		}
+		queued <- c2.Quit()
+	}()
+	time.Sleep(300 * time.Millisecond)
+	if server.GetQueuedConnectionsCount() != 1 {
+		t.Errorf("wrong number of queued connections %v", server.GetQueuedConnectionsCount())
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	select {
+	case err = <-queued:
+		if err != nil {
+			t.Errorf("queued connection failed: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Errorf("queued connection is not admitted")
+	}
+	waitForTransactionsClosed(server)
+}
+
+func TestConnectionQueueTimeout(t *testing.T) {
+	server := &Server{
+		MaxConnections:         1,
+		ConnectionQueueTimeout: 100 * time.Millisecond,
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	_, err = smtp.Dial(addr)
+	if err == nil {
+		t.Errorf("connection is accepted after waiting in queue for too long")
+	}
+	byLimit, _, _ := server.GetRejectedConnectionsCount()
+	if byLimit != 1 {
+		t.Errorf("wrong number of connections rejected by limit %v", byLimit)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+}
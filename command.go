@@ -1,6 +1,11 @@
 package msmtpd
 
 import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -17,3 +22,104 @@ func (cmd *command) attachToSpan(span trace.Span) {
 		attribute.String("cmd.line", cmd.line), attribute.String("cmd.action", cmd.action),
 	)
 }
+
+// Command is command client sent, it is passed to CommandHandler
+type Command struct {
+	// Line is command line as client sent it
+	Line string
+	// Action is upper cased command verb, like ETRN
+	Action string
+	// Arguments are space separated arguments following command verb
+	Arguments []string
+}
+
+// CommandHandler processes custom command client sent. Replies are sent via Transaction.Reply
+// and Transaction.ReplyLines, tracing span started for command can be extracted from ctx
+// by trace.SpanFromContext
+type CommandHandler func(ctx context.Context, transaction *Transaction, cmd Command)
+
+// customCommand is command registered via Server.RegisterCommand
+type customCommand struct {
+	handler   CommandHandler
+	extension string
+}
+
+// replaceableCommands are built-in commands, which handlers can be replaced by Server.RegisterCommand
+var replaceableCommands = map[string]bool{
+	"VRFY": true,
+	"EXPN": true,
+	"HELP": true,
+}
+
+// builtInCommands are commands we handle ourselves
+var builtInCommands = map[string]bool{
+	"PROXY":    true,
+	"HELO":     true,
+	"EHLO":     true,
+	"LHLO":     true,
+	"MAIL":     true,
+	"RCPT":     true,
+	"STARTTLS": true,
+	"DATA":     true,
+	"BDAT":     true,
+	"RSET":     true,
+	"NOOP":     true,
+	"QUIT":     true,
+	"AUTH":     true,
+	"XCLIENT":  true,
+	"VRFY":     true,
+	"EXPN":     true,
+	"HELP":     true,
+}
+
+// RegisterCommand adds handler for custom command, like ETRN or vendor specific one. If extension is not empty,
+// it is advertised as EHLO keyword, like `ETRN` or `XFOO BAR`. Handlers of built-in commands cannot be replaced,
+// except for VRFY, EXPN and HELP ones. It should be called before server is started.
+func (srv *Server) RegisterCommand(verb string, handler CommandHandler, extension string) error {
+	verb = strings.ToUpper(verb)
+	if !isValidParameterKeyword(verb) {
+		return fmt.Errorf("malformed command verb: %s", verb)
+	}
+	if builtInCommands[verb] && !replaceableCommands[verb] {
+		return fmt.Errorf("built-in command %s cannot be replaced", verb)
+	}
+	if handler == nil {
+		return fmt.Errorf("handler for command %s is not provided", verb)
+	}
+	if srv.commands == nil {
+		srv.commands = make(map[string]customCommand, 0)
+	}
+	srv.commands[verb] = customCommand{handler: handler, extension: extension}
+	return nil
+}
+
+// customExtensions returns EHLO keywords of custom commands sorted by command verb
+func (srv *Server) customExtensions() []string {
+	verbs := make([]string, 0, len(srv.commands))
+	for verb := range srv.commands {
+		if srv.commands[verb].extension != "" {
+			verbs = append(verbs, verb)
+		}
+	}
+	sort.Strings(verbs)
+	extensions := make([]string, 0, len(verbs))
+	for _, verb := range verbs {
+		extensions = append(extensions, srv.commands[verb].extension)
+	}
+	return extensions
+}
+
+// handleCustomCommand calls handler of command registered via Server.RegisterCommand
+func (t *Transaction) handleCustomCommand(custom customCommand, cmd command) {
+	ctx, span := t.server.Tracer.Start(t.Context(), "handle_"+strings.ToLower(cmd.action),
+		trace.WithSpanKind(trace.SpanKindInternal), // важно
+	)
+	cmd.attachToSpan(span)
+	defer span.End()
+	t.LogDebug("Custom command %s is received...", cmd.action)
+	custom.handler(ctx, t, Command{
+		Line:      cmd.line,
+		Action:    cmd.action,
+		Arguments: cmd.fields[1:],
+	})
+}
@@ -0,0 +1,70 @@
+package msmtpd
+
+import (
+	"context"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func TestRegisterCommand(t *testing.T) {
+	server := &Server{}
+	err := server.RegisterCommand("MAIL", func(_ context.Context, tr *Transaction, cmd Command) {}, "")
+	if err == nil {
+		t.Errorf("built-in command MAIL is replaced")
+	}
+	err = server.RegisterCommand("X FOO", func(_ context.Context, tr *Transaction, cmd Command) {}, "")
+	if err == nil {
+		t.Errorf("malformed command is registered")
+	}
+	err = server.RegisterCommand("ETRN", nil, "ETRN")
+	if err == nil {
+		t.Errorf("command without handler is registered")
+	}
+	err = server.RegisterCommand("etrn", func(ctx context.Context, tr *Transaction, cmd Command) {
+		if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			t.Errorf("span is not provided")
+		}
+		if cmd.Action != "ETRN" || strings.Join(cmd.Arguments, " ") != "@example.org" {
+			t.Errorf("wrong command %v", cmd)
+		}
+		tr.Reply(250, "2.0.0", "Queuing for node example.org started")
+	}, "ETRN")
+	if err != nil {
+		t.Errorf("%s : while registering ETRN", err)
+	}
+	err = server.RegisterCommand("VRFY", func(_ context.Context, tr *Transaction, cmd Command) {
+		tr.ReplyLines(553, "5.1.4", "User ambiguous, possibilities are", "<somebody@example.org>")
+	}, "")
+	if err != nil {
+		t.Errorf("%s : while replacing VRFY", err)
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("EHLO failed: %v", err)
+	}
+	if supported, _ := c.Extension("ETRN"); !supported {
+		t.Errorf("ETRN is not advertised")
+	}
+	if err = internal.DoCommand(c.Text, 250, "ETRN @example.org"); err != nil {
+		t.Errorf("ETRN failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 553, "VRFY somebody"); err != nil {
+		t.Errorf("VRFY failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 502, "XFOO"); err != nil {
+		t.Errorf("unknown command didn't fail: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
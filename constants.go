@@ -1,11 +1,35 @@
 package msmtpd
 
-import "crypto/tls"
+import (
+	"crypto/tls"
+	"time"
+)
 
 const timeFormatForHeaders = "Mon, 02 Jan 2006 15:04:05 -0700 (MST)"
 
 const lineLength = 76
 
+// maxLineLength limits command line client can send, it is the same, as bufio.Scanner had by default
+const maxLineLength = 64 * 1024
+
+// forceCloseGracePeriod limits time Server.ShutdownContext waits for force-closed sessions to call CloseHandlers,
+// so session stuck in plugin, which ignores its context, does not block shutdown forever
+const forceCloseGracePeriod = time.Second
+
+// synchronizationPoints are commands which can only be the last ones in pipelined group,
+// so we send replies for whole group after them. See RFC 2920, section 3.1
+var synchronizationPoints = map[string]bool{
+	"EHLO":     true,
+	"LHLO":     true,
+	"HELO":     true,
+	"DATA":     true,
+	"BDAT":     true,
+	"STARTTLS": true,
+	"AUTH":     true,
+	"NOOP":     true,
+	"QUIT":     true,
+}
+
 // Karma related
 const tlsHandshakeFailedHate = 1
 const wrongCommandOrderPenalty = 1
@@ -15,6 +39,8 @@ const tooManyRecipientsPenalty = 5
 const malformedMessagePenalty = 5
 const tooBigMessagePenalty = 5
 const unknownRecipientPenalty = 1
+const unauthorizedPipeliningPenalty = 5
+const sessionLimitExceededPenalty = 5
 const commandExecutedProperly = 3 // 3 - HELO/EHLO, 3 MAIL FROM, 3 RCPT TO, 3 DATA - good transaction is 12
 
 // TLSVersions is used to pretty print TLS protocol version being used
@@ -31,3 +57,6 @@ const SubjectFact = "subject"
 
 // NullSenderFlag is used to cover case when sender is null like with delivery confirmations
 const NullSenderFlag = "null_sender"
+
+// QuarantineFlag is set for message, which DataHandlers should deliver to quarantine according to its Verdict
+const QuarantineFlag = "quarantine"
@@ -0,0 +1,80 @@
+package msmtpd
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Like smtpd_delay_reject of Postfix does, server can delay rejections made by ConnectionCheckers,
+// HeloCheckers and SenderCheckers until RCPT TO command, if Server.DelayReject is set. So, sender and
+// recipients of rejected client are known and logged, and mail to Server.AlwaysAcceptedRecipients,
+// like postmaster or abuse ones, can be accepted from clients, who would be rejected otherwise.
+
+// delayedRejection is error of plugins reported to client at RCPT TO command
+type delayedRejection struct {
+	phase Phase
+	err   error
+}
+
+// delayRejection remembers error of plugins of phase to be reported at RCPT TO command, if Server.DelayReject
+// is set. It returns false, if error should be reported right away. Only first error is remembered
+func (t *Transaction) delayRejection(span trace.Span, phase Phase, err error) bool {
+	if !t.server.DelayReject {
+		return false
+	}
+	if t.delayedRejection == nil {
+		t.delayedRejection = &delayedRejection{phase: phase, err: err}
+	}
+	t.LogInfo("%s : rejection by %s plugins is delayed until RCPT TO", err, phase)
+	span.AddEvent("rejection delayed", trace.WithAttributes(
+		attribute.String("phase", string(phase)),
+		attribute.String("error", err.Error()),
+	))
+	return true
+}
+
+// delayedRejectionError returns error delayed by Transaction.delayRejection to be reported for recipient
+func (t *Transaction) delayedRejectionError(span trace.Span, recipient string) error {
+	if t.delayedRejection == nil {
+		return nil
+	}
+	t.LogInfo("%s : recipient %s of %s is rejected after %s plugins failed",
+		t.delayedRejection.err, recipient, t.MailFrom.String(), t.delayedRejection.phase)
+	span.AddEvent("delayed rejection", trace.WithAttributes(
+		attribute.String("phase", string(t.delayedRejection.phase)),
+		attribute.String("error", t.delayedRejection.err.Error()),
+	))
+	return t.delayedRejection.err
+}
+
+// recipientsAlwaysAccepted returns true, if all recipients of envelope are Server.AlwaysAcceptedRecipients
+func (t *Transaction) recipientsAlwaysAccepted() bool {
+	if len(t.RcptTo) == 0 {
+		return false
+	}
+	for i := range t.RcptTo {
+		if !t.isAlwaysAccepted(t.RcptTo[i].Address) {
+			return false
+		}
+	}
+	return true
+}
+
+// isAlwaysAccepted returns true, if recipient matches any of Server.AlwaysAcceptedRecipients
+func (t *Transaction) isAlwaysAccepted(recipient string) bool {
+	localPart := recipient
+	if at := strings.LastIndex(recipient, "@"); at != -1 {
+		localPart = recipient[:at]
+	}
+	for _, accepted := range t.server.AlwaysAcceptedRecipients {
+		if strings.EqualFold(accepted, recipient) {
+			return true
+		}
+		if !strings.Contains(accepted, "@") && strings.EqualFold(accepted, localPart) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package msmtpd
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func TestDelayedRejection(t *testing.T) {
+	blacklisted := ErrorSMTP{Code: 554, EnhancedCode: "5.7.1", Message: "You are blacklisted."}
+	testCases := []struct {
+		name   string
+		server *Server
+	}{
+		{"connection", &Server{
+			ConnectionCheckers: []ConnectionChecker{
+				func(_ context.Context, _ *Transaction) error {
+					return blacklisted
+				},
+			},
+		}},
+		{"helo", &Server{
+			HeloCheckers: []HelloChecker{
+				func(_ context.Context, _ *Transaction) error {
+					return blacklisted
+				},
+			},
+		}},
+	}
+	for i := range testCases {
+		t.Run(testCases[i].name, func(t *testing.T) {
+			server := testCases[i].server
+			server.DelayReject = true
+			server.AlwaysAcceptedRecipients = []string{"postmaster", "abuse@example.net"}
+			addr, closer := RunTestServerWithoutTLS(t, server)
+			defer closer()
+			c, err := smtp.Dial(addr)
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			if err = c.Hello("localhost"); err != nil {
+				t.Errorf("HELO failed: %v", err)
+			}
+			if err = c.Mail("sender@example.org"); err != nil {
+				t.Errorf("MAIL failed: %v", err)
+			}
+			err = c.Rcpt("recipient@example.net")
+			if err == nil {
+				t.Errorf("RCPT is accepted from blacklisted client")
+			} else if err.Error() != blacklisted.Error() {
+				t.Errorf("wrong error for delayed rejection: %s", err)
+			}
+			for _, recipient := range []string{"postmaster@example.org", "Abuse@example.net"} {
+				if err = c.Rcpt(recipient); err != nil {
+					t.Errorf("RCPT %s failed: %v", recipient, err)
+				}
+			}
+			if err = c.Rcpt("abuse@example.org"); err == nil {
+				t.Errorf("RCPT to abuse of other domain is accepted from blacklisted client")
+			}
+			if err = c.Quit(); err != nil {
+				t.Errorf("Quit failed: %v", err)
+			}
+			waitForTransactionsClosed(server)
+		})
+	}
+}
+
+func TestDelayedSenderRejection(t *testing.T) {
+	server := &Server{
+		DelayReject: true,
+		SenderCheckers: []SenderChecker{
+			func(_ context.Context, tr *Transaction) error {
+				if strings.HasPrefix(tr.MailFrom.Address, "spammer@") {
+					return ErrorSMTP{Code: 550, EnhancedCode: "5.7.1", Message: "Go away!"}
+				}
+				return nil
+			},
+		},
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = c.Mail("spammer@example.org"); err != nil {
+		t.Errorf("MAIL failed: %v", err)
+	}
+	if err = c.Rcpt("recipient@example.net"); err == nil {
+		t.Errorf("RCPT is accepted from rejected sender")
+	}
+	if err = c.Reset(); err != nil {
+		t.Errorf("RSET failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed: %v", err)
+	}
+	if err = c.Rcpt("recipient@example.net"); err != nil {
+		t.Errorf("RCPT failed after rejected sender is reset: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+}
+
+func TestAlwaysAcceptedRecipientsBypassVerdict(t *testing.T) {
+	delivered := make(chan string, 1)
+	server := &Server{
+		DelayReject:              true,
+		AlwaysAcceptedRecipients: []string{"postmaster"},
+		VerdictThresholds:        VerdictThresholds{Reject: 10},
+		Plugins: []Plugin{
+			{
+				Name: "rbl",
+				ConnectionChecker: func(ctx context.Context, tr *Transaction) error {
+					tr.AddScore(ctx, 20, "listed")
+					return nil
+				},
+			},
+		},
+		DataHandlers: []DataHandler{
+			func(_ context.Context, tr *Transaction) error {
+				delivered <- tr.RcptTo[0].Address
+				return nil
+			},
+		},
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed: %v", err)
+	}
+	if err = c.Rcpt("recipient@example.net"); err == nil || err.Error() != ErrVerdictReject.Error() {
+		t.Errorf("wrong error for recipient of spammer: %v", err)
+	}
+	if err = c.Rcpt("postmaster@example.net"); err != nil {
+		t.Errorf("RCPT to postmaster failed: %v", err)
+	}
+	wc, err := c.Data()
+	if err != nil {
+		t.Fatalf("DATA failed: %v", err)
+	}
+	if _, err = fmt.Fprint(wc, internal.MakeTestMessage("sender@example.org", "postmaster@example.net")); err != nil {
+		t.Errorf("Data body failed: %v", err)
+	}
+	if err = wc.Close(); err != nil {
+		t.Errorf("message to postmaster is rejected: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+	if len(delivered) != 1 || <-delivered != "postmaster@example.net" {
+		t.Errorf("message to postmaster is not delivered")
+	}
+}
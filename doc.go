@@ -1,4 +1,9 @@
 // Package msmtpd is framework for building Enchanced/Simple Mail Transfer Protocol daemons
 // including inbound, outbound servers, smtp proxies, spamtraps, honeypots and everything that
 // talks SMTP
+//
+// Message body received via DATA or BDAT commands can be spooled to temporary file, so plugins
+// should read it via Transaction.BodyReader and replace it via Transaction.SetBody. Transaction.Body
+// byte slice of previous versions is replaced by deprecated Transaction.Body method, which loads
+// whole message into memory.
 package msmtpd
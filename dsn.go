@@ -0,0 +1,152 @@
+package msmtpd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Good read - https://www.rfc-editor.org/rfc/rfc3461
+// Example:
+// `MAIL FROM:<sender@example.org> RET=HDRS ENVID=QQ314159`
+// `RCPT TO:<recipient@example.org> NOTIFY=SUCCESS,FAILURE ORCPT=rfc822;recipient@example.org`
+
+// DSN notification conditions client can request via NOTIFY parameter of `RCPT TO:`
+const (
+	// DSNNotifyNever means no notifications should be sent for recipient
+	DSNNotifyNever = "NEVER"
+	// DSNNotifySuccess means notification should be sent when message is delivered to recipient
+	DSNNotifySuccess = "SUCCESS"
+	// DSNNotifyFailure means notification should be sent when message delivery to recipient failed
+	DSNNotifyFailure = "FAILURE"
+	// DSNNotifyDelay means notification should be sent when message delivery to recipient is delayed
+	DSNNotifyDelay = "DELAY"
+)
+
+// DSN return types client can request via RET parameter of `MAIL FROM:`
+const (
+	// DSNReturnFull means full message should be returned with failure notification
+	DSNReturnFull = "FULL"
+	// DSNReturnHeaders means only message headers should be returned with failure notification
+	DSNReturnHeaders = "HDRS"
+)
+
+// maxEnvelopeIDLength is maximum length of ENVID parameter as RFC 3461 section 4.4 requires
+const maxEnvelopeIDLength = 100
+
+// DSNReturn returns RET parameter of `MAIL FROM:` in upper case - DSNReturnFull, DSNReturnHeaders,
+// or empty string, if client has not requested it
+func (t *Transaction) DSNReturn() string {
+	return strings.ToUpper(t.MailFromParameters.Get("RET"))
+}
+
+// DSNEnvelopeID returns ENVID parameter of `MAIL FROM:` decoded from xtext,
+// or empty string, if client has not provided it
+func (t *Transaction) DSNEnvelopeID() string {
+	envid, err := decodeXtext(t.MailFromParameters.Get("ENVID"))
+	if err != nil {
+		return ""
+	}
+	return envid
+}
+
+// DSNNotify returns notification conditions requested by NOTIFY parameter of `RCPT TO:` for recipient
+// provided, for example []string{DSNNotifySuccess, DSNNotifyFailure}, or nil, if client has not requested them
+func (t *Transaction) DSNNotify(recipient string) []string {
+	notify := t.RcptToParameters[recipient].Get("NOTIFY")
+	if notify == "" {
+		return nil
+	}
+	return strings.Split(strings.ToUpper(notify), ",")
+}
+
+// DSNOriginalRecipient returns address type and address decoded from xtext provided
+// by ORCPT parameter of `RCPT TO:` for recipient, like `rfc822` and `recipient@example.org`
+func (t *Transaction) DSNOriginalRecipient(recipient string) (addrType, address string) {
+	orcpt := t.RcptToParameters[recipient].Get("ORCPT")
+	addrType, encoded, found := strings.Cut(orcpt, ";")
+	if !found {
+		return "", ""
+	}
+	address, err := decodeXtext(encoded)
+	if err != nil {
+		return "", ""
+	}
+	return addrType, address
+}
+
+// validateMailFromDSN checks RET and ENVID parameters of `MAIL FROM:`
+func validateMailFromDSN(params Parameters) error {
+	if params.Has("RET") {
+		ret := strings.ToUpper(params.Get("RET"))
+		if ret != DSNReturnFull && ret != DSNReturnHeaders {
+			return fmt.Errorf("malformed RET parameter: %s", params.Get("RET"))
+		}
+	}
+	if params.Has("ENVID") {
+		envid := params.Get("ENVID")
+		if len(envid) > maxEnvelopeIDLength {
+			return fmt.Errorf("ENVID parameter is too long")
+		}
+		_, err := decodeXtext(envid)
+		if err != nil {
+			return fmt.Errorf("malformed ENVID parameter: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateRcptToDSN checks NOTIFY and ORCPT parameters of `RCPT TO:`
+func validateRcptToDSN(params Parameters) error {
+	if params.Has("NOTIFY") {
+		conditions := strings.Split(strings.ToUpper(params.Get("NOTIFY")), ",")
+		for _, condition := range conditions {
+			switch condition {
+			case DSNNotifySuccess, DSNNotifyFailure, DSNNotifyDelay:
+				continue
+			case DSNNotifyNever:
+				if len(conditions) > 1 {
+					return fmt.Errorf("NOTIFY=NEVER cannot be combined with other conditions")
+				}
+			default:
+				return fmt.Errorf("malformed NOTIFY parameter: %s", params.Get("NOTIFY"))
+			}
+		}
+	}
+	if params.Has("ORCPT") {
+		addrType, encoded, found := strings.Cut(params.Get("ORCPT"), ";")
+		if !found || addrType == "" || encoded == "" {
+			return fmt.Errorf("malformed ORCPT parameter: %s", params.Get("ORCPT"))
+		}
+		_, err := decodeXtext(encoded)
+		if err != nil {
+			return fmt.Errorf("malformed ORCPT parameter: %w", err)
+		}
+	}
+	return nil
+}
+
+// decodeXtext decodes xtext as RFC 3461 section 4 describes - `+` followed by two
+// upper case hexadecimal digits encodes one byte, for example, `+2B` is `+`
+func decodeXtext(input string) (string, error) {
+	if !strings.Contains(input, "+") {
+		return input, nil
+	}
+	var output strings.Builder
+	for i := 0; i < len(input); i++ {
+		if input[i] != '+' {
+			output.WriteByte(input[i])
+			continue
+		}
+		if i+2 >= len(input) {
+			return "", fmt.Errorf("malformed xtext: %s", input)
+		}
+		decoded, err := strconv.ParseUint(input[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("malformed xtext: %s", input)
+		}
+		output.WriteByte(byte(decoded))
+		i += 2
+	}
+	return output.String(), nil
+}
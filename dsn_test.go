@@ -0,0 +1,70 @@
+package msmtpd
+
+import "testing"
+
+func TestDecodeXtext(t *testing.T) {
+	cases := map[string]string{
+		"QQ314159":              "QQ314159",
+		"QQ+2B314159":           "QQ+314159",
+		"rfc822+3Bsomebody+3D1": "rfc822;somebody=1",
+	}
+	for input, expected := range cases {
+		decoded, err := decodeXtext(input)
+		if err != nil {
+			t.Errorf("%s : while decoding %s", err, input)
+			continue
+		}
+		if decoded != expected {
+			t.Errorf("wrong result %s for %s instead of %s", decoded, input, expected)
+		}
+	}
+	for _, malformed := range []string{"QQ+", "QQ+2", "QQ+ZZ"} {
+		_, err := decodeXtext(malformed)
+		if err == nil {
+			t.Errorf("error not thrown for %s", malformed)
+		}
+	}
+}
+
+func TestValidateDSN(t *testing.T) {
+	valid := []Parameters{
+		{"RET": "FULL", "ENVID": "QQ314159"},
+		{"RET": "hdrs"},
+		{},
+	}
+	for i := range valid {
+		if err := validateMailFromDSN(valid[i]); err != nil {
+			t.Errorf("%s : for %s", err, valid[i])
+		}
+	}
+	invalid := []Parameters{
+		{"RET": "BODY"},
+		{"ENVID": "QQ+Z"},
+	}
+	for i := range invalid {
+		if err := validateMailFromDSN(invalid[i]); err == nil {
+			t.Errorf("error not thrown for %s", invalid[i])
+		}
+	}
+	valid = []Parameters{
+		{"NOTIFY": "SUCCESS,FAILURE,DELAY", "ORCPT": "rfc822;somebody@example.org"},
+		{"NOTIFY": "never"},
+		{},
+	}
+	for i := range valid {
+		if err := validateRcptToDSN(valid[i]); err != nil {
+			t.Errorf("%s : for %s", err, valid[i])
+		}
+	}
+	invalid = []Parameters{
+		{"NOTIFY": "NEVER,SUCCESS"},
+		{"NOTIFY": "SOMETIMES"},
+		{"ORCPT": "somebody@example.org"},
+		{"ORCPT": "rfc822;"},
+	}
+	for i := range invalid {
+		if err := validateRcptToDSN(invalid[i]); err == nil {
+			t.Errorf("error not thrown for %s", invalid[i])
+		}
+	}
+}
@@ -3,17 +3,44 @@ package msmtpd
 import (
 	"errors"
 	"fmt"
+	"regexp"
 )
 
+// enhancedCodeRegex matches enhanced status code in class.subject.detail format
+var enhancedCodeRegex = regexp.MustCompile(`^[245]\.\d{1,3}\.\d{1,3}( |$)`)
+
 // ErrorSMTP represents an Error reported in the SMTP session.
 type ErrorSMTP struct {
-	Code    int    // The integer error code
-	Message string // The error message
+	Code         int    // The integer error code
+	EnhancedCode string // The enhanced status code like 5.1.1, see RFC 3463
+	Message      string // The error message
 }
 
 // Error returns a string representation of the SMTP error
 func (e ErrorSMTP) Error() string {
-	return fmt.Sprintf("%d %s", e.Code, e.Message)
+	enhancedCode := e.enhancedCode()
+	if enhancedCode == "" {
+		return fmt.Sprintf("%d %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("%d %s %s", e.Code, enhancedCode, e.Message)
+}
+
+// enhancedCode returns enhanced status code being sent to client. If EnhancedCode is not set,
+// generic one for reply class is used, like 4.0.0 for 451 or 5.0.0 for 550.
+// If Message already starts with enhanced status code, nothing is added.
+func (e ErrorSMTP) enhancedCode() string {
+	if e.EnhancedCode != "" {
+		return e.EnhancedCode
+	}
+	if enhancedCodeRegex.MatchString(e.Message) {
+		return ""
+	}
+	switch e.Code / 100 {
+	case 2, 4, 5:
+		return fmt.Sprintf("%d.0.0", e.Code/100)
+	default:
+		return ""
+	}
 }
 
 // ErrServerClosed is returned by the Server's Serve and ListenAndServe,
@@ -22,21 +49,46 @@ var ErrServerClosed = errors.New("smtp: Server closed")
 
 // Status codes for SMTP negotiations
 // see https://en.wikipedia.org/wiki/List_of_SMTP_server_return_codes
+// and https://www.iana.org/assignments/smtp-enhanced-status-codes/smtp-enhanced-status-codes.xhtml
 
 // ErrServiceNotAvailable means server cannot perform this SMTP transaction and it should be retried later
 var ErrServiceNotAvailable = ErrorSMTP{
-	Code:    421,
-	Message: "Service not available. Try again later, please.",
+	Code:         421,
+	EnhancedCode: "4.3.2",
+	Message:      "Service not available. Try again later, please.",
+}
+
+// ErrConnectionSetupTimeout means TLS handshake, PTR lookups and ConnectionCheckers took too long
+var ErrConnectionSetupTimeout = ErrorSMTP{
+	Code:         421,
+	EnhancedCode: "4.4.2",
+	Message:      "Connection setup timed out. Try again later, please.",
 }
 
 // ErrServiceDoesNotAcceptEmail means server will not perform this SMTP transaction, even if your try to retry it
 var ErrServiceDoesNotAcceptEmail = ErrorSMTP{
-	Code:    521,
-	Message: "Server does not accept mail. Do not retry delivery, please. It will fail.",
+	Code:         521,
+	EnhancedCode: "5.3.2",
+	Message:      "Server does not accept mail. Do not retry delivery, please. It will fail.",
 }
 
 // ErrAuthenticationCredentialsInvalid means SMTP credentials are invalid
 var ErrAuthenticationCredentialsInvalid = ErrorSMTP{
-	Code:    535,
-	Message: "Authentication credentials are invalid.",
+	Code:         535,
+	EnhancedCode: "5.7.8",
+	Message:      "Authentication credentials are invalid.",
+}
+
+// ErrAuthenticationCredentialsMalformed means client sent SASL response we cannot decode or parse
+var ErrAuthenticationCredentialsMalformed = ErrorSMTP{
+	Code:         502,
+	EnhancedCode: "5.5.2",
+	Message:      "Couldn't decode your credentials",
+}
+
+// ErrInsufficientStorage means server cannot store message body, so it should be retried later
+var ErrInsufficientStorage = ErrorSMTP{
+	Code:         452,
+	EnhancedCode: "4.3.1",
+	Message:      "Requested action not taken: insufficient system storage",
 }
@@ -0,0 +1,23 @@
+package msmtpd
+
+import "testing"
+
+func TestErrorSMTP_Error(t *testing.T) {
+	cases := []struct {
+		err      ErrorSMTP
+		expected string
+	}{
+		{ErrorSMTP{Code: 550, EnhancedCode: "5.1.1", Message: "no such user"}, "550 5.1.1 no such user"},
+		{ErrorSMTP{Code: 451, Message: "try later"}, "451 4.0.0 try later"},
+		{ErrorSMTP{Code: 521, Message: "5.7.1 go away"}, "521 5.7.1 go away"},
+		{ErrorSMTP{Code: 250, Message: "ok"}, "250 2.0.0 ok"},
+		{ErrorSMTP{Code: 334, Message: "challenge"}, "334 challenge"},
+		{ErrServiceNotAvailable, "421 4.3.2 Service not available. Try again later, please."},
+	}
+	for i := range cases {
+		if cases[i].err.Error() != cases[i].expected {
+			t.Errorf("case %v: wrong error `%s` instead of `%s`",
+				i, cases[i].err.Error(), cases[i].expected)
+		}
+	}
+}
@@ -91,8 +91,9 @@ func main() {
 				tr.LogWarn("User %s tried to send email on behalf of %s",
 					tr.Username, tr.MailFrom.Address)
 				return msmtpd.ErrorSMTP{
-					Code:    535,
-					Message: fmt.Sprintf("You are not allowed to send email as different user"),
+					Code:         535,
+					EnhancedCode: "5.7.1",
+					Message:      fmt.Sprintf("You are not allowed to send email as different user"),
 				}
 			},
 		},
@@ -113,8 +114,9 @@ func main() {
 				}
 				if froms[0].Address != tr.MailFrom.Address {
 					return msmtpd.ErrorSMTP{
-						Code:    535,
-						Message: fmt.Sprintf("You are not allowed to send email as different user"),
+						Code:         535,
+						EnhancedCode: "5.7.1",
+						Message:      fmt.Sprintf("You are not allowed to send email as different user"),
 					}
 				}
 				return nil
@@ -0,0 +1,64 @@
+package main
+
+// Example of single server listening on MX port for other mail servers
+// and on submission ports for users, with different policies for each of them.
+
+import (
+	"context"
+	"log"
+
+	"github.com/vodolaz095/msmtpd"
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func main() {
+	// make TLS config never be used for production
+	tlsConfig, err := internal.MakeTLSForLocalhost()
+	if err != nil {
+		log.Fatalf("%s : while making TLS config for localhost", err)
+	}
+	server := msmtpd.Server{
+		Hostname:  "localhost",
+		TLSConfig: tlsConfig,
+		Authenticator: func(_ context.Context, tr *msmtpd.Transaction, username, password string) error {
+			if username == "user" && password == "password" {
+				return nil
+			}
+			return msmtpd.ErrAuthenticationCredentialsInvalid
+		},
+		DataHandlers: []msmtpd.DataHandler{
+			func(_ context.Context, tr *msmtpd.Transaction) error {
+				if tr.Listener == "mx" {
+					tr.LogInfo("We pretend we deliver message to local mailbox")
+				} else {
+					tr.LogInfo("We pretend we relay message of %s", tr.Username)
+				}
+				return nil
+			},
+		},
+		Listeners: []msmtpd.ListenerConfig{
+			{
+				Name:           "mx",
+				Address:        ":1025",
+				WelcomeMessage: "localhost ESMTP ready for other mail servers.",
+				Authentication: msmtpd.AuthenticationPolicyDisabled,
+			},
+			{
+				Name:           "submissions",
+				Address:        ":1465",
+				TLS:            msmtpd.TLSPolicyImplicit,
+				MaxMessageSize: 50 * 1024 * 1024,
+			},
+			{
+				Name:           "submission",
+				Address:        ":1587",
+				TLS:            msmtpd.TLSPolicyRequired,
+				MaxMessageSize: 50 * 1024 * 1024,
+			},
+		},
+	}
+	err = server.ListenAndServeAll()
+	if err != nil {
+		log.Fatalf("%s : while starting server", err)
+	}
+}
@@ -59,8 +59,9 @@ func main() {
 			func(_ context.Context, tr *msmtpd.Transaction, recipient *mail.Address) error {
 				if strings.HasPrefix(recipient.Address, "info@") {
 					return msmtpd.ErrorSMTP{
-						Code:    535,
-						Message: "Just stop it, please",
+						Code:         535,
+						EnhancedCode: "5.7.1",
+						Message:      "Just stop it, please",
 					}
 				}
 				return nil
@@ -72,8 +73,9 @@ func main() {
 			func(_ context.Context, tr *msmtpd.Transaction) error {
 				if tr.Parsed.Header.Get("X-Priority") == "" {
 					return msmtpd.ErrorSMTP{
-						Code:    535,
-						Message: "Please, provide priority for your message!",
+						Code:         535,
+						EnhancedCode: "5.7.1",
+						Message:      "Please, provide priority for your message!",
 					}
 				}
 				// Add header to message
@@ -84,9 +86,9 @@ func main() {
 		// DataHandlers are actual message delivery to persistent storage
 		DataHandlers: []msmtpd.DataHandler{
 			func(_ context.Context, tr *msmtpd.Transaction) error {
-				tr.LogInfo("We pretend we deliver %v bytes of message somehow", len(tr.Body))
+				tr.LogInfo("We pretend we deliver %v bytes of message somehow", tr.BodySize())
 				// set float64 fact abount transaction
-				tr.Incr("size", float64(len(tr.Body)))
+				tr.Incr("size", float64(tr.BodySize()))
 				return msmtpd.ErrServiceNotAvailable
 			},
 		},
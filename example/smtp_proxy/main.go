@@ -86,8 +86,9 @@ func main() {
 			func(_ context.Context, tr *msmtpd.Transaction, recipient *mail.Address) error {
 				if strings.HasPrefix(recipient.Address, "info@") {
 					return msmtpd.ErrorSMTP{
-						Code:    535,
-						Message: "Just stop it, please",
+						Code:         535,
+						EnhancedCode: "5.7.1",
+						Message:      "Just stop it, please",
 					}
 				}
 				return nil
@@ -108,7 +109,7 @@ func main() {
 			// copies of messages are send using Transaction.Aliases
 			func(_ context.Context, tr *msmtpd.Transaction) error {
 				for i := range tr.RcptTo {
-					tr.Aliases = append(tr.Aliases, tr.RcptTo[i])
+					tr.AddAlias(tr.RcptTo[i], tr.RcptTo[i].Address)
 				}
 				tr.Aliases = append(tr.Aliases, mail.Address{
 					Name:    "Big Brother",
@@ -113,9 +113,9 @@ func Example() {
 		// DataHandlers do actual message delivery to persistent storage
 		DataHandlers: []DataHandler{
 			func(_ context.Context, tr *Transaction) error {
-				tr.LogInfo("We pretend we deliver %v bytes of message somehow", len(tr.Body))
+				tr.LogInfo("We pretend we deliver %v bytes of message somehow", tr.BodySize())
 				// set float64 fact about transaction
-				tr.Incr("size", float64(len(tr.Body)))
+				tr.Incr("size", float64(tr.BodySize()))
 				return ErrServiceNotAvailable
 			},
 		},
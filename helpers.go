@@ -47,7 +47,8 @@ func parseLine(line string) (cmd command) {
 
 			if cmd.fields[1][len(cmd.fields[1])-1] == ':' && len(cmd.fields) > 2 {
 				cmd.fields[1] = cmd.fields[1] + cmd.fields[2]
-				cmd.fields = cmd.fields[0:2]
+				// ESMTP parameters like SMTPUTF8 can follow address, so we keep them
+				cmd.fields = append(cmd.fields[0:2], cmd.fields[3:]...)
 			}
 			cmd.params = strings.Split(cmd.fields[1], ":")
 		}
@@ -0,0 +1,299 @@
+package msmtpd
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Usually mail server listens on few ports with different policies:
+// 25 is MX for other mail servers, where STARTTLS is optional and authentication is not required,
+// 465 is submission for users with implicit TLS and authentication required, and
+// 587 is submission for users, where STARTTLS and authentication are required.
+// Single Server can serve all of them, sharing counters, shutdown and configuration.
+
+// DefaultListenerName is name of listener started by Server.Serve and Server.ListenAndServe
+const DefaultListenerName = "default"
+
+// TLSPolicy defines how listener uses TLS
+type TLSPolicy int
+
+const (
+	// TLSPolicyDefault means Server.ForceTLS is used
+	TLSPolicyDefault TLSPolicy = iota
+	// TLSPolicyOptional means STARTTLS is offered, if TLSConfig is set, but clients can send mail without it
+	TLSPolicyOptional
+	// TLSPolicyRequired means clients have to issue STARTTLS before sending mail
+	TLSPolicyRequired
+	// TLSPolicyImplicit means connections are encrypted right after they are accepted
+	TLSPolicyImplicit
+)
+
+// AuthenticationPolicy defines, if clients of listener have to authenticate
+type AuthenticationPolicy int
+
+const (
+	// AuthenticationPolicyDefault means clients have to authenticate, if Server.SASLMechanisms
+	// or Server.CertificateMapper are set
+	AuthenticationPolicyDefault AuthenticationPolicy = iota
+	// AuthenticationPolicyOptional means AUTH is advertised, but clients can send mail without authentication
+	AuthenticationPolicyOptional
+	// AuthenticationPolicyRequired means clients have to authenticate before sending mail
+	AuthenticationPolicyRequired
+	// AuthenticationPolicyDisabled means AUTH is not advertised and TLS client certificates are not mapped to users
+	AuthenticationPolicyDisabled
+)
+
+// ListenerConfig defines named listener of Server with its own policy. Fields left empty
+// are inherited from Server, so empty slice of checkers disables them, while nil one inherits
+// checkers of Server
+type ListenerConfig struct {
+	// Name is exposed as Transaction.Listener, so plugins can use it, default is DefaultListenerName
+	Name string
+	// Network is network of Address, `tcp` (default) or `unix` for local clients connected via unix domain socket
+	Network string
+	// Address is address being listened by Server.ListenAndServeAll, like `:25` for TCP one,
+	// or `/run/msmtpd/submission.sock` for unix domain socket
+	Address string
+	// WelcomeMessage sets initial banner of listener
+	WelcomeMessage string
+	// TLS defines how listener uses TLS
+	TLS TLSPolicy
+	// TLSConfig is used both for STARTTLS and implicit TLS instead of Server.TLSConfig
+	TLSConfig *tls.Config
+	// Authentication defines, if clients have to authenticate
+	Authentication AuthenticationPolicy
+
+	// MaxConnections sets maximum number of concurrent connections to listener, use -1 to disable
+	MaxConnections int
+	// ConnectionQueueTimeout is used instead of Server.ConnectionQueueTimeout, use -1 to reject connections
+	// immediately, when MaxConnections is reached
+	ConnectionQueueTimeout time.Duration
+	// MaxConnectionsPerIP is used instead of Server.MaxConnectionsPerIP, use -1 to disable.
+	// Connections are counted for every listener separately
+	MaxConnectionsPerIP int
+	// MaxConnectionsPerSubnet is used instead of Server.MaxConnectionsPerSubnet, use -1 to disable.
+	// Connections are counted for every listener separately
+	MaxConnectionsPerSubnet int
+	// MaxMessageSize is maximum size of message accepted by listener
+	MaxMessageSize int
+	// MaxRecipients are limit for RCPT TO calls for each envelope
+	MaxRecipients int
+
+	// ConnectionCheckers are used instead of Server.ConnectionCheckers
+	ConnectionCheckers []ConnectionChecker
+	// HeloCheckers are used instead of Server.HeloCheckers
+	HeloCheckers []HelloChecker
+	// SenderCheckers are used instead of Server.SenderCheckers
+	SenderCheckers []SenderChecker
+	// RecipientCheckers are used instead of Server.RecipientCheckers
+	RecipientCheckers []RecipientChecker
+	// DataCheckers are used instead of Server.DataCheckers
+	DataCheckers []DataChecker
+	// DataHandlers are used instead of Server.DataHandlers
+	DataHandlers []DataHandler
+	// Plugins are used instead of Server.Plugins
+	Plugins []Plugin
+}
+
+// listener is ListenerConfig with values inherited from Server filled in
+type listener struct {
+	ListenerConfig
+	netListener net.Listener
+	// closeHandlers are Server.CloseHandlers followed by ones of Plugins
+	closeHandlers []CloseHandler
+	// stateHooks are Server.StateHooks followed by ones of Plugins
+	stateHooks []StateHook
+	// plugins are Plugins functions of every Phase belong to, nil ones are anonymous
+	plugins map[Phase][]*Plugin
+}
+
+// forceTLS returns true, if clients have to use encrypted connection
+func (l *listener) forceTLS() bool {
+	return l.TLS == TLSPolicyRequired || l.TLS == TLSPolicyImplicit
+}
+
+// authenticationEnabled returns true, if clients can authenticate via AUTH command
+func (l *listener) authenticationEnabled() bool {
+	return l.Authentication != AuthenticationPolicyDisabled
+}
+
+// authenticationRequired returns true, if clients have to authenticate before sending mail
+func (l *listener) authenticationRequired() bool {
+	return l.Authentication == AuthenticationPolicyRequired
+}
+
+// tlsConfig returns TLS config of listener client is connected to, or one of Server,
+// if listener has not its own one. Server.TLSConfig is not copied into listener,
+// so it can be changed while server is running
+func (t *Transaction) tlsConfig() *tls.Config {
+	if t.listener.TLSConfig != nil {
+		return t.listener.TLSConfig
+	}
+	return t.server.TLSConfig
+}
+
+// resolveListener fills empty fields of config with values of Server
+func (srv *Server) resolveListener(config ListenerConfig) (*listener, error) {
+	l := listener{ListenerConfig: config}
+	if l.Name == "" {
+		l.Name = DefaultListenerName
+	}
+	if l.WelcomeMessage == "" {
+		l.WelcomeMessage = srv.WelcomeMessage
+	}
+	if l.TLS == TLSPolicyDefault {
+		if srv.ForceTLS {
+			l.TLS = TLSPolicyRequired
+		} else {
+			l.TLS = TLSPolicyOptional
+		}
+	}
+	if l.TLS != TLSPolicyOptional && l.TLSConfig == nil && srv.TLSConfig == nil {
+		return nil, fmt.Errorf("listener %s requires TLS, but TLSConfig is not set", l.Name)
+	}
+	if l.Authentication == AuthenticationPolicyDefault {
+		if len(srv.SASLMechanisms) > 0 || srv.CertificateMapper != nil {
+			l.Authentication = AuthenticationPolicyRequired
+		} else {
+			l.Authentication = AuthenticationPolicyOptional
+		}
+	}
+	if l.authenticationRequired() && len(srv.SASLMechanisms) == 0 && srv.CertificateMapper == nil {
+		// every MAIL FROM would be rejected, because there is no way to authenticate
+		return nil, fmt.Errorf("listener %s requires authentication, but neither SASLMechanisms, "+
+			"nor CertificateMapper are set", l.Name)
+	}
+	if l.MaxConnections == 0 {
+		l.MaxConnections = srv.MaxConnections
+	}
+	if l.ConnectionQueueTimeout == 0 {
+		l.ConnectionQueueTimeout = srv.ConnectionQueueTimeout
+	}
+	if l.MaxConnectionsPerIP == 0 {
+		l.MaxConnectionsPerIP = srv.MaxConnectionsPerIP
+	}
+	if l.MaxConnectionsPerSubnet == 0 {
+		l.MaxConnectionsPerSubnet = srv.MaxConnectionsPerSubnet
+	}
+	if l.MaxMessageSize == 0 {
+		l.MaxMessageSize = srv.MaxMessageSize
+	}
+	if l.MaxRecipients == 0 {
+		l.MaxRecipients = srv.MaxRecipients
+	}
+	if l.ConnectionCheckers == nil {
+		l.ConnectionCheckers = srv.ConnectionCheckers
+	}
+	if l.HeloCheckers == nil {
+		l.HeloCheckers = srv.HeloCheckers
+	}
+	if l.SenderCheckers == nil {
+		l.SenderCheckers = srv.SenderCheckers
+	}
+	if l.RecipientCheckers == nil {
+		l.RecipientCheckers = srv.RecipientCheckers
+	}
+	if l.DataCheckers == nil {
+		l.DataCheckers = srv.DataCheckers
+	}
+	if l.DataHandlers == nil {
+		l.DataHandlers = srv.DataHandlers
+	}
+	if l.Plugins == nil {
+		l.Plugins = srv.Plugins
+	}
+	l.closeHandlers = srv.CloseHandlers
+	l.stateHooks = srv.StateHooks
+	err := l.addPlugins(l.Plugins)
+	if err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// addListener registers listener being served, so it is closed on Server.Shutdown
+func (srv *Server) addListener(l *listener) error {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for i := range srv.listeners {
+		if srv.listeners[i].Name == l.Name {
+			return fmt.Errorf("listener %s is already served", l.Name)
+		}
+	}
+	srv.listeners = append(srv.listeners, l)
+	return nil
+}
+
+// removeListener forgets listener, which is not served anymore
+func (srv *Server) removeListener(l *listener) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for i := range srv.listeners {
+		if srv.listeners[i] == l {
+			srv.listeners = append(srv.listeners[:i], srv.listeners[i+1:]...)
+			return
+		}
+	}
+}
+
+// ListenerAddress returns address of listener with name provided, or nil, if it is not served
+func (srv *Server) ListenerAddress(name string) net.Addr {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for i := range srv.listeners {
+		if srv.listeners[i].Name == name {
+			return srv.listeners[i].netListener.Addr()
+		}
+	}
+	return nil
+}
+
+// ListenAndServeAll starts listening on addresses of all Server.Listeners and serves them,
+// until server is shut down or any of listeners fails
+func (srv *Server) ListenAndServeAll() error {
+	if srv.inShutdown.Load() {
+		return ErrServerClosed
+	}
+	if len(srv.Listeners) == 0 {
+		return errors.New("no listeners configured")
+	}
+	srv.configureDefaults()
+	// misconfigured listeners are reported before any of them is started
+	for i := range srv.Listeners {
+		_, err := srv.resolveListener(srv.Listeners[i])
+		if err != nil {
+			return err
+		}
+	}
+	netListeners := make([]net.Listener, 0, len(srv.Listeners))
+	for i := range srv.Listeners {
+		network := srv.Listeners[i].Network
+		if network == "" {
+			network = "tcp"
+		}
+		ln, err := net.Listen(network, srv.Listeners[i].Address)
+		if err != nil {
+			for j := range netListeners {
+				netListeners[j].Close()
+			}
+			return fmt.Errorf("%w : while starting listener %s on %s",
+				err, srv.Listeners[i].Name, srv.Listeners[i].Address)
+		}
+		netListeners = append(netListeners, ln)
+	}
+	errs := make(chan error, len(netListeners))
+	for i := range netListeners {
+		go func(ln net.Listener, config ListenerConfig) {
+			errs <- srv.ServeListener(ln, config)
+		}(netListeners[i], srv.Listeners[i])
+	}
+	err := <-errs
+	if !errors.Is(err, ErrServerClosed) {
+		// stop other listeners, so they do not keep working silently
+		srv.Shutdown(false)
+	}
+	return err
+}
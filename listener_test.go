@@ -0,0 +1,234 @@
+package msmtpd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func serveTestListener(t *testing.T, server *Server, config ListenerConfig) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go func() {
+		server.ServeListener(ln, config)
+	}()
+	t.Cleanup(func() {
+		ln.Close()
+	})
+	return ln.Addr().String()
+}
+
+func TestMultipleListeners(t *testing.T) {
+	cfg, err := internal.MakeTLSForLocalhost()
+	if err != nil {
+		t.Fatalf("%s : while loading test certs for localhost", err)
+	}
+	listeners := make(chan string, 10)
+	server := &Server{
+		Logger:        &TestLogger{Suite: t},
+		TLSConfig:     cfg,
+		Authenticator: AuthenticatorForTestsThatAlwaysWorks,
+		SenderCheckers: []SenderChecker{
+			func(_ context.Context, tr *Transaction) error {
+				listeners <- tr.Listener
+				return nil
+			},
+		},
+	}
+	server.configureDefaults()
+	mx := serveTestListener(t, server, ListenerConfig{
+		Name:           "mx",
+		WelcomeMessage: "mx.example.org ESMTP ready.",
+		Authentication: AuthenticationPolicyDisabled,
+		MaxMessageSize: 1024,
+	})
+	submission := serveTestListener(t, server, ListenerConfig{
+		Name: "submission",
+		TLS:  TLSPolicyRequired,
+	})
+	implicit := serveTestListener(t, server, ListenerConfig{
+		Name: "submissions",
+		TLS:  TLSPolicyImplicit,
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	// MX accepts mail without authentication and never advertises AUTH
+	conn, err := net.Dial("tcp", mx)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	text := textproto.NewConn(conn)
+	_, banner, err := text.ReadResponse(220)
+	if err != nil {
+		t.Fatalf("%s : while reading banner", err)
+	}
+	if banner != "mx.example.org ESMTP ready." {
+		t.Errorf("wrong banner %s", banner)
+	}
+	text.Close()
+	c, err := smtp.Dial(mx)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("STARTTLS failed: %v", err)
+	}
+	if supported, _ := c.Extension("AUTH"); supported {
+		t.Errorf("AUTH is advertised on MX listener")
+	}
+	if _, size := c.Extension("SIZE"); size != "1024" {
+		t.Errorf("wrong message size limit %s", size)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed on MX listener: %v", err)
+	}
+	if listener := <-listeners; listener != "mx" {
+		t.Errorf("wrong listener name %s", listener)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+
+	// submission requires STARTTLS and authentication
+	c, err = smtp.Dial(submission)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err == nil || !strings.HasPrefix(err.Error(), "502 5.7.0") {
+		t.Errorf("MAIL without STARTTLS didn't fail properly: %v", err)
+	}
+	if err = c.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("STARTTLS failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err == nil || !strings.HasPrefix(err.Error(), "530 5.7.0") {
+		t.Errorf("MAIL without authentication didn't fail properly: %v", err)
+	}
+	if err = c.Auth(smtp.PlainAuth("", "user", "password", "127.0.0.1")); err != nil {
+		t.Errorf("AUTH failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed after authentication: %v", err)
+	}
+	if listener := <-listeners; listener != "submission" {
+		t.Errorf("wrong listener name %s", listener)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+
+	// implicit TLS listener encrypts connection right away
+	tlsConn, err := tls.Dial("tcp", implicit, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("%s : while dialing listener with implicit TLS", err)
+	}
+	c, err = smtp.NewClient(tlsConn, "localhost")
+	if err != nil {
+		t.Fatalf("%s : while making client", err)
+	}
+	if supported, _ := c.Extension("STARTTLS"); supported {
+		t.Errorf("STARTTLS is advertised on encrypted connection")
+	}
+	if supported, _ := c.Extension("AUTH"); !supported {
+		t.Errorf("AUTH is not advertised on encrypted connection")
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
+
+func TestListenerNamesAreUnique(t *testing.T) {
+	server := &Server{Logger: &TestLogger{Suite: t}}
+	serveTestListener(t, server, ListenerConfig{Name: "mx"})
+	time.Sleep(100 * time.Millisecond)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	err = server.ServeListener(ln, ListenerConfig{Name: "mx"})
+	if err == nil {
+		t.Errorf("listener with duplicate name is served")
+	}
+}
+
+func TestListenerRequiresTLSConfig(t *testing.T) {
+	server := &Server{Logger: &TestLogger{Suite: t}}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+	err = server.ServeListener(ln, ListenerConfig{Name: "submissions", TLS: TLSPolicyImplicit})
+	if err == nil {
+		t.Errorf("listener with implicit TLS is served without TLSConfig")
+	}
+}
+
+func TestListenerRequiresAuthenticationMechanisms(t *testing.T) {
+	server := &Server{
+		Logger: &TestLogger{Suite: t},
+		Listeners: []ListenerConfig{
+			{Name: "mx", Address: "127.0.0.1:0"},
+			{Name: "submission", Address: "127.0.0.1:0", Authentication: AuthenticationPolicyRequired},
+		},
+	}
+	err := server.ListenAndServeAll()
+	if err == nil || errors.Is(err, ErrServerClosed) {
+		t.Errorf("listener requiring authentication is served without SASLMechanisms: %v", err)
+	}
+	if server.ListenerAddress("mx") != nil {
+		t.Errorf("listener is started, while other one is misconfigured")
+	}
+	server.Authenticator = AuthenticatorForTestsThatAlwaysWorks
+	server.configureDefaults()
+	if _, err = server.resolveListener(server.Listeners[1]); err != nil {
+		t.Errorf("%s : while resolving listener with Authenticator", err)
+	}
+}
+
+func TestListenAndServeAll(t *testing.T) {
+	server := &Server{
+		Logger: &TestLogger{Suite: t},
+		Listeners: []ListenerConfig{
+			{Name: "mx", Address: "127.0.0.1:0"},
+			{Name: "submission", Address: "127.0.0.1:0"},
+		},
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- server.ListenAndServeAll()
+	}()
+	for _, name := range []string{"mx", "submission"} {
+		var addr net.Addr
+		for i := 0; i < 50 && addr == nil; i++ {
+			time.Sleep(10 * time.Millisecond)
+			addr = server.ListenerAddress(name)
+		}
+		if addr == nil {
+			t.Fatalf("listener %s is not started", name)
+		}
+		c, err := smtp.Dial(addr.String())
+		if err != nil {
+			t.Fatalf("Dial failed: %v", err)
+		}
+		if err = c.Quit(); err != nil {
+			t.Errorf("Quit failed: %v", err)
+		}
+	}
+	if err := server.Shutdown(true); err != nil {
+		t.Errorf("%s : while shutting down server", err)
+	}
+	if err := <-result; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("wrong error %v instead of ErrServerClosed", err)
+	}
+}
@@ -0,0 +1,116 @@
+package msmtpd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Good read - https://www.rfc-editor.org/rfc/rfc5321#section-4.1.2
+// Example: `MAIL FROM:<sender@example.org> SIZE=1024 BODY=8BITMIME`
+
+// mailFromParameters are parameters we accept in `MAIL FROM:` command
+var mailFromParameters = map[string]bool{
+	"SIZE":     true, // RFC 1870
+	"BODY":     true, // RFC 6152, RFC 3030
+	"AUTH":     true, // RFC 4954
+	"SMTPUTF8": true, // RFC 6531
+	"RET":      true, // RFC 3461
+	"ENVID":    true, // RFC 3461
+}
+
+// rcptToParameters are parameters we accept in `RCPT TO:` command
+var rcptToParameters = map[string]bool{
+	"NOTIFY": true, // RFC 3461
+	"ORCPT":  true, // RFC 3461
+}
+
+// bodyTypes are values of BODY parameter we accept
+var bodyTypes = map[string]bool{
+	"7BIT":       true,
+	"8BITMIME":   true,
+	"BINARYMIME": true,
+}
+
+// Parameters are ESMTP parameters client provided via `MAIL FROM:` or `RCPT TO:` commands.
+// Keys are upper cased esmtp-keywords, like SIZE or BODY, values are esmtp-values as client sent them,
+// or empty strings for parameters without values, like SMTPUTF8
+type Parameters map[string]string
+
+// Has returns true, if parameter with keyword provided is present
+func (p Parameters) Has(keyword string) bool {
+	_, found := p[strings.ToUpper(keyword)]
+	return found
+}
+
+// Get returns value of parameter with keyword provided, or empty string, if parameter is not present
+func (p Parameters) Get(keyword string) string {
+	return p[strings.ToUpper(keyword)]
+}
+
+// String returns parameters sorted by keyword in the same format client sends them
+func (p Parameters) String() string {
+	parts := make([]string, 0, len(p))
+	for k, v := range p {
+		if v == "" {
+			parts = append(parts, k)
+		} else {
+			parts = append(parts, k+"="+v)
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
+// parseParameters parses esmtp-keyword[=esmtp-value] pairs following address in `MAIL FROM:`/`RCPT TO:` commands
+func parseParameters(fields []string) (Parameters, error) {
+	params := make(Parameters, len(fields))
+	for _, field := range fields {
+		keyword, value, hasValue := strings.Cut(field, "=")
+		if !isValidParameterKeyword(keyword) {
+			return nil, fmt.Errorf("malformed parameter keyword: %s", field)
+		}
+		if hasValue && !isValidParameterValue(value) {
+			return nil, fmt.Errorf("malformed parameter value: %s", field)
+		}
+		keyword = strings.ToUpper(keyword)
+		if _, found := params[keyword]; found {
+			return nil, fmt.Errorf("duplicate parameter: %s", keyword)
+		}
+		params[keyword] = value
+	}
+	return params, nil
+}
+
+// isValidParameterKeyword checks esmtp-keyword = (ALPHA / DIGIT) *(ALPHA / DIGIT / "-")
+func isValidParameterKeyword(keyword string) bool {
+	if keyword == "" || keyword[0] == '-' {
+		return false
+	}
+	for i := 0; i < len(keyword); i++ {
+		c := keyword[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+		case c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9':
+		case c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isValidParameterValue checks esmtp-value = 1*(%d33-60 / %d62-126 / UTF8-non-ascii),
+// UTF-8 symbols are allowed by RFC 6531
+func isValidParameterValue(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r == '=' || r < 33 || r == 127 {
+			return false
+		}
+	}
+	return true
+}
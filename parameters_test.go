@@ -0,0 +1,37 @@
+package msmtpd
+
+import "testing"
+
+func TestParseParameters(t *testing.T) {
+	params, err := parseParameters([]string{"size=1024", "BODY=8BITMIME", "SMTPUTF8", "ORCPT=rfc822;пётр@почта.рф"})
+	if err != nil {
+		t.Errorf("%s : while parsing valid parameters", err)
+		return
+	}
+	if params.Get("SIZE") != "1024" {
+		t.Errorf("wrong SIZE %s", params.Get("SIZE"))
+	}
+	if !params.Has("smtputf8") {
+		t.Errorf("SMTPUTF8 is missing")
+	}
+	if params.Has("RET") {
+		t.Errorf("RET is present")
+	}
+	if params.String() != "BODY=8BITMIME ORCPT=rfc822;пётр@почта.рф SIZE=1024 SMTPUTF8" {
+		t.Errorf("wrong string representation %s", params.String())
+	}
+	malformed := [][]string{
+		{"=1024"},
+		{"-SIZE=1024"},
+		{"SI_ZE=1024"},
+		{"SIZE="},
+		{"SIZE=10=24"},
+		{"SIZE=1", "size=2"},
+	}
+	for i := range malformed {
+		_, err = parseParameters(malformed[i])
+		if err == nil {
+			t.Errorf("error not thrown for %v", malformed[i])
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package msmtpd
+
+import (
+	"crypto/tls"
+	"net"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Local clients, like web applications or sendmail compatible tools, can submit mail via unix domain socket,
+// so there is no need to expose TCP port for them. Such clients have no IP address, so Transaction.RemoteIP
+// returns nil for them, and kernel reports credentials of process connected (SO_PEERCRED on Linux),
+// so they can be used to authorize local clients.
+
+// PeerCredentials are credentials of local process connected via unix domain socket
+type PeerCredentials struct {
+	// PID is process id of client
+	PID int32
+	// UID is user id of client process
+	UID uint32
+	// GID is group id of client process
+	GID uint32
+}
+
+// unwrapConnection returns connection as it was accepted by net.Listener, if it is wrapped
+// by TLS or PROXY protocol ones
+func unwrapConnection(c net.Conn) net.Conn {
+	for {
+		switch wrapped := c.(type) {
+		case *tls.Conn:
+			c = wrapped.NetConn()
+		case *ProxyConn:
+			c = wrapped.Conn
+		default:
+			return c
+		}
+	}
+}
+
+// readPeerCredentials sets Transaction.PeerCredentials, if client is connected via unix domain socket
+func (t *Transaction) readPeerCredentials() {
+	unixConn, ok := unwrapConnection(t.acceptedConn).(*net.UnixConn)
+	if !ok {
+		return
+	}
+	credentials, err := peerCredentials(unixConn)
+	if err != nil {
+		t.LogError(err, "while reading credentials of process connected via unix domain socket")
+		return
+	}
+	t.PeerCredentials = credentials
+	t.LogDebug("Process %v of user %v and group %v is connected via unix domain socket",
+		credentials.PID, credentials.UID, credentials.GID)
+	t.Span.SetAttributes(
+		attribute.Int64("peer.pid", int64(credentials.PID)),
+		attribute.Int64("peer.uid", int64(credentials.UID)),
+		attribute.Int64("peer.gid", int64(credentials.GID)),
+	)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package msmtpd
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// peerCredentials is not implemented, because SO_PEERCRED is Linux specific
+func peerCredentials(_ *net.UnixConn) (*PeerCredentials, error) {
+	return nil, fmt.Errorf("credentials of unix domain socket peers are not supported on %s", runtime.GOOS)
+}
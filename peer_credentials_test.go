@@ -0,0 +1,107 @@
+package msmtpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func TestUnixSocketListener(t *testing.T) {
+	delivered := make(chan *Transaction, 1)
+	received := make(chan string, 1)
+	server := &Server{
+		Logger: &TestLogger{Suite: t},
+		Listeners: []ListenerConfig{
+			{Name: "local", Network: "unix", Address: filepath.Join(t.TempDir(), "smtp.sock")},
+		},
+		// limits per IP address and subnet are not applied to local clients
+		MaxConnectionsPerIP: 1,
+		DataHandlers: []DataHandler{
+			func(_ context.Context, tr *Transaction) error {
+				body, err := io.ReadAll(tr.BodyReader())
+				if err != nil {
+					return err
+				}
+				received <- strings.SplitN(string(body), "\r\n", 2)[0]
+				delivered <- tr
+				return nil
+			},
+		},
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- server.ListenAndServeAll()
+	}()
+	var addr net.Addr
+	for i := 0; i < 50 && addr == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		addr = server.ListenerAddress("local")
+	}
+	if addr == nil {
+		t.Fatalf("listener is not started")
+	}
+	conn, err := net.Dial("unix", addr.String())
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	c, err := smtp.NewClient(conn, "localhost")
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed: %v", err)
+	}
+	if err = c.Rcpt("recipient@example.net"); err != nil {
+		t.Errorf("RCPT failed: %v", err)
+	}
+	wc, err := c.Data()
+	if err != nil {
+		t.Fatalf("DATA failed: %v", err)
+	}
+	if _, err = fmt.Fprint(wc, internal.MakeTestMessage("sender@example.org", "recipient@example.net")); err != nil {
+		t.Errorf("Data body failed: %v", err)
+	}
+	if err = wc.Close(); err != nil {
+		t.Errorf("Data close failed: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	tr := <-delivered
+	if tr.RemoteIP() != nil {
+		t.Errorf("local client has IP address %s", tr.RemoteIP())
+	}
+	header := <-received
+	if runtime.GOOS == "linux" {
+		if tr.PeerCredentials == nil {
+			t.Fatalf("credentials of local client are not read")
+		}
+		if tr.PeerCredentials.PID != int32(os.Getpid()) || tr.PeerCredentials.UID != uint32(os.Getuid()) {
+			t.Errorf("wrong credentials of local client %v", *tr.PeerCredentials)
+		}
+		expected := fmt.Sprintf("Received: from localhost (unix socket, uid %v) by", os.Getuid())
+		if !strings.HasPrefix(header, expected) {
+			t.Errorf("wrong received header %s", header)
+		}
+	}
+	if err = server.Shutdown(true); err != nil {
+		t.Errorf("%s : while shutting down server", err)
+	}
+	if err = <-result; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("wrong error %v instead of ErrServerClosed", err)
+	}
+}
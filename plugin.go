@@ -0,0 +1,111 @@
+package msmtpd
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Checkers and handlers can be set as anonymous functions in Server.ConnectionCheckers and other
+// slices, or they can be registered as named Plugin via Server.Plugins, so logs, traces and
+// metrics of server say which plugin was slow, failed or rejected client. Functions of plugins
+// are called after anonymous ones of the same phase, in order plugins are provided.
+
+// Plugin is named set of checkers, handlers and hooks, any of them can be nil
+type Plugin struct {
+	// Name is used in logs, span names and metrics, so it should be short and unique, like `karma` or `rbl`
+	Name string
+	// Metadata is optional information about plugin, like its version or configuration,
+	// added as attributes to spans of plugin calls
+	Metadata map[string]string
+
+	// ConnectionChecker is called after Server.ConnectionCheckers
+	ConnectionChecker ConnectionChecker
+	// HeloChecker is called after Server.HeloCheckers
+	HeloChecker HelloChecker
+	// SenderChecker is called after Server.SenderCheckers
+	SenderChecker SenderChecker
+	// RecipientChecker is called after Server.RecipientCheckers
+	RecipientChecker RecipientChecker
+	// DataChecker is called after Server.DataCheckers
+	DataChecker DataChecker
+	// DataHandler is called after Server.DataHandlers
+	DataHandler DataHandler
+	// CloseHandler is called after Server.CloseHandlers
+	CloseHandler CloseHandler
+	// StateHook is called after Server.StateHooks
+	StateHook StateHook
+}
+
+// addPlugins appends functions of plugins to checkers and handlers of listener, and remembers
+// which plugin every function belongs to. Slices are clipped before appending, so slices
+// shared with Server or other listeners are not modified
+func (l *listener) addPlugins(plugins []Plugin) error {
+	l.plugins = make(map[Phase][]*Plugin, 0)
+	for i := range plugins {
+		p := &plugins[i]
+		if p.Name == "" {
+			return fmt.Errorf("plugin %v of listener %s has no name", i, l.Name)
+		}
+		if p.ConnectionChecker != nil {
+			l.ConnectionCheckers = append(slices.Clip(l.ConnectionCheckers), p.ConnectionChecker)
+			l.registerPlugin(PhaseConnection, len(l.ConnectionCheckers)-1, p)
+		}
+		if p.HeloChecker != nil {
+			l.HeloCheckers = append(slices.Clip(l.HeloCheckers), p.HeloChecker)
+			l.registerPlugin(PhaseHelo, len(l.HeloCheckers)-1, p)
+		}
+		if p.SenderChecker != nil {
+			l.SenderCheckers = append(slices.Clip(l.SenderCheckers), p.SenderChecker)
+			l.registerPlugin(PhaseSender, len(l.SenderCheckers)-1, p)
+		}
+		if p.RecipientChecker != nil {
+			l.RecipientCheckers = append(slices.Clip(l.RecipientCheckers), p.RecipientChecker)
+			l.registerPlugin(PhaseRecipient, len(l.RecipientCheckers)-1, p)
+		}
+		if p.DataChecker != nil {
+			l.DataCheckers = append(slices.Clip(l.DataCheckers), p.DataChecker)
+			l.registerPlugin(PhaseData, len(l.DataCheckers)-1, p)
+		}
+		if p.DataHandler != nil {
+			l.DataHandlers = append(slices.Clip(l.DataHandlers), p.DataHandler)
+			l.registerPlugin(PhaseDelivery, len(l.DataHandlers)-1, p)
+		}
+		if p.CloseHandler != nil {
+			l.closeHandlers = append(slices.Clip(l.closeHandlers), p.CloseHandler)
+			l.registerPlugin(PhaseClose, len(l.closeHandlers)-1, p)
+		}
+		if p.StateHook != nil {
+			l.stateHooks = append(slices.Clip(l.stateHooks), p.StateHook)
+			l.registerPlugin(PhaseState, len(l.stateHooks)-1, p)
+		}
+	}
+	return nil
+}
+
+// registerPlugin remembers that k-th function of phase belongs to plugin
+func (l *listener) registerPlugin(phase Phase, k int, p *Plugin) {
+	registered := l.plugins[phase]
+	for len(registered) < k {
+		registered = append(registered, nil)
+	}
+	l.plugins[phase] = append(registered, p)
+}
+
+// plugin returns Plugin k-th function of phase belongs to, or nil, if function is anonymous
+func (l *listener) plugin(phase Phase, k int) *Plugin {
+	registered := l.plugins[phase]
+	if k < len(registered) {
+		return registered[k]
+	}
+	return nil
+}
+
+// pluginName returns name of plugin k-th function of phase belongs to, or name like `sender_2`
+// for anonymous functions
+func (l *listener) pluginName(phase Phase, k int) string {
+	p := l.plugin(phase, k)
+	if p != nil {
+		return p.Name
+	}
+	return fmt.Sprintf("%s_%v", phase, k)
+}
@@ -0,0 +1,151 @@
+package msmtpd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Plugins, like checkers, handlers and hooks, are called via Transaction.callPlugin, so panic in
+// any of them does not crash whole server, but is reported to client as ErrPluginFailed reply,
+// and hung plugin does not block session forever, if it respects context provided, because
+// time budgets of Server.CheckerTimeout and Server.PhaseTimeouts are enforced via this context.
+
+// Phase is group of plugins called one by one at the same step of session
+type Phase string
+
+const (
+	// PhaseConnection is phase of ConnectionCheckers
+	PhaseConnection Phase = "connection"
+	// PhaseHelo is phase of HeloCheckers
+	PhaseHelo Phase = "helo"
+	// PhaseSender is phase of SenderCheckers
+	PhaseSender Phase = "sender"
+	// PhaseRecipient is phase of RecipientCheckers
+	PhaseRecipient Phase = "recipient"
+	// PhaseData is phase of DataCheckers
+	PhaseData Phase = "data"
+	// PhaseDelivery is phase of DataHandlers
+	PhaseDelivery Phase = "delivery"
+	// PhaseClose is phase of CloseHandlers
+	PhaseClose Phase = "close"
+	// PhaseState is phase of StateHooks
+	PhaseState Phase = "state"
+)
+
+// ErrPluginFailed is reported to client, when plugin panics
+var ErrPluginFailed = ErrorSMTP{
+	Code:         451,
+	EnhancedCode: "4.3.0",
+	Message:      "Internal server error. Try again later, please.",
+}
+
+// ErrPluginTimeout is reported to client, when plugin exceeds its time budget
+var ErrPluginTimeout = ErrorSMTP{
+	Code:         451,
+	EnhancedCode: "4.4.3",
+	Message:      "Checks took too long. Try again later, please.",
+}
+
+// phaseContext returns context limited by Server.PhaseTimeouts for phase provided
+func (t *Transaction) phaseContext(ctx context.Context, phase Phase) (context.Context, context.CancelFunc) {
+	timeout := t.server.PhaseTimeouts[phase]
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// runPhase calls count plugins of phase one by one via Transaction.callPlugin within phase time budget,
+// until any of them returns error
+func (t *Transaction) runPhase(ctx context.Context, phase Phase, count int,
+	call func(ctx context.Context, k int) error) error {
+	phaseCtx, cancel := t.phaseContext(ctx, phase)
+	defer cancel()
+	for k := 0; k < count; k++ {
+		err := t.callPlugin(phaseCtx, phase, k, func(pluginCtx context.Context) error {
+			return call(pluginCtx, k)
+		})
+		if err != nil {
+			t.LogInfo("%s : rejected by %s plugin %s", err, phase, t.listener.pluginName(phase, k))
+			return err
+		}
+	}
+	return nil
+}
+
+// callPlugin calls k-th plugin of phase within its own span and with context limited by Server.CheckerTimeout.
+// Panic of plugin is recovered and ErrPluginFailed is returned, and ErrPluginTimeout is returned, if plugin
+// failed after its time budget is exceeded, or phase time budget is exceeded before plugin is called.
+// Result and latency of call are recorded into PluginMetrics
+func (t *Transaction) callPlugin(ctx context.Context, phase Phase, k int,
+	call func(ctx context.Context) error) (err error) {
+	name := t.listener.pluginName(phase, k)
+	ctx = context.WithValue(ctx, pluginCallKey{}, pluginCall{phase: phase, name: name})
+	ctx, span := t.server.Tracer.Start(ctx, "plugin_"+name,
+		trace.WithSpanKind(trace.SpanKindInternal), // важно
+	)
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("plugin.name", name),
+		attribute.String("plugin.phase", string(phase)),
+	)
+	p := t.listener.plugin(phase, k)
+	if p != nil {
+		for key, value := range p.Metadata {
+			span.SetAttributes(attribute.String("plugin."+key, value))
+		}
+	}
+	started := time.Now()
+	defer func() {
+		result := pluginResult(err)
+		span.SetAttributes(attribute.String("plugin.result", string(result)))
+		if result == PluginFailed && err != ErrPluginFailed && err != ErrPluginTimeout {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "plugin failed")
+		}
+		t.server.observePlugin(phase, name, time.Since(started), result)
+	}()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return t.pluginTimedOut(ctx, phase, name)
+	}
+	if t.server.CheckerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.server.CheckerTimeout)
+		defer cancel()
+	}
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		atomic.AddUint64(&t.server.pluginPanics, 1)
+		panicErr := fmt.Errorf("panic in %s plugin %s: %v", phase, name, recovered)
+		span.RecordError(panicErr)
+		span.SetStatus(codes.Error, "plugin panicked")
+		t.LogError(panicErr, string(debug.Stack()))
+		err = ErrPluginFailed
+	}()
+	err = call(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return t.pluginTimedOut(ctx, phase, name)
+	}
+	return err
+}
+
+// pluginTimedOut reports plugin exceeding its time budget
+func (t *Transaction) pluginTimedOut(ctx context.Context, phase Phase, name string) error {
+	atomic.AddUint64(&t.server.pluginTimeouts, 1)
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(ctx.Err())
+	span.SetStatus(codes.Error, "plugin timed out")
+	t.LogWarn("%s plugin %s exceeded its time budget", phase, name)
+	return ErrPluginTimeout
+}
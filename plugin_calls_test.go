@@ -0,0 +1,154 @@
+package msmtpd
+
+import (
+	"context"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func TestPluginPanic(t *testing.T) {
+	closed := make(chan bool, 1)
+	server := &Server{
+		HeloCheckers: []HelloChecker{
+			func(_ context.Context, tr *Transaction) error {
+				if tr.HeloName == "panic" {
+					panic("helo checker is broken")
+				}
+				return nil
+			},
+		},
+		CloseHandlers: []CloseHandler{
+			func(_ context.Context, _ *Transaction) error {
+				panic("close handler is broken")
+			},
+			func(_ context.Context, _ *Transaction) error {
+				closed <- true
+				return nil
+			},
+		},
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 451, "EHLO panic"); err != nil {
+		t.Errorf("EHLO is accepted after checker panicked: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	<-closed
+	waitForTransactionsClosed(server)
+	// server is still serving clients
+	c, err = smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	<-closed
+	waitForTransactionsClosed(server)
+	panics, timeouts := server.GetPluginFailuresCount()
+	if panics != 3 || timeouts != 0 {
+		t.Errorf("wrong number of plugin failures: %v panics and %v timeouts", panics, timeouts)
+	}
+}
+
+func TestPluginTimeouts(t *testing.T) {
+	slowChecker := func(ctx context.Context, _ *Transaction) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+			return nil
+		}
+	}
+	testCases := []struct {
+		name   string
+		server *Server
+	}{
+		{"checker", &Server{
+			CheckerTimeout: 20 * time.Millisecond,
+			SenderCheckers: []SenderChecker{slowChecker},
+		}},
+		{"phase", &Server{
+			PhaseTimeouts:  map[Phase]time.Duration{PhaseSender: 70 * time.Millisecond},
+			SenderCheckers: []SenderChecker{slowChecker, slowChecker},
+		}},
+	}
+	for i := range testCases {
+		t.Run(testCases[i].name, func(t *testing.T) {
+			server := testCases[i].server
+			addr, closer := RunTestServerWithoutTLS(t, server)
+			defer closer()
+			c, err := smtp.Dial(addr)
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			if err = c.Hello("localhost"); err != nil {
+				t.Errorf("HELO failed: %v", err)
+			}
+			err = c.Mail("sender@example.org")
+			if err == nil {
+				t.Errorf("MAIL is accepted after checker timed out")
+			} else if err.Error() != ErrPluginTimeout.Error() {
+				t.Errorf("wrong error for timed out checker: %s", err)
+			}
+			if err = c.Quit(); err != nil {
+				t.Errorf("Quit failed: %v", err)
+			}
+			waitForTransactionsClosed(server)
+			panics, timeouts := server.GetPluginFailuresCount()
+			if panics != 0 || timeouts != 1 {
+				t.Errorf("wrong number of plugin failures: %v panics and %v timeouts", panics, timeouts)
+			}
+		})
+	}
+}
+
+func TestSessionPanic(t *testing.T) {
+	server := &Server{}
+	err := server.RegisterCommand("XPANIC", func(_ context.Context, _ *Transaction, _ Command) {
+		panic("custom command is broken")
+	}, "")
+	if err != nil {
+		t.Fatalf("%s : while registering command", err)
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 451, "XPANIC"); err != nil {
+		t.Errorf("wrong reply for panicked command handler: %v", err)
+	}
+	waitForTransactionsClosed(server)
+	// server is still serving clients
+	c, err = smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+	if panics, _ := server.GetPluginFailuresCount(); panics != 1 {
+		t.Errorf("wrong number of panics %v", panics)
+	}
+}
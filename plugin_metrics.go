@@ -0,0 +1,125 @@
+package msmtpd
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// PluginLatencyBuckets are upper bounds of latency histogram buckets of plugin calls
+var PluginLatencyBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// PluginResult is outcome of plugin call
+type PluginResult string
+
+const (
+	// PluginPassed means plugin returned no error
+	PluginPassed PluginResult = "pass"
+	// PluginRejected means plugin returned ErrorSMTP, so client request was rejected
+	PluginRejected PluginResult = "reject"
+	// PluginFailed means plugin panicked, exceeded its time budget or returned error, which is not ErrorSMTP
+	PluginFailed PluginResult = "error"
+)
+
+// pluginResult returns outcome of plugin call by error it returned
+func pluginResult(err error) PluginResult {
+	if err == nil {
+		return PluginPassed
+	}
+	var smtpErr ErrorSMTP
+	if errors.As(err, &smtpErr) && smtpErr != ErrPluginFailed && smtpErr != ErrPluginTimeout {
+		return PluginRejected
+	}
+	return PluginFailed
+}
+
+// PluginMetrics are results and latency histogram of calls of plugin in single Phase
+type PluginMetrics struct {
+	// Phase is phase plugin is called in
+	Phase Phase
+	// Name is name of Plugin, or name like `sender_2` for anonymous checkers and handlers
+	Name string
+	// Passed is number of calls plugin returned no error
+	Passed uint64
+	// Rejected is number of calls plugin returned ErrorSMTP
+	Rejected uint64
+	// Failed is number of calls plugin panicked, timed out or returned error, which is not ErrorSMTP
+	Failed uint64
+	// Buckets are numbers of calls, which took not longer than PluginLatencyBuckets with the same index
+	Buckets []uint64
+	// Count is total number of calls
+	Count uint64
+	// Sum is total time spent in calls
+	Sum time.Duration
+}
+
+// pluginMetricsKey identifies PluginMetrics
+type pluginMetricsKey struct {
+	phase Phase
+	name  string
+}
+
+// observePlugin updates PluginMetrics of plugin
+func (srv *Server) observePlugin(phase Phase, name string, took time.Duration, result PluginResult) {
+	srv.pluginMetricsMu.Lock()
+	defer srv.pluginMetricsMu.Unlock()
+	if srv.pluginMetrics == nil {
+		srv.pluginMetrics = make(map[pluginMetricsKey]*PluginMetrics, 0)
+	}
+	key := pluginMetricsKey{phase: phase, name: name}
+	metrics, found := srv.pluginMetrics[key]
+	if !found {
+		metrics = &PluginMetrics{
+			Phase:   phase,
+			Name:    name,
+			Buckets: make([]uint64, len(PluginLatencyBuckets)),
+		}
+		srv.pluginMetrics[key] = metrics
+	}
+	switch result {
+	case PluginPassed:
+		metrics.Passed++
+	case PluginRejected:
+		metrics.Rejected++
+	default:
+		metrics.Failed++
+	}
+	for i := range PluginLatencyBuckets {
+		if took <= PluginLatencyBuckets[i] {
+			metrics.Buckets[i]++
+		}
+	}
+	metrics.Count++
+	metrics.Sum += took
+}
+
+// GetPluginMetrics returns copy of metrics of every plugin called, sorted by phase and name
+func (srv *Server) GetPluginMetrics() []PluginMetrics {
+	srv.pluginMetricsMu.Lock()
+	defer srv.pluginMetricsMu.Unlock()
+	ret := make([]PluginMetrics, 0, len(srv.pluginMetrics))
+	for _, metrics := range srv.pluginMetrics {
+		cp := *metrics
+		cp.Buckets = append([]uint64{}, metrics.Buckets...)
+		ret = append(ret, cp)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Phase != ret[j].Phase {
+			return ret[i].Phase < ret[j].Phase
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
@@ -0,0 +1,100 @@
+package msmtpd
+
+import (
+	"context"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+func TestNamedPlugins(t *testing.T) {
+	closed := make(chan bool, 1)
+	heloCheckers := make([]HelloChecker, 1, 2)
+	heloCheckers[0] = func(_ context.Context, _ *Transaction) error {
+		return nil
+	}
+	server := &Server{
+		HeloCheckers: heloCheckers,
+		Plugins: []Plugin{
+			{
+				Name:     "blocker",
+				Metadata: map[string]string{"version": "1.0.0"},
+				SenderChecker: func(_ context.Context, tr *Transaction) error {
+					if strings.HasPrefix(tr.MailFrom.Address, "spammer@") {
+						return ErrorSMTP{Code: 550, Message: "Go away!"}
+					}
+					return nil
+				},
+			},
+			{
+				Name: "counter",
+				HeloChecker: func(_ context.Context, _ *Transaction) error {
+					return nil
+				},
+				CloseHandler: func(_ context.Context, _ *Transaction) error {
+					closed <- true
+					return nil
+				},
+			},
+		},
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	if len(server.HeloCheckers) != 1 || cap(server.HeloCheckers) != 2 {
+		t.Errorf("HeloCheckers of server are modified")
+	}
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = c.Mail("spammer@example.org"); err == nil {
+		t.Errorf("MAIL is accepted from spammer")
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	<-closed
+	waitForTransactionsClosed(server)
+	results := make(map[string][3]uint64, 0)
+	for _, metrics := range server.GetPluginMetrics() {
+		results[string(metrics.Phase)+"/"+metrics.Name] = [3]uint64{metrics.Passed, metrics.Rejected, metrics.Failed}
+		if metrics.Count != metrics.Passed+metrics.Rejected+metrics.Failed {
+			t.Errorf("wrong number of calls of %s plugin %s", metrics.Phase, metrics.Name)
+		}
+		if metrics.Buckets[len(metrics.Buckets)-1] != metrics.Count {
+			t.Errorf("wrong latency histogram of %s plugin %s", metrics.Phase, metrics.Name)
+		}
+	}
+	expected := map[string][3]uint64{
+		"helo/helo_0":    {1, 0, 0},
+		"helo/counter":   {1, 0, 0},
+		"sender/blocker": {1, 1, 0},
+		"close/counter":  {1, 0, 0},
+	}
+	if len(results) != len(expected) {
+		t.Errorf("wrong plugin metrics %v", results)
+	}
+	for name := range expected {
+		if results[name] != expected[name] {
+			t.Errorf("wrong results %v of plugin %s instead of %v", results[name], name, expected[name])
+		}
+	}
+}
+
+func TestPluginRequiresName(t *testing.T) {
+	server := &Server{
+		Plugins: []Plugin{{HeloChecker: func(_ context.Context, _ *Transaction) error {
+			return nil
+		}}},
+	}
+	_, err := server.resolveListener(ListenerConfig{})
+	if err == nil {
+		t.Errorf("plugin without name is accepted")
+	}
+}
@@ -16,7 +16,7 @@ func TestWhitelistFail(t *testing.T) {
 	defer closer()
 	_, err := smtp.Dial(addr)
 	if err != nil {
-		if err.Error() != "521 FUCK OFF!" {
+		if err.Error() != "521 5.7.1 FUCK OFF!" {
 			t.Errorf("Dial failed with wrong error: %s", err)
 		}
 		return
@@ -109,7 +109,7 @@ func TestBlacklistFail(t *testing.T) {
 	defer closer()
 	_, err := smtp.Dial(addr)
 	if err != nil {
-		if err.Error() != "521 FUCK OFF!" {
+		if err.Error() != "521 5.7.1 FUCK OFF!" {
 			t.Errorf("Dial failed with wrong error: %s", err)
 		}
 		return
@@ -126,7 +126,7 @@ func TestBlacklistFailSubnet1(t *testing.T) {
 	defer closer()
 	_, err := smtp.Dial(addr)
 	if err != nil {
-		if err.Error() != "521 FUCK OFF!" {
+		if err.Error() != "521 5.7.1 FUCK OFF!" {
 			t.Errorf("Dial failed with wrong error: %s", err)
 		}
 		return
@@ -143,7 +143,7 @@ func TestBlacklistFailSubnet2(t *testing.T) {
 	defer closer()
 	_, err := smtp.Dial(addr)
 	if err != nil {
-		if err.Error() != "521 FUCK OFF!" {
+		if err.Error() != "521 5.7.1 FUCK OFF!" {
 			t.Errorf("Dial failed with wrong error: %s", err)
 		}
 		return
@@ -160,7 +160,7 @@ func TestBlacklistFailSubnet3(t *testing.T) {
 	defer closer()
 	_, err := smtp.Dial(addr)
 	if err != nil {
-		if err.Error() != "521 FUCK OFF!" {
+		if err.Error() != "521 5.7.1 FUCK OFF!" {
 			t.Errorf("Dial failed with wrong error: %s", err)
 		}
 		return
@@ -177,7 +177,7 @@ func TestBlacklistFailSubnet4(t *testing.T) {
 	defer closer()
 	_, err := smtp.Dial(addr)
 	if err != nil {
-		if err.Error() != "521 FUCK OFF!" {
+		if err.Error() != "521 5.7.1 FUCK OFF!" {
 			t.Errorf("Dial failed with wrong error: %s", err)
 		}
 		return
@@ -3,7 +3,6 @@ package connection
 import (
 	"context"
 	"fmt"
-	"net"
 	"strings"
 	"sync/atomic"
 
@@ -17,7 +16,11 @@ import (
 func CheckByReverseIPBlacklists(tolerance uint32, lists []string) msmtpd.ConnectionChecker {
 	return func(ctx context.Context, tr *msmtpd.Transaction) error {
 		var listed uint32
-		ip := tr.Addr.(*net.TCPAddr).IP
+		ip := tr.RemoteIP()
+		if ip == nil {
+			tr.LogDebug("Local client connected via %s is not checked by reverse IP blacklists", tr.Addr.Network())
+			return nil
+		}
 		reversed, err := reverse(ip)
 		if err != nil {
 			tr.LogError(err, fmt.Sprintf("while reversing transaction address %s", tr.Addr.String()))
@@ -29,8 +29,9 @@ func DenyPTRs(listOfPtrSuffixes []string) msmtpd.ConnectionChecker {
 		}
 		if bad {
 			return msmtpd.ErrorSMTP{
-				Code:    521,
-				Message: "Your IP address is blacklisted. Sorry. You can cry me a river.", // lol
+				Code:         521,
+				EnhancedCode: "5.7.1",
+				Message:      "Your IP address is blacklisted. Sorry. You can cry me a river.", // lol
 			}
 		}
 		tr.LogInfo("PTRs %v looks ok", tr.PTRs)
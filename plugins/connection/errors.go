@@ -3,6 +3,7 @@ package connection
 import "github.com/vodolaz095/msmtpd"
 
 var friendlyError = msmtpd.ErrorSMTP{
-	Code:    521,
-	Message: "FUCK OFF!", // lol
+	Code:         521,
+	EnhancedCode: "5.7.1",
+	Message:      "FUCK OFF!", // lol
 }
@@ -40,7 +40,12 @@ func RequireSenderScore(minimalSenderScore uint) msmtpd.ConnectionChecker {
 	}
 
 	return func(ctx context.Context, tr *msmtpd.Transaction) error {
-		reversed, err := reverse(tr.Addr.(*net.TCPAddr).IP)
+		ip := tr.RemoteIP()
+		if ip == nil {
+			tr.LogDebug("Local client connected via %s has no senderscore", tr.Addr.Network())
+			return nil
+		}
+		reversed, err := reverse(ip)
 		if err != nil {
 			tr.LogError(err, fmt.Sprintf("while reversing transaction address %s", tr.Addr.String()))
 			return msmtpd.ErrServiceNotAvailable
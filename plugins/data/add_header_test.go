@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/smtp"
 	"testing"
 
@@ -18,9 +19,13 @@ func TestAddHeader(t *testing.T) {
 		},
 		DataHandlers: []msmtpd.DataHandler{
 			func(_ context.Context, tr *msmtpd.Transaction) error {
-				t.Logf("Body:\n--------------\n%s\n-----------\n", string(tr.Body))
+				body, err := io.ReadAll(tr.BodyReader())
+				if err != nil {
+					t.Errorf("%s : while reading message body", err)
+				}
+				t.Logf("Body:\n--------------\n%s\n-----------\n", string(body))
 
-				if !bytes.Contains(tr.Body, []byte("Something: interesting")) {
+				if !bytes.Contains(body, []byte("Something: interesting")) {
 					t.Errorf("extra header not present in body")
 				}
 				val, found := tr.Parsed.Header["Something"]
@@ -40,8 +40,9 @@ func CheckHeaders(headersRequired []string) msmtpd.DataChecker {
 			if val == "" {
 				transaction.LogWarn("required header %s is missing", header)
 				return msmtpd.ErrorSMTP{
-					Code:    521,
-					Message: complain,
+					Code:         521,
+					EnhancedCode: "5.6.0",
+					Message:      complain,
 				}
 			}
 			transaction.LogDebug("Header %s is %s", header, val)
@@ -51,23 +52,26 @@ func CheckHeaders(headersRequired []string) msmtpd.DataChecker {
 			transaction.LogWarn("%s : while parsing malformed date header with value %s",
 				err, transaction.Parsed.Header.Get("Date"))
 			return msmtpd.ErrorSMTP{
-				Code:    521,
-				Message: complain,
+				Code:         521,
+				EnhancedCode: "5.6.0",
+				Message:      complain,
 			}
 		}
 		transaction.LogInfo("Message was generated on %s", timestamp.Format(time.ANSIC))
 		if time.Since(timestamp) > tooOld {
 			transaction.LogWarn("Message is too old: %s", time.Since(timestamp).String())
 			return msmtpd.ErrorSMTP{
-				Code:    521,
-				Message: complain,
+				Code:         521,
+				EnhancedCode: "5.6.0",
+				Message:      complain,
 			}
 		}
 		if time.Now().Add(tooFarInFuture).Before(timestamp) {
 			transaction.LogWarn("Message is too far away in future")
 			return msmtpd.ErrorSMTP{
-				Code:    521,
-				Message: complain,
+				Code:         521,
+				EnhancedCode: "5.6.0",
+				Message:      complain,
 			}
 		}
 		transaction.LogInfo("Headers are in place!")
@@ -83,7 +83,7 @@ func TestBodyParseAndCheckHeadersMalformed(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() == "521 Stop sending me this nonsense, please!" {
+		if err.Error() == "521 5.6.0 Stop sending me this nonsense, please!" {
 			t.Logf("proper error is thrown")
 			return
 		}
@@ -131,7 +131,7 @@ func TestBodyParseAndCheckHeadersMissingMandatoryHeaderFrom(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() == "521 Stop sending me this nonsense, please!" {
+		if err.Error() == "521 5.6.0 Stop sending me this nonsense, please!" {
 			t.Logf("proper error is thrown")
 			return
 		}
@@ -180,7 +180,7 @@ func TestBodyParseAndCheckHeadersMissingMandatoryHeaderDate(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() == "521 Stop sending me this nonsense, please!" {
+		if err.Error() == "521 5.6.0 Stop sending me this nonsense, please!" {
 			t.Logf("proper error is thrown")
 			return
 		}
@@ -228,7 +228,7 @@ func TestBodyParseAndCheckHeadersMissingRequiredSubject(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() == "521 I cannot parse your message. Do not send me this particular message in future, please, i will never accept it. Thanks in advance!" {
+		if err.Error() == "521 5.6.0 I cannot parse your message. Do not send me this particular message in future, please, i will never accept it. Thanks in advance!" {
 			t.Logf("proper error is thrown")
 			return
 		}
@@ -277,7 +277,7 @@ func TestBodyParseAndCheckHeadersDuplicate(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() == "521 Stop sending me this nonsense, please!" {
+		if err.Error() == "521 5.6.0 Stop sending me this nonsense, please!" {
 			t.Logf("proper error is thrown")
 			return
 		}
@@ -325,7 +325,7 @@ func TestBodyParseAndCheckHeadersDateTooOld(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() == "521 I cannot parse your message. Do not send me this particular message in future, please, i will never accept it. Thanks in advance!" {
+		if err.Error() == "521 5.6.0 I cannot parse your message. Do not send me this particular message in future, please, i will never accept it. Thanks in advance!" {
 			t.Logf("proper error is thrown")
 			return
 		}
@@ -373,7 +373,7 @@ func TestBodyParseAndCheckHeadersDateToFarInFuture(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() == "521 I cannot parse your message. Do not send me this particular message in future, please, i will never accept it. Thanks in advance!" {
+		if err.Error() == "521 5.6.0 I cannot parse your message. Do not send me this particular message in future, please, i will never accept it. Thanks in advance!" {
 			t.Logf("proper error is thrown")
 			return
 		}
@@ -421,7 +421,7 @@ func TestBodyParseAndCheckHeadersDateMalformed(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() == "521 Stop sending me this nonsense, please!" {
+		if err.Error() == "521 5.6.0 Stop sending me this nonsense, please!" {
 			t.Logf("proper error is thrown")
 			return
 		}
@@ -0,0 +1,56 @@
+package deliver
+
+import (
+	"strings"
+
+	"github.com/vodolaz095/msmtpd"
+)
+
+// Good read - https://www.rfc-editor.org/rfc/rfc3461#section-6.2
+// When next hop advertises DSN, RET and ENVID parameters of `MAIL FROM:`,
+// and NOTIFY and ORCPT parameters of `RCPT TO:` are relayed as client provided them
+
+// supportsDSN checks if DSN extension is present in EHLO/LHLO response lines
+func supportsDSN(features []string) bool {
+	for i := range features {
+		if strings.ToUpper(strings.TrimSpace(features[i])) == "DSN" {
+			return true
+		}
+	}
+	return false
+}
+
+// mailFromDSNParameters returns RET and ENVID parameters to be appended to `MAIL FROM:` command
+func mailFromDSNParameters(tr *msmtpd.Transaction) string {
+	var params string
+	if tr.MailFromParameters.Has("RET") {
+		params += " RET=" + tr.MailFromParameters.Get("RET")
+	}
+	if tr.MailFromParameters.Has("ENVID") {
+		params += " ENVID=" + tr.MailFromParameters.Get("ENVID")
+	}
+	return params
+}
+
+// rcptToDSNParameters returns NOTIFY and ORCPT parameters to be appended to `RCPT TO:` command for recipient
+func rcptToDSNParameters(tr *msmtpd.Transaction, recipient string) string {
+	var params string
+	recipientParams := tr.RcptToParameters[recipient]
+	if recipientParams.Has("NOTIFY") {
+		params += " NOTIFY=" + recipientParams.Get("NOTIFY")
+	}
+	if recipientParams.Has("ORCPT") {
+		params += " ORCPT=" + recipientParams.Get("ORCPT")
+	}
+	return params
+}
+
+// aliasDSNParameters returns NOTIFY and ORCPT parameters of original recipient alias expands to be appended
+// to `RCPT TO:` command for alias. Original recipient is the one alias is added for via Transaction.AddAlias,
+// alias appended to Transaction.Aliases directly has parameters only if it is original recipient itself
+func aliasDSNParameters(tr *msmtpd.Transaction, alias string) string {
+	if recipient, found := tr.AliasOf(alias); found {
+		return rcptToDSNParameters(tr, recipient)
+	}
+	return rcptToDSNParameters(tr, alias)
+}
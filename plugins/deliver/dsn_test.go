@@ -0,0 +1,138 @@
+package deliver
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vodolaz095/msmtpd"
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func TestViaSMTPProxyRelaysDSN(t *testing.T) {
+	// expected are NOTIFY and ORCPT parameters backend receives for recipients
+	defaults := map[string]string{
+		"recipient@example.net": "SUCCESS,FAILURE rfc822;recipient@example.net",
+		"other@example.net":     "NEVER rfc822;other@example.net",
+	}
+	testCases := []struct {
+		name     string
+		aliases  func(tr *msmtpd.Transaction)
+		expected map[string]string
+	}{
+		{"recipients", func(_ *msmtpd.Transaction) {}, defaults},
+		{"original recipients as aliases", func(tr *msmtpd.Transaction) {
+			tr.Aliases = append(tr.Aliases, tr.RcptTo...)
+		}, defaults},
+		{"expanded aliases", func(tr *msmtpd.Transaction) {
+			tr.AddAlias(mail.Address{Address: "mailbox@example.net"}, "recipient@example.net")
+			tr.AddAlias(mail.Address{Address: "box@example.net"}, "other@example.net")
+			tr.Aliases = append(tr.Aliases, mail.Address{Address: "hidden@example.net"})
+		}, map[string]string{
+			"mailbox@example.net": "SUCCESS,FAILURE rfc822;recipient@example.net",
+			"box@example.net":     "NEVER rfc822;other@example.net",
+			"hidden@example.net":  " ;",
+		}},
+	}
+	for i := range testCases {
+		t.Run(testCases[i].name, func(t *testing.T) {
+			var delivered bool
+			backend := &msmtpd.Server{
+				SenderCheckers: []msmtpd.SenderChecker{
+					func(_ context.Context, tr *msmtpd.Transaction) error {
+						if tr.DSNReturn() != msmtpd.DSNReturnHeaders {
+							t.Errorf("wrong RET %s", tr.DSNReturn())
+						}
+						if tr.DSNEnvelopeID() != "QQ+314159" {
+							t.Errorf("wrong ENVID %s", tr.DSNEnvelopeID())
+						}
+						return nil
+					},
+				},
+				RecipientCheckers: []msmtpd.RecipientChecker{
+					func(_ context.Context, tr *msmtpd.Transaction, recipient *mail.Address) error {
+						addrType, original := tr.DSNOriginalRecipient(recipient.Address)
+						params := strings.Join(tr.DSNNotify(recipient.Address), ",") + " " + addrType + ";" + original
+						expected, found := testCases[i].expected[recipient.Address]
+						if !found {
+							t.Errorf("unexpected recipient %s", recipient.Address)
+						} else if params != expected {
+							t.Errorf("wrong NOTIFY and ORCPT `%s` for %s", params, recipient.Address)
+						}
+						return nil
+					},
+				},
+				DataHandlers: []msmtpd.DataHandler{
+					func(_ context.Context, tr *msmtpd.Transaction) error {
+						delivered = true
+						return nil
+					},
+				},
+			}
+			backendAddr, backendCloser := msmtpd.RunTestServerWithoutTLS(t, backend)
+			defer backendCloser()
+
+			server := &msmtpd.Server{
+				DataCheckers: []msmtpd.DataChecker{
+					func(_ context.Context, tr *msmtpd.Transaction) error {
+						testCases[i].aliases(tr)
+						return nil
+					},
+				},
+				DataHandlers: []msmtpd.DataHandler{
+					ViaSMTPProxy(SMTPProxyOptions{
+						Network: "tcp",
+						Address: backendAddr,
+						HELO:    "localhost",
+					}),
+				},
+			}
+			addr, closer := msmtpd.RunTestServerWithoutTLS(t, server)
+			defer closer()
+			c, err := smtp.Dial(addr)
+			if err != nil {
+				t.Errorf("Dial failed: %v", err)
+			}
+			if err = c.Hello("localhost"); err != nil {
+				t.Errorf("HELO failed: %v", err)
+			}
+			if supported, _ := c.Extension("DSN"); !supported {
+				t.Error("DSN not supported")
+			}
+			if err = internal.DoCommand(c.Text, 250, "MAIL FROM:<sender@example.org> RET=HDRS ENVID=QQ+2B314159"); err != nil {
+				t.Errorf("Mail failed: %v", err)
+			}
+			if err = internal.DoCommand(c.Text, 250, "RCPT TO:<recipient@example.net> NOTIFY=SUCCESS,FAILURE ORCPT=rfc822;recipient@example.net"); err != nil {
+				t.Errorf("Rcpt failed: %v", err)
+			}
+			if err = internal.DoCommand(c.Text, 250, "RCPT TO:<other@example.net> NOTIFY=NEVER ORCPT=rfc822;other@example.net"); err != nil {
+				t.Errorf("Rcpt failed: %v", err)
+			}
+			wc, err := c.Data()
+			if err != nil {
+				t.Errorf("Data failed: %v", err)
+			}
+			_, err = fmt.Fprint(wc, internal.MakeTestMessage("sender@example.org", "recipient@example.net"))
+			if err != nil {
+				t.Errorf("Data body failed: %v", err)
+			}
+			err = wc.Close()
+			if err != nil {
+				t.Errorf("Data close failed: %v", err)
+			}
+			if err = c.Quit(); err != nil {
+				t.Errorf("Quit failed: %v", err)
+			}
+			for j := 0; j < 50 && (server.GetActiveTransactionsCount() > 0 || backend.GetActiveTransactionsCount() > 0); j++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if !delivered {
+				t.Errorf("message is not delivered to backend")
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package deliver
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"net/textproto"
 	"strings"
@@ -98,9 +99,15 @@ func ViaLocalMailTransferProtocol(opts LMTPOptions) msmtpd.DataHandler {
 			return TemporaryError
 		}
 		tr.LogDebug("Response for LHLO: %v %s", code, features)
+		var mailFromParams string
+		dsn := supportsDSN(strings.Split(features, "\n"))
+		if dsn {
+			tr.LogDebug("LMTP server supports DSN, notification parameters will be relayed")
+			mailFromParams = mailFromDSNParameters(tr)
+		}
 
-		tr.LogDebug("Sending MAIL FROM:<%s>", tr.MailFrom.Address)
-		err = write(pr, fmt.Sprintf("MAIL FROM:<%s>\r\n", tr.MailFrom.Address))
+		tr.LogDebug("Sending MAIL FROM:<%s>%s", tr.MailFrom.Address, mailFromParams)
+		err = write(pr, fmt.Sprintf("MAIL FROM:<%s>%s\r\n", tr.MailFrom.Address, mailFromParams))
 		if err != nil {
 			tr.LogError(err, "while sending MAIL FROM")
 			return TemporaryError
@@ -113,8 +120,12 @@ func ViaLocalMailTransferProtocol(opts LMTPOptions) msmtpd.DataHandler {
 		var atLeastOneRecipientFound bool
 		if len(tr.Aliases) == 0 {
 			for i := range tr.RcptTo {
-				tr.LogDebug("Sending RCPT TO:<%s>", tr.RcptTo[i].Address)
-				err = write(pr, fmt.Sprintf("RCPT TO:<%s>\r\n", tr.RcptTo[i].Address))
+				var rcptToParams string
+				if dsn {
+					rcptToParams = rcptToDSNParameters(tr, tr.RcptTo[i].Address)
+				}
+				tr.LogDebug("Sending RCPT TO:<%s>%s", tr.RcptTo[i].Address, rcptToParams)
+				err = write(pr, fmt.Sprintf("RCPT TO:<%s>%s\r\n", tr.RcptTo[i].Address, rcptToParams))
 				if err != nil {
 					tr.LogError(err, "while sending RCPT TO")
 					return TemporaryError
@@ -129,8 +140,12 @@ func ViaLocalMailTransferProtocol(opts LMTPOptions) msmtpd.DataHandler {
 			}
 		} else {
 			for i := range tr.Aliases {
-				tr.LogDebug("Sending RCPT TO:<%s>", tr.Aliases[i].Address)
-				err = write(pr, fmt.Sprintf("RCPT TO:<%s>\r\n", tr.Aliases[i].Address))
+				var rcptToParams string
+				if dsn {
+					rcptToParams = aliasDSNParameters(tr, tr.Aliases[i].Address)
+				}
+				tr.LogDebug("Sending RCPT TO:<%s>%s", tr.Aliases[i].Address, rcptToParams)
+				err = write(pr, fmt.Sprintf("RCPT TO:<%s>%s\r\n", tr.Aliases[i].Address, rcptToParams))
 				if err != nil {
 					tr.LogError(err, "while sending RCPT TO")
 					return TemporaryError
@@ -160,13 +175,14 @@ func ViaLocalMailTransferProtocol(opts LMTPOptions) msmtpd.DataHandler {
 			return TemporaryError
 		}
 		tr.LogDebug("Streaming message...")
-		n, err := pr.DotWriter().Write(tr.Body)
+		dw := pr.DotWriter()
+		n, err := io.Copy(dw, tr.BodyReader())
 		if err != nil {
 			tr.LogError(err, "while writing message body")
 			return TemporaryError
 		}
 		tr.LogDebug("%v bytes of message is written", n)
-		err = pr.DotWriter().Close()
+		err = dw.Close()
 		if err != nil {
 			tr.LogError(err, "while writing ending dot")
 			return TemporaryError
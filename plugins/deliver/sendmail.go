@@ -1,7 +1,6 @@
 package deliver
 
 import (
-	"bytes"
 	"context"
 	"log"
 	"os/exec"
@@ -59,7 +58,7 @@ func ViaSendmail(opts *SendmailOptions) msmtpd.DataHandler {
 		}
 		cmd := exec.CommandContext(ctx, opts.PathToExecutable, args...)
 		tr.LogDebug("Preparing to execute %s...", cmd.String())
-		cmd.Stdin = bytes.NewBuffer(tr.Body)
+		cmd.Stdin = tr.BodyReader()
 		output, err := cmd.CombinedOutput()
 		if err != nil {
 			tr.LogError(err, "while executing sendmail command")
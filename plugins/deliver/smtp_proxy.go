@@ -3,6 +3,7 @@ package deliver
 import (
 	"context"
 	"crypto/tls"
+	"io"
 	"net"
 	"net/smtp"
 
@@ -23,7 +24,8 @@ type SMTPProxyOptions struct {
 	Auth smtp.Auth
 	// MailFrom defines senders override, if empty, value from Transaction.MailFrom will be used
 	MailFrom string
-	// RcptTo defines recipients' override, if empty, values from Transaction.Aliases or Transaction.RcptTo will be used
+	// RcptTo defines recipients' override, if empty, values from Transaction.Aliases or Transaction.RcptTo will be used.
+	// DSN parameters are not relayed for overridden recipients, since they are not related to original ones
 	RcptTo []string
 }
 
@@ -78,12 +80,16 @@ func ViaSMTPProxy(opts SMTPProxyOptions) msmtpd.DataHandler {
 			tr.LogDebug("Authorization to SMTP backend is passed")
 		}
 
+		dsn, _ := client.Extension("DSN")
+		if dsn {
+			tr.LogDebug("SMTP backend supports DSN, notification parameters will be relayed")
+		}
 		if opts.MailFrom != "" {
 			tr.LogDebug("Sending `MAIL FROM <%s>` like options says", opts.MailFrom)
-			err = client.Mail(opts.MailFrom)
+			err = proxyMail(client, opts.MailFrom, dsn, tr)
 		} else {
 			tr.LogDebug("Sending `MAIL FROM <%s>` from transaction", tr.MailFrom.Address)
-			err = client.Mail(tr.MailFrom.Address)
+			err = proxyMail(client, tr.MailFrom.Address, dsn, tr)
 		}
 		if err != nil {
 			tr.LogError(err, "error making MAILFROM to smtp backend")
@@ -105,7 +111,12 @@ func ViaSMTPProxy(opts SMTPProxyOptions) msmtpd.DataHandler {
 			if tr.Aliases != nil {
 				for i = range tr.Aliases {
 					tr.LogDebug("Sending `RCPT TO <%s>` from aliases...", tr.Aliases[i].Address)
-					err = client.Rcpt(tr.Aliases[i].Address)
+					if dsn {
+						err = proxyCommand(client, 25, "RCPT TO:<%s>%s",
+							tr.Aliases[i].Address, aliasDSNParameters(tr, tr.Aliases[i].Address))
+					} else {
+						err = client.Rcpt(tr.Aliases[i].Address)
+					}
 					if err != nil {
 						tr.LogWarn("%s: original alias %s is not accepted", err, tr.Aliases[i].Address)
 					} else {
@@ -118,7 +129,12 @@ func ViaSMTPProxy(opts SMTPProxyOptions) msmtpd.DataHandler {
 				if tr.RcptTo != nil {
 					for i = range tr.RcptTo {
 						tr.LogDebug("Sending `RCPT TO <%s>` from RCPT TO provided by client...", tr.RcptTo[i].Address)
-						err = client.Rcpt(tr.RcptTo[i].Address)
+						if dsn {
+							err = proxyCommand(client, 25, "RCPT TO:<%s>%s",
+								tr.RcptTo[i].Address, rcptToDSNParameters(tr, tr.RcptTo[i].Address))
+						} else {
+							err = client.Rcpt(tr.RcptTo[i].Address)
+						}
 						if err != nil {
 							tr.LogWarn("%s: original recipient %s is not accepted", err, tr.RcptTo[i].Address)
 						} else {
@@ -139,12 +155,12 @@ func ViaSMTPProxy(opts SMTPProxyOptions) msmtpd.DataHandler {
 			return TemporaryError
 		}
 		tr.LogDebug("DATA started...")
-		i, err = wc.Write(tr.Body)
+		written, err := io.Copy(wc, tr.BodyReader())
 		if err != nil {
 			tr.LogError(err, "error writing body to smtp backend")
 			return TemporaryError
 		}
-		tr.LogDebug("%v bytes of DATA is written, closing...", i)
+		tr.LogDebug("%v bytes of DATA is written, closing...", written)
 		err = wc.Close()
 		if err != nil {
 			tr.LogError(err, "error closing data to smtp backend")
@@ -160,3 +176,31 @@ func ViaSMTPProxy(opts SMTPProxyOptions) msmtpd.DataHandler {
 		return nil
 	}
 }
+
+// proxyMail sends `MAIL FROM:` to SMTP backend. If backend supports DSN, RET and ENVID parameters
+// are added, so we have to send command by ourselves, since smtp.Client.Mail cannot do it
+func proxyMail(client *smtp.Client, from string, dsn bool, tr *msmtpd.Transaction) error {
+	if !dsn {
+		return client.Mail(from)
+	}
+	params := mailFromDSNParameters(tr)
+	if ok, _ := client.Extension("8BITMIME"); ok {
+		params += " BODY=8BITMIME"
+	}
+	if ok, _ := client.Extension("SMTPUTF8"); ok {
+		params += " SMTPUTF8"
+	}
+	return proxyCommand(client, 250, "MAIL FROM:<%s>%s", from, params)
+}
+
+// proxyCommand sends command to SMTP backend and checks response code, like smtp.Client does internally
+func proxyCommand(client *smtp.Client, expectCode int, format string, args ...any) error {
+	id, err := client.Text.Cmd(format, args...)
+	if err != nil {
+		return err
+	}
+	client.Text.StartResponse(id)
+	defer client.Text.EndResponse(id)
+	_, _, err = client.Text.ReadResponse(expectCode)
+	return err
+}
@@ -15,11 +15,13 @@ const DefaultClientSocketPath = "/var/run/dovecot/auth-client"
 const DefaultLMTPSocketPath = "/var/run/dovecot/lmtp"
 
 var temporaryError = msmtpd.ErrorSMTP{
-	Code:    451,
-	Message: "temporary errors, please, try again later",
+	Code:         451,
+	EnhancedCode: "4.3.0",
+	Message:      "temporary errors, please, try again later",
 }
 
 var permanentError = msmtpd.ErrorSMTP{
-	Code:    521,
-	Message: "i have no idea about recipient you want to deliver message to",
+	Code:         521,
+	EnhancedCode: "5.1.1",
+	Message:      "i have no idea about recipient you want to deliver message to",
 }
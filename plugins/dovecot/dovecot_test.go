@@ -7,6 +7,7 @@ import (
 	"net/mail"
 	"net/smtp"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -60,7 +61,7 @@ func TestDovecot_Exists(t *testing.T) {
 		Address: "somebody@example.org",
 	})
 	if err != nil {
-		if err.Error() != "521 i have no idea about recipient you want to deliver message to" {
+		if err.Error() != "521 5.1.1 i have no idea about recipient you want to deliver message to" {
 			t.Errorf("%s : wrong error while checking non existent mailbox", err)
 		}
 	} else {
@@ -114,14 +115,17 @@ func TestDovecot_DeliverRcptTo(t *testing.T) {
 	tr := msmtpd.Transaction{
 		ID:        "dovecot_deliver_rcpt",
 		StartedAt: time.Now(),
-		Body:      []byte(validMessage),
 		MailFrom:  mail.Address{Name: "who cares", Address: rcptTo},
 		RcptTo: []mail.Address{
 			{Name: "who cares", Address: rcptTo},
 			{Name: "somebody", Address: "somebody@example.org"},
 		},
 	}
-	err := dvc.Deliver(context.TODO(), &tr)
+	err := tr.SetBody(strings.NewReader(validMessage))
+	if err != nil {
+		t.Fatalf("%s : while setting message body", err)
+	}
+	err = dvc.Deliver(context.TODO(), &tr)
 	if err != nil {
 		t.Errorf("%s : while delivering test message", err)
 	}
@@ -141,14 +145,17 @@ func TestDovecot_DeliverAliases(t *testing.T) {
 	tr := msmtpd.Transaction{
 		ID:        "dovecot_deliver_alias",
 		StartedAt: time.Now(),
-		Body:      []byte(validMessage),
 		MailFrom:  mail.Address{Name: "who cares", Address: rcptTo},
 		Aliases: []mail.Address{
 			{Name: "who cares", Address: rcptTo},
 			{Name: "somebody", Address: "somebody@example.org"},
 		},
 	}
-	err := dvc.Deliver(context.TODO(), &tr)
+	err := tr.SetBody(strings.NewReader(validMessage))
+	if err != nil {
+		t.Fatalf("%s : while setting message body", err)
+	}
+	err = dvc.Deliver(context.TODO(), &tr)
 	if err != nil {
 		t.Errorf("%s : while delivering test message", err)
 	}
@@ -3,8 +3,9 @@ package helo
 import "github.com/vodolaz095/msmtpd"
 
 var complain = msmtpd.ErrorSMTP{
-	Code:    521,
-	Message: "I don't like the way you introduce yourself. Goodbye!",
+	Code:         521,
+	EnhancedCode: "5.7.1",
+	Message:      "I don't like the way you introduce yourself. Goodbye!",
 }
 
 // IsLocalAddressFlagName is flag name to mark local remote addresses
@@ -3,7 +3,6 @@ package helo
 import (
 	"context"
 	"fmt"
-	"net"
 	"strings"
 
 	"github.com/vodolaz095/msmtpd"
@@ -28,7 +27,12 @@ func DenyDynamicIP(ctx context.Context, transaction *msmtpd.Transaction) error {
 	}
 	var isDynamic bool
 	var needles []string
-	raw := transaction.Addr.(*net.TCPAddr).IP
+	raw := transaction.RemoteIP()
+	if raw == nil {
+		transaction.LogDebug("Local client connected via %s has no IP address, deny dynamic ip check disabled",
+			transaction.Addr.Network())
+		return nil
+	}
 	if raw.To4() == nil {
 		// i haven't encountered ham being send from IPv6
 		transaction.LogDebug("IP %s looks like IPv6", raw.String())
@@ -3,7 +3,6 @@ package helo
 import (
 	"context"
 	"fmt"
-	"net"
 
 	"github.com/vodolaz095/msmtpd"
 	"go.opentelemetry.io/otel"
@@ -17,7 +16,12 @@ import (
 // 2. PTR records of connecting IP are resolved (aka have DNS A records) into IP addresses including connecting IP
 // This test prevents delivery from majority small GI domains, which are known to be spammy.
 func DenyReverseDNSMismatch(initialCtx context.Context, transaction *msmtpd.Transaction) (err error) {
-	raw := transaction.Addr.(*net.TCPAddr).IP
+	raw := transaction.RemoteIP()
+	if raw == nil {
+		transaction.LogDebug("Local client connected via %s has no PTR records, DenyReverseDNSMismatch check disabled",
+			transaction.Addr.Network())
+		return nil
+	}
 	ctx, span := otel.Tracer("helo.DenyReverseDNSMismatch").Start(initialCtx, "checkHello",
 		trace.WithSpanKind(trace.SpanKindInternal),
 		trace.WithAttributes(
@@ -9,6 +9,13 @@ import (
 
 // SkipHeloCheckForLocal allows local clients provide anything in HELO/EHLO
 func SkipHeloCheckForLocal(_ context.Context, transaction *msmtpd.Transaction) error {
+	if transaction.RemoteIP() == nil {
+		transaction.LogInfo("Skipping HELO/EHLO checks for client connected via %s and HELO %s",
+			transaction.Addr.Network(), transaction.HeloName,
+		)
+		transaction.SetFlag(IsLocalAddressFlagName)
+		return nil
+	}
 	addrPort, err := netip.ParseAddrPort(transaction.Addr.String())
 	if err != nil {
 		transaction.LogError(err, "while parsing remote address "+transaction.Addr.String())
@@ -1,8 +1,11 @@
 package helo
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net"
+	"net/smtp"
 	"testing"
 
 	"github.com/vodolaz095/msmtpd"
@@ -69,3 +72,37 @@ func TestSkipHeloCheckForLocal(t *testing.T) {
 		DenyReverseDNSMismatch,
 	})
 }
+
+func TestHeloChecksForUnixSocket(t *testing.T) {
+	addr, closer := msmtpd.RunTestServerWithoutTLS(t, &msmtpd.Server{
+		ConnectionCheckers: []msmtpd.ConnectionChecker{
+			func(_ context.Context, tr *msmtpd.Transaction) error {
+				tr.Addr = &net.UnixAddr{Name: "@", Net: "unix"}
+				return nil
+			},
+		},
+		HeloCheckers: []msmtpd.HelloChecker{
+			DenyDynamicIP,
+			DenyReverseDNSMismatch,
+			TrustHellos(map[string]string{"127.0.0.1": "localhost"}),
+			SkipHeloCheckForLocal,
+			func(_ context.Context, tr *msmtpd.Transaction) error {
+				if !tr.IsFlagSet(IsLocalAddressFlagName) {
+					return fmt.Errorf("client connected via unix socket is not considered local")
+				}
+				return nil
+			},
+		},
+	})
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Hello("mx.example.org"); err != nil {
+		t.Errorf("HELO failed for client connected via unix socket: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
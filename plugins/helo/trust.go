@@ -2,7 +2,6 @@ package helo
 
 import (
 	"context"
-	"net"
 
 	"github.com/vodolaz095/msmtpd"
 	"go.opentelemetry.io/otel/trace"
@@ -12,12 +11,12 @@ import (
 func TrustHellos(input map[string]string) msmtpd.HelloChecker {
 	return func(ctx context.Context, transaction *msmtpd.Transaction) error {
 		span := trace.SpanFromContext(ctx)
-		a, ok := transaction.Addr.(*net.TCPAddr)
-		if !ok {
-			// connection via unix socket?
+		ip := transaction.RemoteIP()
+		if ip == nil {
+			// connection via unix socket
 			return nil
 		}
-		val, found := input[a.IP.String()]
+		val, found := input[ip.String()]
 		if found {
 			if val == transaction.HeloName {
 				span.AddEvent("IP address is found in trusted and HELO match")
@@ -27,7 +26,7 @@ func TrustHellos(input map[string]string) msmtpd.HelloChecker {
 			span.AddEvent("IP address is found in trusted but HELO differs")
 			transaction.UnsetFlag(IsTrustedOrigin)
 			transaction.LogWarn("IP address %s is found in trusted but HELO differs: expected:%v actual:%s",
-				a.IP.String(), val, transaction.HeloName,
+				ip.String(), val, transaction.HeloName,
 			)
 			return nil
 		}
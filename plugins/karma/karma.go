@@ -51,12 +51,17 @@ type Handler struct {
 
 // ConnectionChecker checks karma of remote IP address using data from Storage
 func (kh *Handler) ConnectionChecker(ctx context.Context, tr *msmtpd.Transaction) (err error) {
+	if tr.RemoteIP() == nil {
+		tr.LogDebug("Karma is not tracked for local client connected via %s", tr.Addr.Network())
+		return nil
+	}
 	err = kh.Storage.Ping(ctx)
 	if err != nil {
 		tr.LogError(err, "while pinging karma storage")
 		return msmtpd.ErrorSMTP{
-			Code:    451,
-			Message: "temporary errors, please, try again later",
+			Code:         451,
+			EnhancedCode: "4.3.0",
+			Message:      "temporary errors, please, try again later",
 		}
 	}
 	tr.Hate(int(kh.InitialHate))
@@ -64,8 +69,9 @@ func (kh *Handler) ConnectionChecker(ctx context.Context, tr *msmtpd.Transaction
 	if err != nil {
 		tr.LogError(err, fmt.Sprintf("while extracting transaction %s karma from storage", tr.ID))
 		return msmtpd.ErrorSMTP{
-			Code:    451,
-			Message: "temporary errors, please, try again later",
+			Code:         451,
+			EnhancedCode: "4.3.0",
+			Message:      "temporary errors, please, try again later",
 		}
 	}
 	if karma > kh.KarmaLimit {
@@ -74,13 +80,17 @@ func (kh *Handler) ConnectionChecker(ctx context.Context, tr *msmtpd.Transaction
 	}
 	tr.LogWarn("network address %s has bad karma %v for limit %v", tr.Addr, karma, kh.KarmaLimit)
 	return msmtpd.ErrorSMTP{
-		Code:    521,
-		Message: "FUCK OFF!", // lol
+		Code:         521,
+		EnhancedCode: "5.7.1",
+		Message:      "FUCK OFF!", // lol
 	}
 }
 
 // CloseHandler saves Transaction Karma into Storage after connection is finished
 func (kh *Handler) CloseHandler(_ context.Context, tr *msmtpd.Transaction) (err error) {
+	if tr.RemoteIP() == nil {
+		return nil
+	}
 	var isGood bool
 	if tr.Karma() > kh.HateLimit {
 		tr.LogDebug("preparing to save transaction karma of %v as good", tr.Karma())
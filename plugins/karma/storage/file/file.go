@@ -3,7 +3,6 @@ package file
 import (
 	"context"
 	"encoding/json"
-	"net"
 	"os"
 	"path/filepath"
 
@@ -33,7 +32,7 @@ func (f *Storage) Close() error {
 }
 
 func (f *Storage) getFileName(transaction *msmtpd.Transaction) string {
-	key := transaction.Addr.(*net.TCPAddr).IP.String()
+	key := transaction.RemoteIP().String()
 	return filepath.Join(f.Directory, key+".json")
 }
 
@@ -2,7 +2,6 @@ package memory
 
 import (
 	"context"
-	"net"
 	"sync"
 
 	"github.com/vodolaz095/msmtpd"
@@ -39,7 +38,7 @@ func (m *Storage) Close() error {
 func (m *Storage) SaveGood(transaction *msmtpd.Transaction) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	key := transaction.Addr.(*net.TCPAddr).IP.String()
+	key := transaction.RemoteIP().String()
 	old, found := m.Data[key]
 	if found {
 		old.Good++
@@ -55,7 +54,7 @@ func (m *Storage) SaveGood(transaction *msmtpd.Transaction) error {
 func (m *Storage) SaveBad(transaction *msmtpd.Transaction) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	key := transaction.Addr.(*net.TCPAddr).IP.String()
+	key := transaction.RemoteIP().String()
 	old, found := m.Data[key]
 	if found {
 		old.Bad++
@@ -69,7 +68,7 @@ func (m *Storage) SaveBad(transaction *msmtpd.Transaction) error {
 
 // Get gets karma score for transaction IP address
 func (m *Storage) Get(transaction *msmtpd.Transaction) (int, error) {
-	key := transaction.Addr.(*net.TCPAddr).IP.String()
+	key := transaction.RemoteIP().String()
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	old, found := m.Data[key]
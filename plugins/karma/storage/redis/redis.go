@@ -3,7 +3,6 @@ package redis
 import (
 	"context"
 	"fmt"
-	"net"
 
 	"github.com/redis/go-redis/v9"
 	"github.com/vodolaz095/msmtpd"
@@ -25,7 +24,7 @@ func (s *Storage) Close() error {
 }
 
 func (s *Storage) getKey(transaction *msmtpd.Transaction) string {
-	return fmt.Sprintf("karma|%s", transaction.Addr.(*net.TCPAddr).IP.String())
+	return fmt.Sprintf("karma|%s", transaction.RemoteIP().String())
 }
 
 // SaveGood saves transaction signature as good
@@ -3,6 +3,7 @@ package quarantine
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -33,8 +34,9 @@ func MoveToDirectory(directory string) msmtpd.DataHandler {
 		if trErr != nil {
 			tr.LogError(trErr, fmt.Sprintf("while creating quarantine directory at %s", dir))
 			return msmtpd.ErrorSMTP{
-				Code:    452,
-				Message: "Requested action not taken: insufficient system storage",
+				Code:         452,
+				EnhancedCode: "4.3.1",
+				Message:      "Requested action not taken: insufficient system storage",
 			}
 		}
 		name := filepath.Join(dir, tr.ID+".eml")
@@ -42,24 +44,27 @@ func MoveToDirectory(directory string) msmtpd.DataHandler {
 		if trErr != nil {
 			tr.LogError(trErr, fmt.Sprintf("while creating quarantine file at %s", name))
 			return msmtpd.ErrorSMTP{
-				Code:    452,
-				Message: "Requested action not taken: insufficient system storage",
+				Code:         452,
+				EnhancedCode: "4.3.1",
+				Message:      "Requested action not taken: insufficient system storage",
 			}
 		}
-		_, trErr = f.Write(tr.Body)
+		_, trErr = io.Copy(f, tr.BodyReader())
 		if trErr != nil {
 			tr.LogError(trErr, fmt.Sprintf("while writing quarantine file at %s", name))
 			return msmtpd.ErrorSMTP{
-				Code:    452,
-				Message: "Requested action not taken: insufficient system storage",
+				Code:         452,
+				EnhancedCode: "4.3.1",
+				Message:      "Requested action not taken: insufficient system storage",
 			}
 		}
 		trErr = f.Close()
 		if trErr != nil {
 			tr.LogError(trErr, fmt.Sprintf("while closing quarantine file at %s", name))
 			return msmtpd.ErrorSMTP{
-				Code:    452,
-				Message: "Requested action not taken: insufficient system storage",
+				Code:         452,
+				EnhancedCode: "4.3.1",
+				Message:      "Requested action not taken: insufficient system storage",
 			}
 		}
 		tr.LogInfo("Message quarantined into %s", name)
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"strings"
+
+	"github.com/vodolaz095/msmtpd"
+)
+
+// KeyFunc extracts key from transaction, so limit is applied separately for every key.
+// If empty string is returned, limit is not applied to transaction
+type KeyFunc func(tr *msmtpd.Transaction) string
+
+// ByIP applies limit to every remote IP address
+func ByIP(tr *msmtpd.Transaction) string {
+	ip := tr.RemoteIP()
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// BySubnet applies limit to every /24 IPv4 or /64 IPv6 subnet, so spammer cannot bypass it
+// by using neighbouring addresses
+func BySubnet(tr *msmtpd.Transaction) string {
+	ip := tr.RemoteIP()
+	if ip == nil {
+		return ""
+	}
+	return msmtpd.SubnetOf(ip)
+}
+
+// ByHELO applies limit to every name client introduced itself with via HELO/EHLO command
+func ByHELO(tr *msmtpd.Transaction) string {
+	return strings.ToLower(tr.HeloName)
+}
+
+// BySenderDomain applies limit to every domain of MAIL FROM address, null sender is not limited
+func BySenderDomain(tr *msmtpd.Transaction) string {
+	at := strings.LastIndex(tr.MailFrom.Address, "@")
+	if at == -1 {
+		return ""
+	}
+	return strings.ToLower(tr.MailFrom.Address[at+1:])
+}
+
+// ByUsername applies limit to every authenticated user, unauthenticated clients are not limited
+func ByUsername(tr *msmtpd.Transaction) string {
+	return tr.Username
+}
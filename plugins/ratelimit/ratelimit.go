@@ -0,0 +1,179 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"time"
+
+	"github.com/vodolaz095/msmtpd"
+)
+
+// Rates are calculated by sliding window counter algorithm - events are counted in fixed windows,
+// and rate is sum of events in current window and events in previous window weighted by part
+// of previous window, which still overlaps sliding one. So it needs only 2 counters per key,
+// unlike sliding window log, and it does not allow bursts on window edges, unlike fixed window.
+
+// rateExceededHate is karma penalty for client exceeding limit
+const rateExceededHate = 1
+
+// Subject defines what is being counted by Limit
+type Subject string
+
+const (
+	// Connections are counted by Handler.ConnectionChecker, so only IP address based keys make sense for them
+	Connections Subject = "connections"
+	// Messages are counted by Handler.SenderChecker on every envelope started by MAIL FROM
+	Messages Subject = "messages"
+	// Recipients are counted by Handler.RecipientChecker on every RCPT TO
+	Recipients Subject = "recipients"
+)
+
+// Limit defines how many events of Subject with the same key can happen during Window
+type Limit struct {
+	// Name is used to distinguish counters of different limits in Storage, it should be unique
+	Name string
+	// Subject defines what is being counted
+	Subject Subject
+	// Key extracts key from transaction, like ByIP, BySubnet, ByHELO, BySenderDomain or ByUsername
+	Key KeyFunc
+	// Max is maximum number of events allowed during Window
+	Max int64
+	// Window is duration of sliding window
+	Window time.Duration
+}
+
+// Validate returns error, if limit is misconfigured
+func (l Limit) Validate() error {
+	if l.Key == nil {
+		return fmt.Errorf("limit %s has no key function", l.Name)
+	}
+	switch l.Subject {
+	case Connections, Messages, Recipients:
+	default:
+		return fmt.Errorf("limit %s has unknown subject %s", l.Name, l.Subject)
+	}
+	if l.Window <= 0 {
+		return fmt.Errorf("limit %s has non-positive window %s", l.Name, l.Window)
+	}
+	if l.Max <= 0 {
+		return fmt.Errorf("limit %s has non-positive maximum %v", l.Name, l.Max)
+	}
+	return nil
+}
+
+// ErrTooManyConnections is returned to clients, which connect too often
+var ErrTooManyConnections = msmtpd.ErrorSMTP{
+	Code:         421,
+	EnhancedCode: "4.7.0",
+	Message:      "Too many connections from your network, try again later, please.",
+}
+
+// ErrTooManyMessages is returned to clients, which send too many messages
+var ErrTooManyMessages = msmtpd.ErrorSMTP{
+	Code:         451,
+	EnhancedCode: "4.7.1",
+	Message:      "Too many messages, try again later, please.",
+}
+
+// ErrTooManyRecipients is returned to clients, which send messages to too many recipients
+var ErrTooManyRecipients = msmtpd.ErrorSMTP{
+	Code:         451,
+	EnhancedCode: "4.7.1",
+	Message:      "Too many recipients, try again later, please.",
+}
+
+var errTemporary = msmtpd.ErrorSMTP{
+	Code:         451,
+	EnhancedCode: "4.3.0",
+	Message:      "temporary errors, please, try again later",
+}
+
+// Handler is struct exposing Checkers for rate limiting, it should be made via New,
+// so misconfigured limits are reported before server is started
+type Handler struct {
+	// Limits are checked in order provided
+	Limits []Limit
+	// Storage keeps counters, it can be shared by many servers, if it is not in memory one
+	Storage Storage
+	// now is used to mock time in unit tests
+	now func() time.Time
+}
+
+// New makes Handler applying limits provided with counters kept in storage. Error is returned,
+// if any of limits is misconfigured
+func New(storage Storage, limits ...Limit) (*Handler, error) {
+	if storage == nil {
+		return nil, fmt.Errorf("storage for rate limits is not set")
+	}
+	for i := range limits {
+		err := limits[i].Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &Handler{Limits: limits, Storage: storage}, nil
+}
+
+// ConnectionChecker applies limits on Connections
+func (h *Handler) ConnectionChecker(ctx context.Context, tr *msmtpd.Transaction) error {
+	return h.check(ctx, tr, Connections, ErrTooManyConnections)
+}
+
+// SenderChecker applies limits on Messages
+func (h *Handler) SenderChecker(ctx context.Context, tr *msmtpd.Transaction) error {
+	return h.check(ctx, tr, Messages, ErrTooManyMessages)
+}
+
+// RecipientChecker applies limits on Recipients
+func (h *Handler) RecipientChecker(ctx context.Context, tr *msmtpd.Transaction, _ *mail.Address) error {
+	return h.check(ctx, tr, Recipients, ErrTooManyRecipients)
+}
+
+// check counts event of subject for all limits applicable and returns exceeded error, if any of them is exceeded
+func (h *Handler) check(ctx context.Context, tr *msmtpd.Transaction, subject Subject, exceeded error) error {
+	for i := range h.Limits {
+		if h.Limits[i].Subject != subject {
+			continue
+		}
+		key := h.Limits[i].Key(tr)
+		if key == "" {
+			continue
+		}
+		rate, err := h.hit(ctx, h.Limits[i], key)
+		if err != nil {
+			tr.LogError(err, fmt.Sprintf("while counting %s for limit %s", subject, h.Limits[i].Name))
+			return errTemporary
+		}
+		if rate > float64(h.Limits[i].Max) {
+			tr.LogWarn("%s %s exceeds limit %s with rate %.1f of %v per %s",
+				subject, key, h.Limits[i].Name, rate, h.Limits[i].Max, h.Limits[i].Window)
+			tr.Hate(rateExceededHate)
+			return exceeded
+		}
+		tr.LogDebug("%s %s has rate %.1f of %v per %s for limit %s",
+			subject, key, rate, h.Limits[i].Max, h.Limits[i].Window, h.Limits[i].Name)
+	}
+	return nil
+}
+
+// hit counts single event for key of limit and returns rate in sliding window
+func (h *Handler) hit(ctx context.Context, limit Limit, key string) (float64, error) {
+	now := time.Now()
+	if h.now != nil {
+		now = h.now()
+	}
+	window := int64(limit.Window)
+	current := now.UnixNano() / window
+	elapsed := float64(now.UnixNano()%window) / float64(window)
+	currentCount, err := h.Storage.Increment(ctx,
+		fmt.Sprintf("ratelimit|%s|%s|%d", limit.Name, key, current), 1, 2*limit.Window)
+	if err != nil {
+		return 0, err
+	}
+	previousCount, err := h.Storage.Get(ctx, fmt.Sprintf("ratelimit|%s|%s|%d", limit.Name, key, current-1))
+	if err != nil {
+		return 0, err
+	}
+	return float64(previousCount)*(1-elapsed) + float64(currentCount), nil
+}
@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/vodolaz095/msmtpd"
+	"github.com/vodolaz095/msmtpd/internal"
+	"github.com/vodolaz095/msmtpd/plugins/ratelimit/storage/memory"
+)
+
+func TestKeys(t *testing.T) {
+	tr := msmtpd.Transaction{
+		Addr:     &net.TCPAddr{IP: net.ParseIP("192.168.1.3"), Port: 25},
+		HeloName: "Mx.Example.org",
+		MailFrom: mail.Address{Address: "sender@Example.org"},
+		Username: "somebody",
+	}
+	testCases := []struct {
+		name     string
+		key      KeyFunc
+		expected string
+	}{
+		{"ip", ByIP, "192.168.1.3"},
+		{"subnet", BySubnet, "192.168.1.0/24"},
+		{"helo", ByHELO, "mx.example.org"},
+		{"sender domain", BySenderDomain, "example.org"},
+		{"username", ByUsername, "somebody"},
+	}
+	for _, tc := range testCases {
+		if key := tc.key(&tr); key != tc.expected {
+			t.Errorf("wrong key %s instead of %s in case %s", key, tc.expected, tc.name)
+		}
+	}
+	tr.Addr = &net.TCPAddr{IP: net.ParseIP("2001:db8:1:2:3::4"), Port: 25}
+	if key := BySubnet(&tr); key != "2001:db8:1:2::/64" {
+		t.Errorf("wrong IPv6 subnet %s", key)
+	}
+	tr.MailFrom = mail.Address{}
+	if key := BySenderDomain(&tr); key != "" {
+		t.Errorf("null sender is limited by key %s", key)
+	}
+	tr.Addr = &net.UnixAddr{Name: "@", Net: "unix"}
+	if key := ByIP(&tr); key != "" {
+		t.Errorf("local client connected via unix socket is limited by key %s", key)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := Handler{
+		Storage: &memory.Storage{},
+		now:     func() time.Time { return now },
+	}
+	limit := Limit{Name: "test", Key: ByIP, Max: 10, Window: time.Minute}
+	for i := 0; i < 10; i++ {
+		rate, err := h.hit(context.TODO(), limit, "192.168.1.3")
+		if err != nil {
+			t.Fatalf("%s : while counting event", err)
+		}
+		if rate != float64(i+1) {
+			t.Errorf("wrong rate %v instead of %v", rate, i+1)
+		}
+	}
+	// 3/4 of previous window overlaps sliding one
+	now = now.Add(time.Minute + 15*time.Second)
+	rate, err := h.hit(context.TODO(), limit, "192.168.1.3")
+	if err != nil {
+		t.Fatalf("%s : while counting event", err)
+	}
+	if rate != 8.5 {
+		t.Errorf("wrong rate %v instead of 8.5", rate)
+	}
+}
+
+func TestMisconfiguredLimits(t *testing.T) {
+	limits := []Limit{
+		{Name: "no_window", Subject: Recipients, Key: ByIP, Max: 10},
+		{Name: "no_max", Subject: Recipients, Key: ByIP, Window: time.Minute},
+		{Name: "no_key", Subject: Recipients, Max: 10, Window: time.Minute},
+		{Name: "no_subject", Key: ByIP, Max: 10, Window: time.Minute},
+	}
+	valid := Limit{Name: "valid", Subject: Recipients, Key: ByIP, Max: 10, Window: time.Minute}
+	for i := range limits {
+		if _, err := New(&memory.Storage{}, valid, limits[i]); err == nil {
+			t.Errorf("handler is made with misconfigured limit %s", limits[i].Name)
+		}
+	}
+	if _, err := New(nil, valid); err == nil {
+		t.Errorf("handler is made without storage")
+	}
+	h, err := New(&memory.Storage{}, valid)
+	if err != nil {
+		t.Fatalf("%s : while making handler", err)
+	}
+	if len(h.Limits) != 1 || h.Storage == nil {
+		t.Errorf("handler is not configured")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	h, err := New(&memory.Storage{},
+		Limit{Name: "connections", Subject: Connections, Key: ByIP, Max: 2, Window: time.Minute},
+		Limit{Name: "recipients", Subject: Recipients, Key: BySenderDomain, Max: 1, Window: time.Minute},
+	)
+	if err != nil {
+		t.Fatalf("%s : while making handler", err)
+	}
+	server := &msmtpd.Server{
+		ConnectionCheckers: []msmtpd.ConnectionChecker{h.ConnectionChecker},
+		SenderCheckers:     []msmtpd.SenderChecker{h.SenderChecker},
+		RecipientCheckers:  []msmtpd.RecipientChecker{h.RecipientChecker},
+	}
+	addr, closer := msmtpd.RunTestServerWithoutTLS(t, server)
+	defer closer()
+
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed: %v", err)
+	}
+	if err = c.Rcpt("recipient1@example.net"); err != nil {
+		t.Errorf("RCPT failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 451, "RCPT TO:<recipient2@example.net>"); err != nil {
+		t.Errorf("RCPT exceeding limit is accepted: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+
+	c, err = smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+
+	_, err = smtp.Dial(addr)
+	if err == nil {
+		t.Errorf("connection exceeding limit is accepted")
+	} else if err.Error() != ErrTooManyConnections.Error() {
+		t.Errorf("wrong error for connection exceeding limit: %s", err)
+	}
+	for i := 0; i < 50 && server.GetActiveTransactionsCount() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
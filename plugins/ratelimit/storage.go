@@ -0,0 +1,19 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Storage is interface to abstract away counters used to calculate rates
+type Storage interface {
+	// Ping ensures Storage works
+	Ping(ctx context.Context) error
+	// Close closes storage, it should be called before application exits
+	Close() error
+	// Increment adds delta to counter with key provided and returns its new value,
+	// counter is removed after ttl passes since its creation
+	Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// Get returns value of counter with key provided, or 0, if counter does not exist
+	Get(ctx context.Context, key string) (int64, error)
+}
@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// purgeInterval is how often expired counters are removed from memory
+const purgeInterval = time.Minute
+
+// counter is value with expiration time
+type counter struct {
+	value     int64
+	expiresAt time.Time
+}
+
+// Storage keeps rate limit counters in memory, so they are not shared between servers
+// and are lost on restart
+type Storage struct {
+	mu          sync.Mutex
+	data        map[string]counter
+	nextPurgeAt time.Time
+}
+
+// Ping does nothing, but somehow prepares memory storage
+func (m *Storage) Ping(_ context.Context) error {
+	return nil
+}
+
+// Close purges memory storage
+func (m *Storage) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = nil
+	return nil
+}
+
+// Increment adds delta to counter with key provided and returns its new value
+func (m *Storage) Increment(_ context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if m.data == nil {
+		m.data = make(map[string]counter, 0)
+	}
+	if now.After(m.nextPurgeAt) {
+		for k := range m.data {
+			if now.After(m.data[k].expiresAt) {
+				delete(m.data, k)
+			}
+		}
+		m.nextPurgeAt = now.Add(purgeInterval)
+	}
+	old, found := m.data[key]
+	if !found || now.After(old.expiresAt) {
+		old = counter{expiresAt: now.Add(ttl)}
+	}
+	old.value += delta
+	m.data[key] = old
+	return old.value, nil
+}
+
+// Get returns value of counter with key provided, or 0, if counter does not exist
+func (m *Storage) Get(_ context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, found := m.data[key]
+	if !found || time.Now().After(old.expiresAt) {
+		return 0, nil
+	}
+	return old.value, nil
+}
@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStorage(t *testing.T) {
+	storage := Storage{}
+	err := storage.Ping(context.TODO())
+	if err != nil {
+		t.Errorf("%s : while pinging storage", err)
+	}
+	value, err := storage.Get(context.TODO(), "test")
+	if err != nil {
+		t.Errorf("%s : while getting counter", err)
+	}
+	if value != 0 {
+		t.Errorf("wrong value %v of missing counter", value)
+	}
+	for i := int64(1); i <= 3; i++ {
+		value, err = storage.Increment(context.TODO(), "test", 1, 100*time.Millisecond)
+		if err != nil {
+			t.Errorf("%s : while incrementing counter", err)
+		}
+		if value != i {
+			t.Errorf("wrong value %v instead of %v", value, i)
+		}
+	}
+	value, err = storage.Get(context.TODO(), "test")
+	if err != nil {
+		t.Errorf("%s : while getting counter", err)
+	}
+	if value != 3 {
+		t.Errorf("wrong value %v instead of 3", value)
+	}
+	time.Sleep(150 * time.Millisecond)
+	value, err = storage.Get(context.TODO(), "test")
+	if err != nil {
+		t.Errorf("%s : while getting counter", err)
+	}
+	if value != 0 {
+		t.Errorf("wrong value %v of expired counter", value)
+	}
+	value, err = storage.Increment(context.TODO(), "test", 1, 100*time.Millisecond)
+	if err != nil {
+		t.Errorf("%s : while incrementing counter", err)
+	}
+	if value != 1 {
+		t.Errorf("expired counter is not reset, value is %v", value)
+	}
+	err = storage.Close()
+	if err != nil {
+		t.Errorf("%s : while closing storage", err)
+	}
+}
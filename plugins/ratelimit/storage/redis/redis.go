@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Storage keeps rate limit counters in redis database, so they can be shared by many servers
+type Storage struct {
+	Client *redis.Client
+}
+
+// Ping tests connection to redis database
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.Client.Ping(ctx).Err()
+}
+
+// Close closes connection to redis database
+func (s *Storage) Close() error {
+	return s.Client.Close()
+}
+
+// Increment adds delta to counter with key provided and returns its new value
+func (s *Storage) Increment(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := s.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.IncrBy(ctx, key, delta)
+		// NX flag makes counter expire after ttl since its creation, not since last increment
+		pipe.ExpireNX(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// Get returns value of counter with key provided, or 0, if counter does not exist
+func (s *Storage) Get(ctx context.Context, key string) (int64, error) {
+	value, err := s.Client.Get(ctx, key).Int64()
+	if err != nil {
+		if err != redis.Nil {
+			return 0, err
+		}
+		return 0, nil
+	}
+	return value, nil
+}
+
+// key format is
+//
+// key - ratelimit|<limit name>|<key>|<window number>
+// keytype string
+// value - number of events in window
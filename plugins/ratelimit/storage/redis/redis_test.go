@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestStorage(t *testing.T) {
+	testRedisURL := os.Getenv("REDIS_URL")
+	if testRedisURL == "" {
+		t.Skipf("set redis connection string as REDIS_URL environmen variable")
+	}
+	opts, err := redis.ParseURL(testRedisURL)
+	if err != nil {
+		t.Fatalf("%s : while parsing redis url %s", err, testRedisURL)
+	}
+	client := redis.NewClient(opts)
+	err = client.Del(context.TODO(), "ratelimit|test").Err()
+	if err != nil {
+		t.Errorf("%s : while cleaning data from redis by client", err)
+	}
+	storage := Storage{Client: client}
+	err = storage.Ping(context.TODO())
+	if err != nil {
+		t.Errorf("%s : while pinging storage", err)
+	}
+	value, err := storage.Get(context.TODO(), "ratelimit|test")
+	if err != nil {
+		t.Errorf("%s : while getting counter", err)
+	}
+	if value != 0 {
+		t.Errorf("wrong value %v of missing counter", value)
+	}
+	for i := int64(1); i <= 3; i++ {
+		value, err = storage.Increment(context.TODO(), "ratelimit|test", 1, time.Minute)
+		if err != nil {
+			t.Errorf("%s : while incrementing counter", err)
+		}
+		if value != i {
+			t.Errorf("wrong value %v instead of %v", value, i)
+		}
+	}
+	value, err = storage.Get(context.TODO(), "ratelimit|test")
+	if err != nil {
+		t.Errorf("%s : while getting counter", err)
+	}
+	if value != 3 {
+		t.Errorf("wrong value %v instead of 3", value)
+	}
+	ttl, err := client.TTL(context.TODO(), "ratelimit|test").Result()
+	if err != nil {
+		t.Errorf("%s : while getting counter TTL", err)
+	}
+	if ttl <= 0 || ttl > time.Minute {
+		t.Errorf("wrong counter TTL %s", ttl)
+	}
+	err = client.Del(context.TODO(), "ratelimit|test").Err()
+	if err != nil {
+		t.Errorf("%s : while cleaning data from redis by client", err)
+	}
+	err = storage.Close()
+	if err != nil {
+		t.Errorf("%s : while closing storage", err)
+	}
+}
@@ -8,12 +8,12 @@ import (
 	"github.com/vodolaz095/msmtpd"
 )
 
-var errRecipientNotWhitelisted = fmt.Errorf("521 I'm sorry, but recipient's email address is not in whitelist")
+var errRecipientNotWhitelisted = fmt.Errorf("521 5.7.1 I'm sorry, but recipient's email address is not in whitelist")
 
 func TestAcceptMailFromDomainsOrAddresses(t *testing.T) {
 	cases := make(map[string]error, 0)
 
-	cases["thisIsNotAEmail"] = fmt.Errorf("502 Malformed e-mail address")
+	cases["thisIsNotAEmail"] = fmt.Errorf("502 5.1.3 Malformed e-mail address")
 
 	cases["a@example.org"] = nil
 	cases["a@vodolaz095.ru"] = nil
@@ -23,6 +23,10 @@ func TestAcceptMailFromDomainsOrAddresses(t *testing.T) {
 	cases["d@gmail.com"] = errRecipientNotWhitelisted
 	cases["e@gmail.com"] = errRecipientNotWhitelisted
 	cases["info@yandex.ru"] = errRecipientNotWhitelisted
+	cases["info@почта.рф"] = nil
+	cases["info@Почта.РФ"] = nil
+	cases["info@xn--80a1acny.xn--p1ai"] = nil
+	cases["info@Example.ORG"] = nil
 
 	addr, closer := msmtpd.RunTestServerWithoutTLS(t, &msmtpd.Server{
 		RecipientCheckers: []msmtpd.RecipientChecker{
@@ -30,6 +34,7 @@ func TestAcceptMailFromDomainsOrAddresses(t *testing.T) {
 				[]string{
 					"example.org",
 					"vodolaz095.ru",
+					"почта.рф",
 				},
 				[]string{
 					"a@gmail.com",
@@ -75,7 +80,7 @@ func TestAcceptMailFromDomainsOrAddresses(t *testing.T) {
 func TestAcceptMailFromDomains(t *testing.T) {
 	cases := make(map[string]error, 0)
 
-	cases["thisIsNotAEmail"] = fmt.Errorf("502 Malformed e-mail address")
+	cases["thisIsNotAEmail"] = fmt.Errorf("502 5.1.3 Malformed e-mail address")
 
 	cases["a@example.org"] = nil
 	cases["a@vodolaz095.ru"] = nil
@@ -133,7 +138,7 @@ func TestAcceptMailFromDomains(t *testing.T) {
 func TestAcceptMailFromAddresses(t *testing.T) {
 	cases := make(map[string]error, 0)
 
-	cases["thisIsNotAEmail"] = fmt.Errorf("502 Malformed e-mail address")
+	cases["thisIsNotAEmail"] = fmt.Errorf("502 5.1.3 Malformed e-mail address")
 
 	cases["a@example.org"] = errRecipientNotWhitelisted
 	cases["a@vodolaz095.ru"] = errRecipientNotWhitelisted
@@ -4,7 +4,6 @@ import (
 	"context"
 	"log"
 	"net/mail"
-	"strings"
 
 	"github.com/vodolaz095/msmtpd"
 )
@@ -13,8 +12,8 @@ import (
 func AcceptMailForDomainsOrAddresses(whitelistedDomains, whitelistedAddresses []string) msmtpd.RecipientChecker {
 	var err error
 	var parsed *mail.Address
-	goodRecipients := make(map[mail.Address]bool, 0)
-
+	var normalized string
+	goodRecipients := make(map[string]bool, 0)
 	for i, raw := range whitelistedAddresses {
 		parsed, err = mail.ParseAddress(raw)
 		if err != nil {
@@ -22,27 +21,46 @@ func AcceptMailForDomainsOrAddresses(whitelistedDomains, whitelistedAddresses []
 				err, i, raw,
 			)
 		}
-		goodRecipients[*parsed] = true
+		normalized, err = msmtpd.NormalizeAddress(parsed.Address)
+		if err != nil {
+			log.Fatalf("%s : while plugin rcpt_to/AcceptMailForDomainsOrAddresses tries to normalize address %v %s",
+				err, i, raw,
+			)
+		}
+		goodRecipients[normalized] = true
 	}
 	goodDomains := make(map[string]bool, 0)
-	for _, raw := range whitelistedDomains {
-		goodDomains[strings.ToLower(raw)] = true
+	for i, raw := range whitelistedDomains {
+		normalized, err = msmtpd.NormalizeDomain(raw)
+		if err != nil {
+			log.Fatalf("%s : while plugin rcpt_to/AcceptMailForDomainsOrAddresses tries to normalize domain %v %s",
+				err, i, raw,
+			)
+		}
+		goodDomains[normalized] = true
 	}
 	return func(_ context.Context, transaction *msmtpd.Transaction, recipient *mail.Address) error {
-		domain := strings.Split(recipient.Address, "@")[1]
-		_, found := goodDomains[domain]
-		if found {
-			transaction.LogDebug("Recipient's %s domain is whitelisted", transaction.MailFrom.String())
-			return nil
+		_, domain := msmtpd.SplitAddress(recipient.Address)
+		normalizedDomain, normalizeErr := msmtpd.NormalizeDomain(domain)
+		if normalizeErr == nil {
+			_, found := goodDomains[normalizedDomain]
+			if found {
+				transaction.LogDebug("Recipient's %s domain is whitelisted", recipient.String())
+				return nil
+			}
 		}
-		_, found = goodRecipients[*recipient]
-		if found {
-			transaction.LogDebug("Recipient %s is whitelisted", transaction.MailFrom.String())
-			return nil
+		normalizedAddress, normalizeErr := msmtpd.NormalizeAddress(recipient.Address)
+		if normalizeErr == nil {
+			_, found := goodRecipients[normalizedAddress]
+			if found {
+				transaction.LogDebug("Recipient %s is whitelisted", recipient.String())
+				return nil
+			}
 		}
 		return msmtpd.ErrorSMTP{
-			Code:    521,
-			Message: "I'm sorry, but recipient's email address is not in whitelist",
+			Code:         521,
+			EnhancedCode: "5.7.1",
+			Message:      "I'm sorry, but recipient's email address is not in whitelist",
 		}
 	}
 }
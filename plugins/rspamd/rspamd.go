@@ -4,6 +4,7 @@ package rspamd
 // https://rspamd.com/doc/architecture/protocol.html
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/tls"
@@ -11,11 +12,12 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"net"
+	"mime"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -26,11 +28,8 @@ import (
 	"github.com/vodolaz095/msmtpd"
 )
 
-var subjectRegex *regexp.Regexp
-
-func init() {
-	subjectRegex = regexp.MustCompile(`^Subject:.*$`)
-}
+// subjectRegex matches Subject header with its continuation lines
+var subjectRegex = regexp.MustCompile(`(?im)^Subject:[^\n]*\n(?:[ \t][^\n]*\n)*`)
 
 // DefaultAddress is HTTP address where funny RSPAMD GUI is listening
 const DefaultAddress = "http://localhost:11334/"
@@ -144,17 +143,20 @@ func DataChecker(opts Opts) msmtpd.DataChecker {
 		)
 		defer span.End()
 
-		payload := bytes.NewReader(transaction.Body)
 		req, err := http.NewRequestWithContext(ctx, http.MethodPost,
-			fmt.Sprintf("%s%s", opts.URL, DefaultEndpoint), payload)
+			fmt.Sprintf("%s%s", opts.URL, DefaultEndpoint), transaction.BodyReader())
 		if err != nil {
 			transaction.LogError(err, "error while making HTTP request to RSPAMD")
 			return msmtpd.ErrorSMTP{
-				Code:    421,
-				Message: rspamdComplain,
+				Code:         421,
+				EnhancedCode: "4.3.0",
+				Message:      rspamdComplain,
 			}
 		}
-		req.Header.Add("IP", transaction.Addr.(*net.TCPAddr).IP.String())
+		req.ContentLength = transaction.BodySize()
+		if ip := transaction.RemoteIP(); ip != nil { // local clients connected via unix domain socket have no IP
+			req.Header.Add("IP", ip.String())
+		}
 		req.Header.Add("Helo", transaction.HeloName)
 		if transaction.MailFrom.Address != "" { // postmaster can have envelope with empty mail from
 			req.Header.Add("From", transaction.MailFrom.String())
@@ -181,8 +183,9 @@ func DataChecker(opts Opts) msmtpd.DataChecker {
 			span.RecordError(err)
 			transaction.LogError(err, "error while doing HTTP request to RSPAMD")
 			return msmtpd.ErrorSMTP{
-				Code:    421,
-				Message: rspamdComplain,
+				Code:         421,
+				EnhancedCode: "4.3.0",
+				Message:      rspamdComplain,
 			}
 		}
 		transaction.LogDebug("Rspamd status %s %v", res.Status, res.StatusCode)
@@ -193,8 +196,9 @@ func DataChecker(opts Opts) msmtpd.DataChecker {
 			transaction.LogError(fmt.Errorf("wrong status code %s", res.Status),
 				"error while doing HTTP request to RSPAMD")
 			return msmtpd.ErrorSMTP{
-				Code:    421,
-				Message: rspamdComplain,
+				Code:         421,
+				EnhancedCode: "4.3.0",
+				Message:      rspamdComplain,
 			}
 		}
 
@@ -202,8 +206,9 @@ func DataChecker(opts Opts) msmtpd.DataChecker {
 		if err != nil {
 			transaction.LogError(err, "error reading Rspamd response")
 			return msmtpd.ErrorSMTP{
-				Code:    421,
-				Message: rspamdComplain,
+				Code:         421,
+				EnhancedCode: "4.3.0",
+				Message:      rspamdComplain,
 			}
 		}
 		transaction.LogTrace("rspamd response is %s", string(checkResponseBody))
@@ -214,8 +219,9 @@ func DataChecker(opts Opts) msmtpd.DataChecker {
 			span.RecordError(err)
 			transaction.LogError(err, "while parsing rspamd response")
 			return msmtpd.ErrorSMTP{
-				Code:    421,
-				Message: rspamdComplain,
+				Code:         421,
+				EnhancedCode: "4.3.0",
+				Message:      rspamdComplain,
 			}
 		}
 		for k := range rr.Symbols {
@@ -237,8 +243,9 @@ func DataChecker(opts Opts) msmtpd.DataChecker {
 			return nil
 		case ActionGreylist:
 			return msmtpd.ErrorSMTP{
-				Code:    451,
-				Message: "Your message looks suspicious, try to deliver it one more time, maybe i'll change my mind and accept it",
+				Code:         451,
+				EnhancedCode: "4.7.1",
+				Message:      "Your message looks suspicious, try to deliver it one more time, maybe i'll change my mind and accept it",
 			}
 		case ActionAddHeader:
 			for k, v := range rr.Milter.AddHeaders {
@@ -247,26 +254,72 @@ func DataChecker(opts Opts) msmtpd.DataChecker {
 			}
 			return nil
 		case ActionRewriteSubject:
-			transaction.Body = subjectRegex.ReplaceAll(transaction.Body,
-				[]byte(fmt.Sprintf("Subject: %s", rr.Subject)),
-			)
-			transaction.Parsed.Header["Subject"] = []string{rr.Subject}
+			err = rewriteSubject(transaction, rr.Subject)
+			if err != nil {
+				transaction.LogError(err, "while rewriting subject")
+				return msmtpd.ErrorSMTP{
+					Code:         421,
+					EnhancedCode: "4.7.1",
+					Message:      rspamdComplain,
+				}
+			}
 			return nil
 		case ActionSoftReject:
 			return msmtpd.ErrorSMTP{
-				Code:    421,
-				Message: rspamdComplain,
+				Code:         421,
+				EnhancedCode: "4.7.1",
+				Message:      rspamdComplain,
 			}
 		case ActionHardReject:
 			return msmtpd.ErrorSMTP{
-				Code:    521,
-				Message: "Stop sending me this nonsense, please!",
+				Code:         521,
+				EnhancedCode: "5.7.1",
+				Message:      "Stop sending me this nonsense, please!",
 			}
 		default:
 			return msmtpd.ErrorSMTP{
-				Code:    421,
-				Message: rspamdComplain,
+				Code:         421,
+				EnhancedCode: "4.7.1",
+				Message:      rspamdComplain,
 			}
 		}
 	}
 }
+
+// rewriteSubject replaces Subject header of message body and of parsed message, Subject header
+// is added, if message has none. Only header block is loaded into memory, message body is streamed
+func rewriteSubject(transaction *msmtpd.Transaction, subject string) error {
+	reader := bufio.NewReader(transaction.BodyReader())
+	var headers []byte
+	var separator string
+	for {
+		line, err := reader.ReadString('\n')
+		if line == "\r\n" || line == "\n" {
+			separator = line
+			break
+		}
+		headers = append(headers, line...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	line := []byte("Subject: " + mime.QEncoding.Encode("utf-8", subject) + "\r\n")
+	if subjectRegex.Match(headers) {
+		headers = subjectRegex.ReplaceAllLiteral(headers, line)
+	} else {
+		headers = append(line, headers...)
+	}
+	err := transaction.SetBody(io.MultiReader(
+		bytes.NewReader(headers),
+		strings.NewReader(separator),
+		reader,
+	))
+	if err != nil {
+		return err
+	}
+	transaction.Parsed.Header["Subject"] = []string{subject}
+	return nil
+}
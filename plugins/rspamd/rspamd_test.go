@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/mail"
 	"net/smtp"
 	"os"
 	"testing"
@@ -146,7 +147,7 @@ func TestCheckPyMockRSPAMDFail(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() != "421 Too many letters, i cannot read them all now. Please, resend your message later" {
+		if err.Error() != "421 4.3.0 Too many letters, i cannot read them all now. Please, resend your message later" {
 			t.Errorf("%s : wrong status", err)
 		}
 	} else {
@@ -304,7 +305,7 @@ func TestCheckPyMockRSPAMDActionGreylist(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() != "451 Your message looks suspicious, try to deliver it one more time, maybe i'll change my mind and accept it" {
+		if err.Error() != "451 4.7.1 Your message looks suspicious, try to deliver it one more time, maybe i'll change my mind and accept it" {
 			t.Errorf("%s : wrong status", err)
 		}
 	} else {
@@ -472,7 +473,7 @@ func TestCheckPyMockRSPAMDActionSoftReject(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() != "421 Too many letters, i cannot read them all now. Please, resend your message later" {
+		if err.Error() != "421 4.7.1 Too many letters, i cannot read them all now. Please, resend your message later" {
 			t.Errorf("%s : wrong status", err)
 		}
 	} else {
@@ -553,7 +554,7 @@ func TestCheckPyMockRSPAMDActionHardReject(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() != "521 Stop sending me this nonsense, please!" {
+		if err.Error() != "521 5.7.1 Stop sending me this nonsense, please!" {
 			t.Errorf("%s : wrong status", err)
 		}
 	} else {
@@ -598,6 +599,14 @@ func TestCheckPyMockRSPAMDActionRewriteSubject(t *testing.T) {
 				if transaction.Parsed.Header.Get("Subject") != "new subject rewritten" {
 					t.Errorf("header not added")
 				}
+				delivered, err := mail.ReadMessage(transaction.BodyReader())
+				if err != nil {
+					t.Errorf("%s : while parsing delivered body", err)
+					return nil
+				}
+				if subjects := delivered.Header["Subject"]; len(subjects) != 1 || subjects[0] != "new subject rewritten" {
+					t.Errorf("subject of delivered body is not rewritten: %v", subjects)
+				}
 				return nil
 			},
 		},
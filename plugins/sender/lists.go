@@ -4,7 +4,6 @@ import (
 	"context"
 	"log"
 	"net/mail"
-	"strings"
 
 	"github.com/vodolaz095/msmtpd"
 )
@@ -14,7 +13,8 @@ import (
 func AcceptMailFromDomainsOrAddresses(whitelistedDomains, whitelistedAddresses []string) msmtpd.SenderChecker {
 	var err error
 	var parsed *mail.Address
-	goodMailFroms := make(map[mail.Address]bool, 0)
+	var normalized string
+	goodMailFroms := make(map[string]bool, 0)
 
 	for i, raw := range whitelistedAddresses {
 		parsed, err = mail.ParseAddress(raw)
@@ -23,28 +23,47 @@ func AcceptMailFromDomainsOrAddresses(whitelistedDomains, whitelistedAddresses [
 				err, i, raw,
 			)
 		}
-		goodMailFroms[*parsed] = true
+		normalized, err = msmtpd.NormalizeAddress(parsed.Address)
+		if err != nil {
+			log.Fatalf("%s : while plugin mail_from/AcceptMailFromDomainsOrAddresses tries to normalize address %v %s",
+				err, i, raw,
+			)
+		}
+		goodMailFroms[normalized] = true
 	}
 	goodDomains := make(map[string]bool, 0)
-	for _, raw := range whitelistedDomains {
-		goodDomains[strings.ToLower(raw)] = true
+	for i, raw := range whitelistedDomains {
+		normalized, err = msmtpd.NormalizeDomain(raw)
+		if err != nil {
+			log.Fatalf("%s : while plugin mail_from/AcceptMailFromDomainsOrAddresses tries to normalize domain %v %s",
+				err, i, raw,
+			)
+		}
+		goodDomains[normalized] = true
 	}
 	return func(_ context.Context, transaction *msmtpd.Transaction) error {
-		domain := strings.Split(transaction.MailFrom.Address, "@")[1]
-		_, found := goodDomains[domain]
-		if found {
-			transaction.LogInfo("Sender's %s domain is whitelisted", transaction.MailFrom.String())
-			return nil
+		_, domain := msmtpd.SplitAddress(transaction.MailFrom.Address)
+		normalizedDomain, normalizeErr := msmtpd.NormalizeDomain(domain)
+		if normalizeErr == nil {
+			_, found := goodDomains[normalizedDomain]
+			if found {
+				transaction.LogInfo("Sender's %s domain is whitelisted", transaction.MailFrom.String())
+				return nil
+			}
 		}
-		_, found = goodMailFroms[transaction.MailFrom]
-		if found {
-			transaction.LogInfo("Sender %s is whitelisted", transaction.MailFrom.String())
-			return nil
+		normalizedAddress, normalizeErr := msmtpd.NormalizeAddress(transaction.MailFrom.Address)
+		if normalizeErr == nil {
+			_, found := goodMailFroms[normalizedAddress]
+			if found {
+				transaction.LogInfo("Sender %s is whitelisted", transaction.MailFrom.String())
+				return nil
+			}
 		}
 		transaction.LogInfo("Sender %s is not whitelisted", transaction.MailFrom.String())
 		return msmtpd.ErrorSMTP{
-			Code:    521,
-			Message: "I'm sorry, but your email address is not in whitelist",
+			Code:         521,
+			EnhancedCode: "5.7.1",
+			Message:      "I'm sorry, but your email address is not in whitelist",
 		}
 	}
 }
@@ -43,6 +43,14 @@ const IsNotResolvableComplain = "Seems like i cannot find your sender address ma
 
 // IsResolvable is msmtpd.SenderChecker checker that performs DNS validations to proof we can send answer back to sender's email address
 func IsResolvable(opts IsResolvableOptions) msmtpd.SenderChecker {
+	trustedDomains := make(map[string]bool, 0)
+	for i := range opts.DomainsToTrust {
+		normalized, err := msmtpd.NormalizeDomain(opts.DomainsToTrust[i])
+		if err != nil {
+			normalized = strings.ToLower(opts.DomainsToTrust[i])
+		}
+		trustedDomains[normalized] = true
+	}
 	return func(_ context.Context, transaction *msmtpd.Transaction) error {
 		if transaction.MailFrom.Address == "" && opts.AllowNullSender {
 			transaction.LogDebug("Null sender is allowed")
@@ -53,20 +61,22 @@ func IsResolvable(opts IsResolvableOptions) msmtpd.SenderChecker {
 		if len(parts) != 2 {
 			transaction.LogInfo("Malformed sender %s", transaction.MailFrom.String())
 			return msmtpd.ErrorSMTP{
-				Code:    521,
-				Message: "Malformed MAIL FROM is not allowed, go and bother different domains",
+				Code:         521,
+				EnhancedCode: "5.1.7",
+				Message:      "Malformed MAIL FROM is not allowed, go and bother different domains",
 			}
 		}
-		domain := parts[1]
-
-		var trustedDomain bool
-		for i := range opts.DomainsToTrust {
-			if domain == opts.DomainsToTrust[i] {
-				trustedDomain = true
-				break
+		// internationalized domains are resolved in A-label form
+		domain, err := msmtpd.NormalizeDomain(parts[1])
+		if err != nil {
+			transaction.LogInfo("%s : while normalizing sender %s domain", err, transaction.MailFrom.String())
+			return msmtpd.ErrorSMTP{
+				Code:         521,
+				EnhancedCode: "5.1.7",
+				Message:      "Malformed MAIL FROM is not allowed, go and bother different domains",
 			}
 		}
-		if trustedDomain {
+		if trustedDomains[domain] {
 			transaction.LogInfo("Sender %s is resolvable because he has trusted domain",
 				transaction.MailFrom.Address,
 			)
@@ -107,16 +117,18 @@ func IsResolvable(opts IsResolvableOptions) msmtpd.SenderChecker {
 				possibleMxServers = append(possibleMxServers, domain)
 			} else {
 				return msmtpd.ErrorSMTP{
-					Code:    421,
-					Message: IsNotResolvableComplain,
+					Code:         421,
+					EnhancedCode: "4.1.8",
+					Message:      IsNotResolvableComplain,
 				}
 			}
 		}
 		if len(possibleMxServers) == 0 {
 			transaction.LogInfo("For domain %s there are no possible email exchanges", domain)
 			return msmtpd.ErrorSMTP{
-				Code:    421,
-				Message: IsNotResolvableComplain,
+				Code:         421,
+				EnhancedCode: "4.1.8",
+				Message:      IsNotResolvableComplain,
 			}
 		}
 		transaction.LogDebug("For domain %s there are %v possible email exchanges",
@@ -202,8 +214,9 @@ func IsResolvable(opts IsResolvableOptions) msmtpd.SenderChecker {
 		}
 		transaction.LogInfo("No usable MX servers for domain %s", domain)
 		return msmtpd.ErrorSMTP{
-			Code:    421,
-			Message: IsNotResolvableComplain,
+			Code:         421,
+			EnhancedCode: "4.1.8",
+			Message:      IsNotResolvableComplain,
 		}
 	}
 }
@@ -0,0 +1,394 @@
+package msmtpd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Good read - https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+// Example of v1 header: `PROXY TCP4 8.8.8.8 127.0.0.1 443 25\r\n`
+// v2 header is binary one, it starts with signature `\r\n\r\n\x00\r\nQUIT\n`
+
+// DefaultProxyHeaderTimeout is default time we wait for PROXY protocol header from load balancer
+const DefaultProxyHeaderTimeout = 5 * time.Second
+
+// proxyV2Signature starts every PROXY protocol v2 header
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// maxProxyV1HeaderLength is maximum length of PROXY protocol v1 header including <CR><LF>
+const maxProxyV1HeaderLength = 107
+
+// PROXY protocol v2 TLV types
+const (
+	proxyTLVTypeALPN          = 0x01
+	proxyTLVTypeAuthority     = 0x02
+	proxyTLVTypeSSL           = 0x20
+	proxyTLVSubTypeSSLVersion = 0x21
+	proxyTLVSubTypeSSLCN      = 0x22
+	proxyTLVSubTypeSSLCipher  = 0x23
+	proxyTLVSubTypeSSLSigAlg  = 0x24
+	proxyTLVSubTypeSSLKeyAlg  = 0x25
+)
+
+// ErrProxyHeaderMissing is returned, when trusted peer has not sent PROXY protocol header
+var ErrProxyHeaderMissing = errors.New("proxy protocol header is missing")
+
+// ErrProxyHeaderMalformed is returned, when PROXY protocol header cannot be parsed
+var ErrProxyHeaderMalformed = errors.New("proxy protocol header is malformed")
+
+// ProxyTLS is information about TLS connection between client and load balancer, as PP2_TYPE_SSL TLV describes it
+type ProxyTLS struct {
+	// Client is bit field - 0x01 means client connected over TLS, 0x02 - client provided certificate
+	// over current connection, 0x04 - client provided certificate at least once over TLS session
+	Client byte
+	// Verified is true, if client certificate is verified by load balancer
+	Verified bool
+	// Version is TLS version, like TLSv1.3
+	Version string
+	// CommonName is Common Name field of client certificate
+	CommonName string
+	// Cipher is name of cipher used, like ECDHE-RSA-AES128-GCM-SHA256
+	Cipher string
+	// SignatureAlgorithm is algorithm used to sign client certificate
+	SignatureAlgorithm string
+	// KeyAlgorithm is algorithm used to generate client certificate key
+	KeyAlgorithm string
+}
+
+// ProxyHeader is information load balancer provided via PROXY protocol header
+type ProxyHeader struct {
+	// Version of PROXY protocol used - 1 or 2
+	Version int
+	// Local is true, if load balancer made connection on its own behalf, like for health checks,
+	// so SourceAddr and DestinationAddr are real connection addresses
+	Local bool
+	// SourceAddr is address of client connected to load balancer
+	SourceAddr net.Addr
+	// DestinationAddr is address of load balancer client connected to
+	DestinationAddr net.Addr
+	// ALPN is Application-Layer Protocol Negotiation identifier client and load balancer agreed on
+	ALPN string
+	// Authority is host name client provided via TLS SNI extension
+	Authority string
+	// TLS is information about TLS connection between client and load balancer, if it is encrypted
+	TLS *ProxyTLS
+	// TLVs are raw Type-Length-Value records of v2 header, including ones we do not parse,
+	// like AWS VPC endpoint ID (0xEA)
+	TLVs map[byte][]byte
+}
+
+// ProxyListener wraps net.Listener to accept PROXY protocol v1 and v2 headers load balancers
+// like HAProxy or AWS NLB send before passing client connection. Headers are accepted only
+// from TrustedNetworks, connections from other addresses are passed as is.
+// Header is parsed, when Server starts transaction, so Transaction.Addr,
+// PTR records and ConnectionCheckers use real client address.
+type ProxyListener struct {
+	net.Listener
+	// TrustedNetworks are networks from which PROXY protocol header is required
+	TrustedNetworks []*net.IPNet
+	// HeaderTimeout limits time we wait for PROXY protocol header, default is DefaultProxyHeaderTimeout
+	HeaderTimeout time.Duration
+}
+
+// NewProxyListener wraps listener to accept PROXY protocol header from networks provided in CIDR notation,
+// for example, `10.0.0.0/8` or `192.168.1.1/32`
+func NewProxyListener(listener net.Listener, trustedNetworks ...string) (*ProxyListener, error) {
+	pl := ProxyListener{
+		Listener:        listener,
+		TrustedNetworks: make([]*net.IPNet, 0, len(trustedNetworks)),
+		HeaderTimeout:   DefaultProxyHeaderTimeout,
+	}
+	for i := range trustedNetworks {
+		_, network, err := net.ParseCIDR(trustedNetworks[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w : while parsing trusted network %s", err, trustedNetworks[i])
+		}
+		pl.TrustedNetworks = append(pl.TrustedNetworks, network)
+	}
+	return &pl, nil
+}
+
+// Accept waits for and returns the next connection to the listener. Connections from trusted networks
+// are wrapped into ProxyConn
+func (pl *ProxyListener) Accept() (net.Conn, error) {
+	conn, err := pl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !pl.isTrusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+	timeout := pl.HeaderTimeout
+	if timeout == 0 {
+		timeout = DefaultProxyHeaderTimeout
+	}
+	return &ProxyConn{
+		Conn:    conn,
+		reader:  bufio.NewReader(conn),
+		timeout: timeout,
+	}, nil
+}
+
+func (pl *ProxyListener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for i := range pl.TrustedNetworks {
+		if pl.TrustedNetworks[i].Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProxyConn is connection from trusted load balancer, which starts with PROXY protocol header
+type ProxyConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+	once    sync.Once
+	header  *ProxyHeader
+	err     error
+}
+
+// Header reads and parses PROXY protocol header once, and returns it
+func (pc *ProxyConn) Header() (*ProxyHeader, error) {
+	pc.once.Do(func() {
+		err := pc.Conn.SetReadDeadline(time.Now().Add(pc.timeout))
+		if err != nil {
+			pc.err = err
+			return
+		}
+		pc.header, pc.err = readProxyHeader(pc.reader)
+		if pc.err != nil {
+			return
+		}
+		pc.err = pc.Conn.SetReadDeadline(time.Time{})
+	})
+	return pc.header, pc.err
+}
+
+// Read reads data from connection after PROXY protocol header
+func (pc *ProxyConn) Read(b []byte) (int, error) {
+	_, err := pc.Header()
+	if err != nil {
+		return 0, err
+	}
+	return pc.reader.Read(b)
+}
+
+// RemoteAddr returns address of client connected to load balancer
+func (pc *ProxyConn) RemoteAddr() net.Addr {
+	header, err := pc.Header()
+	if err != nil || header.Local || header.SourceAddr == nil {
+		return pc.Conn.RemoteAddr()
+	}
+	return header.SourceAddr
+}
+
+// LocalAddr returns address of load balancer client connected to
+func (pc *ProxyConn) LocalAddr() net.Addr {
+	header, err := pc.Header()
+	if err != nil || header.Local || header.DestinationAddr == nil {
+		return pc.Conn.LocalAddr()
+	}
+	return header.DestinationAddr
+}
+
+// proxyConnection extracts ProxyConn from connection, which can be wrapped by TLS
+func proxyConnection(c net.Conn) (*ProxyConn, bool) {
+	if tlsConn, ok := c.(*tls.Conn); ok {
+		c = tlsConn.NetConn()
+	}
+	pc, ok := c.(*ProxyConn)
+	return pc, ok
+}
+
+func readProxyHeader(reader *bufio.Reader) (*ProxyHeader, error) {
+	signature, err := reader.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(signature, proxyV2Signature) {
+		return readProxyHeaderV2(reader)
+	}
+	if bytes.HasPrefix(signature, []byte("PROXY ")) {
+		return readProxyHeaderV1(reader)
+	}
+	return nil, ErrProxyHeaderMissing
+}
+
+func readProxyHeaderV1(reader *bufio.Reader) (*ProxyHeader, error) {
+	line := make([]byte, 0, maxProxyV1HeaderLength)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= maxProxyV1HeaderLength {
+			return nil, fmt.Errorf("%w : v1 header is too long", ErrProxyHeaderMalformed)
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%w : v1 header does not end with CRLF", ErrProxyHeaderMalformed)
+	}
+	fields := strings.Fields(string(line))
+	header := ProxyHeader{Version: 1}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		header.Local = true
+		return &header, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("%w : wrong number of fields in v1 header", ErrProxyHeaderMalformed)
+	}
+	sourceIP := net.ParseIP(fields[2])
+	destinationIP := net.ParseIP(fields[3])
+	if sourceIP == nil || destinationIP == nil {
+		return nil, fmt.Errorf("%w : malformed address in v1 header", ErrProxyHeaderMalformed)
+	}
+	switch fields[1] {
+	case "TCP4":
+		if sourceIP.To4() == nil || destinationIP.To4() == nil {
+			return nil, fmt.Errorf("%w : TCP4 header has not IPv4 address", ErrProxyHeaderMalformed)
+		}
+	case "TCP6":
+		break
+	default:
+		return nil, fmt.Errorf("%w : unsupported protocol %s in v1 header", ErrProxyHeaderMalformed, fields[1])
+	}
+	sourcePort, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w : malformed source port in v1 header", ErrProxyHeaderMalformed)
+	}
+	destinationPort, err := strconv.ParseUint(fields[5], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w : malformed destination port in v1 header", ErrProxyHeaderMalformed)
+	}
+	header.SourceAddr = &net.TCPAddr{IP: sourceIP, Port: int(sourcePort)}
+	header.DestinationAddr = &net.TCPAddr{IP: destinationIP, Port: int(destinationPort)}
+	return &header, nil
+}
+
+func readProxyHeaderV2(reader *bufio.Reader) (*ProxyHeader, error) {
+	fixed := make([]byte, 16)
+	_, err := io.ReadFull(reader, fixed)
+	if err != nil {
+		return nil, err
+	}
+	if fixed[12]>>4 != 2 {
+		return nil, fmt.Errorf("%w : unsupported version %v", ErrProxyHeaderMalformed, fixed[12]>>4)
+	}
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	_, err = io.ReadFull(reader, payload)
+	if err != nil {
+		return nil, err
+	}
+	header := ProxyHeader{Version: 2}
+	switch fixed[12] & 0x0F {
+	case 0x00: // LOCAL
+		header.Local = true
+		return &header, nil
+	case 0x01: // PROXY
+		break
+	default:
+		return nil, fmt.Errorf("%w : unsupported command %v", ErrProxyHeaderMalformed, fixed[12]&0x0F)
+	}
+	var addressesLength int
+	switch fixed[13] {
+	case 0x11: // TCP over IPv4
+		addressesLength = 12
+		if len(payload) < addressesLength {
+			return nil, fmt.Errorf("%w : IPv4 addresses are truncated", ErrProxyHeaderMalformed)
+		}
+		header.SourceAddr = &net.TCPAddr{
+			IP:   net.IP(payload[0:4]),
+			Port: int(binary.BigEndian.Uint16(payload[8:10])),
+		}
+		header.DestinationAddr = &net.TCPAddr{
+			IP:   net.IP(payload[4:8]),
+			Port: int(binary.BigEndian.Uint16(payload[10:12])),
+		}
+	case 0x21: // TCP over IPv6
+		addressesLength = 36
+		if len(payload) < addressesLength {
+			return nil, fmt.Errorf("%w : IPv6 addresses are truncated", ErrProxyHeaderMalformed)
+		}
+		header.SourceAddr = &net.TCPAddr{
+			IP:   net.IP(payload[0:16]),
+			Port: int(binary.BigEndian.Uint16(payload[32:34])),
+		}
+		header.DestinationAddr = &net.TCPAddr{
+			IP:   net.IP(payload[16:32]),
+			Port: int(binary.BigEndian.Uint16(payload[34:36])),
+		}
+	case 0x00: // UNSPEC, addresses should be ignored
+		header.Local = true
+		return &header, nil
+	default:
+		return nil, fmt.Errorf("%w : unsupported address family and protocol %v", ErrProxyHeaderMalformed, fixed[13])
+	}
+	header.TLVs, err = parseProxyTLVs(payload[addressesLength:])
+	if err != nil {
+		return nil, err
+	}
+	header.ALPN = string(header.TLVs[proxyTLVTypeALPN])
+	header.Authority = string(header.TLVs[proxyTLVTypeAuthority])
+	ssl, found := header.TLVs[proxyTLVTypeSSL]
+	if found {
+		header.TLS, err = parseProxyTLS(ssl)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &header, nil
+}
+
+func parseProxyTLVs(raw []byte) (map[byte][]byte, error) {
+	tlvs := make(map[byte][]byte, 0)
+	for len(raw) > 0 {
+		if len(raw) < 3 {
+			return nil, fmt.Errorf("%w : TLV is truncated", ErrProxyHeaderMalformed)
+		}
+		length := int(binary.BigEndian.Uint16(raw[1:3]))
+		if len(raw) < 3+length {
+			return nil, fmt.Errorf("%w : TLV value is truncated", ErrProxyHeaderMalformed)
+		}
+		tlvs[raw[0]] = raw[3 : 3+length]
+		raw = raw[3+length:]
+	}
+	return tlvs, nil
+}
+
+func parseProxyTLS(raw []byte) (*ProxyTLS, error) {
+	if len(raw) < 5 {
+		return nil, fmt.Errorf("%w : SSL TLV is truncated", ErrProxyHeaderMalformed)
+	}
+	subTLVs, err := parseProxyTLVs(raw[5:])
+	if err != nil {
+		return nil, err
+	}
+	return &ProxyTLS{
+		Client:             raw[0],
+		Verified:           binary.BigEndian.Uint32(raw[1:5]) == 0,
+		Version:            string(subTLVs[proxyTLVSubTypeSSLVersion]),
+		CommonName:         string(subTLVs[proxyTLVSubTypeSSLCN]),
+		Cipher:             string(subTLVs[proxyTLVSubTypeSSLCipher]),
+		SignatureAlgorithm: string(subTLVs[proxyTLVSubTypeSSLSigAlg]),
+		KeyAlgorithm:       string(subTLVs[proxyTLVSubTypeSSLKeyAlg]),
+	}, nil
+}
@@ -0,0 +1,226 @@
+package msmtpd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"net/smtp"
+	"testing"
+)
+
+// runTestServerWithProxyListener runs test server behind ProxyListener trusting networks provided
+func runTestServerWithProxyListener(t *testing.T, server *Server, trustedNetworks ...string) (addr string, closer func()) {
+	server.Logger = &TestLogger{Suite: t}
+	server.SkipResolvingPTR = true
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	pl, err := NewProxyListener(ln, trustedNetworks...)
+	if err != nil {
+		t.Fatalf("%s : while making proxy listener", err)
+	}
+	go func() {
+		server.Serve(pl)
+	}()
+	return ln.Addr().String(), func() {
+		ln.Close()
+	}
+}
+
+// makeProxyV2Header makes PROXY protocol v2 header for TCP over IPv4 with TLVs provided
+func makeProxyV2Header(source, destination *net.TCPAddr, tlvs ...[]byte) []byte {
+	payload := bytes.NewBuffer(nil)
+	payload.Write(source.IP.To4())
+	payload.Write(destination.IP.To4())
+	binary.Write(payload, binary.BigEndian, uint16(source.Port))
+	binary.Write(payload, binary.BigEndian, uint16(destination.Port))
+	for i := range tlvs {
+		payload.Write(tlvs[i])
+	}
+	header := bytes.NewBuffer(nil)
+	header.Write(proxyV2Signature)
+	header.WriteByte(0x21) // version 2, PROXY command
+	header.WriteByte(0x11) // TCP over IPv4
+	binary.Write(header, binary.BigEndian, uint16(payload.Len()))
+	header.Write(payload.Bytes())
+	return header.Bytes()
+}
+
+// makeProxyTLV makes Type-Length-Value record for PROXY protocol v2 header
+func makeProxyTLV(kind byte, value []byte) []byte {
+	tlv := []byte{kind, 0, 0}
+	binary.BigEndian.PutUint16(tlv[1:3], uint16(len(value)))
+	return append(tlv, value...)
+}
+
+func dialWithProxyHeader(t *testing.T, addr string, header []byte) *smtp.Client {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	_, err = conn.Write(header)
+	if err != nil {
+		t.Fatalf("%s : while sending proxy header", err)
+	}
+	c, err := smtp.NewClient(conn, "localhost")
+	if err != nil {
+		t.Fatalf("%s : while making SMTP client", err)
+	}
+	return c
+}
+
+func TestProxyListenerV1(t *testing.T) {
+	var checked bool
+	addr, closer := runTestServerWithProxyListener(t, &Server{
+		ConnectionCheckers: []ConnectionChecker{
+			func(_ context.Context, tr *Transaction) error {
+				if tr.Addr.String() != "8.8.8.8:443" {
+					t.Errorf("wrong remote address %s", tr.Addr.String())
+				}
+				if tr.ProxyHeader == nil || tr.ProxyHeader.Version != 1 {
+					t.Errorf("wrong proxy header %v", tr.ProxyHeader)
+				}
+				checked = true
+				return nil
+			},
+		},
+	}, "127.0.0.0/8")
+	defer closer()
+	c := dialWithProxyHeader(t, addr, []byte("PROXY TCP4 8.8.8.8 127.0.0.1 443 25\r\n"))
+	if err := c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err := c.Quit(); err != nil {
+		t.Errorf("QUIT failed: %v", err)
+	}
+	if !checked {
+		t.Errorf("connection checker is not called")
+	}
+}
+
+func TestProxyListenerV2(t *testing.T) {
+	var checked bool
+	ssl := []byte{0x01, 0, 0, 0, 0}
+	ssl = append(ssl, makeProxyTLV(proxyTLVSubTypeSSLVersion, []byte("TLSv1.3"))...)
+	ssl = append(ssl, makeProxyTLV(proxyTLVSubTypeSSLCN, []byte("client.example.org"))...)
+	header := makeProxyV2Header(
+		&net.TCPAddr{IP: net.ParseIP("8.8.4.4"), Port: 32000},
+		&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 465},
+		makeProxyTLV(proxyTLVTypeALPN, []byte("smtp")),
+		makeProxyTLV(proxyTLVTypeAuthority, []byte("mx.example.org")),
+		makeProxyTLV(proxyTLVTypeSSL, ssl),
+		makeProxyTLV(0xEA, []byte("\x01vpce-0123456789abcdef")),
+	)
+	addr, closer := runTestServerWithProxyListener(t, &Server{
+		ConnectionCheckers: []ConnectionChecker{
+			func(_ context.Context, tr *Transaction) error {
+				if tr.Addr.String() != "8.8.4.4:32000" {
+					t.Errorf("wrong remote address %s", tr.Addr.String())
+				}
+				if tr.ProxyHeader == nil {
+					t.Errorf("proxy header is missing")
+					return nil
+				}
+				if tr.ProxyHeader.Version != 2 {
+					t.Errorf("wrong proxy header version %v", tr.ProxyHeader.Version)
+				}
+				if tr.ProxyHeader.DestinationAddr.String() != "10.0.0.1:465" {
+					t.Errorf("wrong destination address %s", tr.ProxyHeader.DestinationAddr)
+				}
+				if tr.ProxyHeader.ALPN != "smtp" {
+					t.Errorf("wrong ALPN %s", tr.ProxyHeader.ALPN)
+				}
+				if tr.ProxyHeader.Authority != "mx.example.org" {
+					t.Errorf("wrong authority %s", tr.ProxyHeader.Authority)
+				}
+				if tr.ProxyHeader.TLS == nil {
+					t.Errorf("TLS information is missing")
+					return nil
+				}
+				if !tr.ProxyHeader.TLS.Verified {
+					t.Errorf("client certificate is not verified")
+				}
+				if tr.ProxyHeader.TLS.Version != "TLSv1.3" {
+					t.Errorf("wrong TLS version %s", tr.ProxyHeader.TLS.Version)
+				}
+				if tr.ProxyHeader.TLS.CommonName != "client.example.org" {
+					t.Errorf("wrong client certificate common name %s", tr.ProxyHeader.TLS.CommonName)
+				}
+				if string(tr.ProxyHeader.TLVs[0xEA]) != "\x01vpce-0123456789abcdef" {
+					t.Errorf("wrong AWS VPC endpoint TLV %q", tr.ProxyHeader.TLVs[0xEA])
+				}
+				checked = true
+				return nil
+			},
+		},
+	}, "127.0.0.0/8")
+	defer closer()
+	c := dialWithProxyHeader(t, addr, header)
+	if err := c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err := c.Quit(); err != nil {
+		t.Errorf("QUIT failed: %v", err)
+	}
+	if !checked {
+		t.Errorf("connection checker is not called")
+	}
+}
+
+func TestProxyListenerUntrustedSource(t *testing.T) {
+	addr, closer := runTestServerWithProxyListener(t, &Server{
+		ConnectionCheckers: []ConnectionChecker{
+			func(_ context.Context, tr *Transaction) error {
+				if tr.ProxyHeader != nil {
+					t.Errorf("proxy header accepted from untrusted source")
+				}
+				if tr.Addr.(*net.TCPAddr).IP.String() != "127.0.0.1" {
+					t.Errorf("wrong remote address %s", tr.Addr.String())
+				}
+				return nil
+			},
+		},
+	}, "10.0.0.0/8")
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Errorf("Dial failed: %v", err)
+	}
+	if err = c.Text.PrintfLine("PROXY TCP4 8.8.8.8 127.0.0.1 443 25"); err != nil {
+		t.Errorf("%s : while sending proxy header", err)
+	}
+	if _, _, err = c.Text.ReadResponse(550); err != nil {
+		t.Errorf("%s : proxy header is not rejected", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("QUIT failed: %v", err)
+	}
+}
+
+func TestProxyListenerMalformedHeader(t *testing.T) {
+	addr, closer := runTestServerWithProxyListener(t, &Server{
+		ConnectionCheckers: []ConnectionChecker{
+			func(_ context.Context, tr *Transaction) error {
+				t.Errorf("connection with malformed proxy header is accepted")
+				return nil
+			},
+		},
+	}, "127.0.0.0/8")
+	defer closer()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte("PROXY TCP4 8.8.8.8 somewhere 443 25\r\n"))
+	if err != nil {
+		t.Errorf("%s : while sending proxy header", err)
+	}
+	buf := make([]byte, 512)
+	n, err := conn.Read(buf)
+	if err == nil {
+		t.Errorf("connection is not closed, server sent %q", buf[:n])
+	}
+}
@@ -0,0 +1,197 @@
+package msmtpd
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Good read - https://www.rfc-editor.org/rfc/rfc4954 and https://www.rfc-editor.org/rfc/rfc4422
+// Client starts authentication exchange by `AUTH <mechanism> [initial-response]` command, then
+// server sends base64 encoded challenges with 334 code and client answers them with base64 encoded responses,
+// until server accepts (235) or rejects (535) credentials. Client can cancel exchange by sending `*`.
+
+// SASLServer is server side of single authentication exchange
+type SASLServer interface {
+	// Next takes decoded client response and returns challenge to be sent to client. Response is nil,
+	// if client has not provided initial response with AUTH command. When exchange is completed successfully,
+	// done should be true, and Transaction.Username should be set to identity authenticated.
+	// Errors returned are sent to client as ErrorSMTP responses and exchange is aborted.
+	Next(ctx context.Context, response []byte) (challenge []byte, done bool, err error)
+}
+
+// SASLMechanism is Simple Authentication and Security Layer mechanism used by AUTH command
+type SASLMechanism interface {
+	// Name of mechanism as it is advertised in EHLO response, like PLAIN or SCRAM-SHA-256
+	Name() string
+	// Start begins new authentication exchange for transaction
+	Start(transaction *Transaction) SASLServer
+}
+
+// PasswordLookupFunc returns plain text password of user, it is used by mechanisms like CRAM-MD5,
+// where client does not send password to server
+type PasswordLookupFunc func(ctx context.Context, transaction *Transaction, username string) (password string, err error)
+
+// SASLServerFunc allows to use ordinary function as SASLServer
+type SASLServerFunc func(ctx context.Context, response []byte) (challenge []byte, done bool, err error)
+
+// Next calls f(ctx, response)
+func (f SASLServerFunc) Next(ctx context.Context, response []byte) (challenge []byte, done bool, err error) {
+	return f(ctx, response)
+}
+
+// saslMechanism is SASLMechanism with name and function to start exchange
+type saslMechanism struct {
+	name  string
+	start func(transaction *Transaction) SASLServer
+}
+
+// Name returns mechanism name
+func (m saslMechanism) Name() string {
+	return m.name
+}
+
+// Start begins new authentication exchange for transaction
+func (m saslMechanism) Start(transaction *Transaction) SASLServer {
+	return m.start(transaction)
+}
+
+// NewSASLMechanism makes SASLMechanism with name provided, which uses start function
+// to begin authentication exchange
+func NewSASLMechanism(name string, start func(transaction *Transaction) SASLServer) SASLMechanism {
+	return saslMechanism{name: strings.ToUpper(name), start: start}
+}
+
+// PlainMechanism is PLAIN mechanism (RFC 4616), which checks username and password by authenticator
+func PlainMechanism(authenticator AuthenticatorFunc) SASLMechanism {
+	return NewSASLMechanism("PLAIN", func(transaction *Transaction) SASLServer {
+		return SASLServerFunc(func(ctx context.Context, response []byte) ([]byte, bool, error) {
+			if response == nil {
+				return []byte{}, false, nil
+			}
+			parts := bytes.Split(response, []byte{0})
+			if len(parts) != 3 {
+				transaction.Hate(missingParameterPenalty)
+				return nil, false, ErrAuthenticationCredentialsMalformed
+			}
+			err := transaction.authenticate(ctx, authenticator, "PLAIN", string(parts[1]), string(parts[2]))
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, true, nil
+		})
+	})
+}
+
+// LoginMechanism is obsolete, but widely used LOGIN mechanism, which checks username and password by authenticator
+func LoginMechanism(authenticator AuthenticatorFunc) SASLMechanism {
+	return NewSASLMechanism("LOGIN", func(transaction *Transaction) SASLServer {
+		var username string
+		var usernameProvided bool
+		return SASLServerFunc(func(ctx context.Context, response []byte) ([]byte, bool, error) {
+			if response == nil {
+				return []byte("Username:"), false, nil
+			}
+			if !usernameProvided {
+				username = string(response)
+				usernameProvided = true
+				return []byte("Password:"), false, nil
+			}
+			err := transaction.authenticate(ctx, authenticator, "LOGIN", username, string(response))
+			if err != nil {
+				return nil, false, err
+			}
+			return nil, true, nil
+		})
+	})
+}
+
+// CramMD5Mechanism is CRAM-MD5 mechanism (RFC 2195), it requires plain text password of user
+// to be returned by lookup function
+func CramMD5Mechanism(lookup PasswordLookupFunc) SASLMechanism {
+	return NewSASLMechanism("CRAM-MD5", func(transaction *Transaction) SASLServer {
+		var challenge []byte
+		return SASLServerFunc(func(ctx context.Context, response []byte) ([]byte, bool, error) {
+			if challenge == nil {
+				nonce := make([]byte, 8)
+				_, err := rand.Read(nonce)
+				if err != nil {
+					return nil, false, err
+				}
+				challenge = []byte(fmt.Sprintf("<%x.%d@%s>",
+					nonce, time.Now().Unix(), transaction.server.Hostname))
+				return challenge, false, nil
+			}
+			username, digest, found := strings.Cut(string(response), " ")
+			if !found || username == "" {
+				transaction.Hate(missingParameterPenalty)
+				return nil, false, ErrAuthenticationCredentialsMalformed
+			}
+			transaction.LogDebug("Trying to authorise %s using mechanism CRAM-MD5", username)
+			password, err := lookup(ctx, transaction, username)
+			if err != nil {
+				return nil, false, err
+			}
+			expected := hmac.New(md5.New, []byte(password))
+			expected.Write(challenge)
+			if !hmac.Equal([]byte(hex.EncodeToString(expected.Sum(nil))), []byte(strings.ToLower(digest))) {
+				return nil, false, ErrAuthenticationCredentialsInvalid
+			}
+			transaction.Username = username
+			return nil, true, nil
+		})
+	})
+}
+
+// authenticate checks username and password by authenticator, and, if they are valid,
+// saves them into transaction
+func (t *Transaction) authenticate(ctx context.Context, authenticator AuthenticatorFunc, mechanism, username, password string) error {
+	if username == "" || password == "" {
+		t.Hate(missingParameterPenalty)
+		return ErrAuthenticationCredentialsMalformed
+	}
+	t.LogDebug("Trying to authorise %s with password %s using mechanism %s",
+		username, mask(password), mechanism,
+	)
+	err := authenticator(ctx, t, username, password)
+	if err != nil {
+		return err
+	}
+	t.Username = username
+	// i know saving password here is security risk, but we can implement something like
+	// Haraka plugin to prevent credential leaks
+	// https://haraka.github.io/plugins/prevent_credential_leaks
+	t.Password = password
+	return nil
+}
+
+// authenticationSupported returns true, if client can authenticate via AUTH command on listener
+// it is connected to
+func (t *Transaction) authenticationSupported() bool {
+	return len(t.server.SASLMechanisms) > 0 && t.listener.authenticationEnabled()
+}
+
+// saslMechanism returns mechanism with name provided from Server.SASLMechanisms
+func (srv *Server) saslMechanism(name string) (SASLMechanism, bool) {
+	for i := range srv.SASLMechanisms {
+		if strings.EqualFold(srv.SASLMechanisms[i].Name(), name) {
+			return srv.SASLMechanisms[i], true
+		}
+	}
+	return nil, false
+}
+
+// saslMechanismNames returns names of mechanisms to be advertised in EHLO response
+func (srv *Server) saslMechanismNames() []string {
+	names := make([]string, 0, len(srv.SASLMechanisms))
+	for i := range srv.SASLMechanisms {
+		names = append(names, srv.SASLMechanisms[i].Name())
+	}
+	return names
+}
@@ -0,0 +1,154 @@
+package msmtpd
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// Good read - https://www.rfc-editor.org/rfc/rfc4422#appendix-A
+// EXTERNAL mechanism means client is authenticated by external channel, in our case
+// by TLS client certificate verified against TLSConfig.ClientCAs. Client can provide
+// authorization identity, which should match username certificate is mapped to,
+// or empty response `=` to use mapped username as is.
+
+// CertificateMapperFunc maps verified TLS client certificate to username.
+// Empty username without error means certificate is not known.
+type CertificateMapperFunc func(ctx context.Context, transaction *Transaction, certificate *x509.Certificate) (username string, err error)
+
+// CertificateMapping is table mapping TLS client certificates to usernames. Its Map method
+// can be used as CertificateMapperFunc. Fingerprints are checked first, then subjects,
+// then subject alternative names
+type CertificateMapping struct {
+	// Fingerprints maps hex encoded SHA-256 fingerprints of certificates to usernames,
+	// case and colons are ignored, so both `AB:CD:...` and `abcd...` are accepted
+	Fingerprints map[string]string
+	// Subjects maps certificate subject distinguished names, like `CN=app,O=Example`,
+	// or subject common names, like `app`, to usernames
+	Subjects map[string]string
+	// SANs maps DNS names, email addresses, IP addresses and URIs from certificate
+	// subject alternative names to usernames
+	SANs map[string]string
+}
+
+// Map returns username certificate is mapped to, or empty string, if certificate is not known
+func (m CertificateMapping) Map(_ context.Context, _ *Transaction, certificate *x509.Certificate) (string, error) {
+	if certificate == nil {
+		return "", nil
+	}
+	if len(m.Fingerprints) > 0 {
+		fingerprint := CertificateFingerprint(certificate)
+		for k, username := range m.Fingerprints {
+			if strings.ToLower(strings.ReplaceAll(k, ":", "")) == fingerprint {
+				return username, nil
+			}
+		}
+	}
+	if username, found := m.Subjects[certificate.Subject.String()]; found {
+		return username, nil
+	}
+	if username, found := m.Subjects[certificate.Subject.CommonName]; found && certificate.Subject.CommonName != "" {
+		return username, nil
+	}
+	sans := make([]string, 0, len(certificate.DNSNames)+len(certificate.EmailAddresses)+
+		len(certificate.IPAddresses)+len(certificate.URIs))
+	sans = append(sans, certificate.DNSNames...)
+	sans = append(sans, certificate.EmailAddresses...)
+	for i := range certificate.IPAddresses {
+		sans = append(sans, certificate.IPAddresses[i].String())
+	}
+	for i := range certificate.URIs {
+		sans = append(sans, certificate.URIs[i].String())
+	}
+	for i := range sans {
+		if username, found := m.SANs[sans[i]]; found {
+			return username, nil
+		}
+	}
+	return "", nil
+}
+
+// CertificateFingerprint returns lower case hex encoded SHA-256 fingerprint of certificate
+func CertificateFingerprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// ClientCertificate returns TLS client certificate, if client provided it and it was verified
+// against TLSConfig.ClientCAs, or nil otherwise
+func (t *Transaction) ClientCertificate() *x509.Certificate {
+	if t.TLS == nil || len(t.TLS.VerifiedChains) == 0 || len(t.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return t.TLS.VerifiedChains[0][0]
+}
+
+// ExternalMechanism is EXTERNAL mechanism, which authenticates clients by verified
+// TLS client certificates mapped to usernames by mapper
+func ExternalMechanism(mapper CertificateMapperFunc) SASLMechanism {
+	return NewSASLMechanism("EXTERNAL", func(transaction *Transaction) SASLServer {
+		return SASLServerFunc(func(ctx context.Context, response []byte) ([]byte, bool, error) {
+			if response == nil {
+				return []byte{}, false, nil
+			}
+			username, err := transaction.mapClientCertificate(ctx, mapper)
+			if err != nil {
+				return nil, false, err
+			}
+			if username == "" {
+				return nil, false, ErrAuthenticationCredentialsInvalid
+			}
+			if len(response) > 0 && string(response) != username {
+				transaction.LogWarn("Certificate is mapped to %s, but client wants to act as %s",
+					username, string(response))
+				return nil, false, ErrAuthenticationCredentialsInvalid
+			}
+			transaction.Username = username
+			return nil, true, nil
+		})
+	})
+}
+
+// mapClientCertificate maps verified TLS client certificate to username by mapper provided,
+// it returns empty string, if there is no certificate or it is not known
+func (t *Transaction) mapClientCertificate(ctx context.Context, mapper CertificateMapperFunc) (string, error) {
+	certificate := t.ClientCertificate()
+	if certificate == nil {
+		t.LogDebug("Client has not provided verified TLS certificate")
+		return "", nil
+	}
+	username, err := mapper(ctx, t, certificate)
+	if err != nil {
+		return "", err
+	}
+	if username == "" {
+		t.LogDebug("TLS client certificate %s with fingerprint %s is not mapped to any user",
+			certificate.Subject.String(), CertificateFingerprint(certificate))
+		return "", nil
+	}
+	t.LogDebug("TLS client certificate %s is mapped to %s", certificate.Subject.String(), username)
+	return username, nil
+}
+
+// authenticateByCertificate sets Transaction.Username, if client provided verified TLS certificate
+// Server.CertificateMapper maps to user
+func (t *Transaction) authenticateByCertificate(ctx context.Context) {
+	if t.server.CertificateMapper == nil || t.Username != "" || !t.listener.authenticationEnabled() {
+		return
+	}
+	username, err := t.mapClientCertificate(ctx, t.server.CertificateMapper)
+	if err != nil {
+		t.LogError(err, "while mapping TLS client certificate to user")
+		return
+	}
+	if username == "" {
+		return
+	}
+	t.LogInfo("Authenticated as %s by TLS client certificate", username)
+	t.Username = username
+	t.Span.SetAttributes(semconv.UserName(username))
+}
@@ -0,0 +1,166 @@
+package msmtpd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+// makeTLSWithClientCertificates makes server TLS config, which verifies client certificates
+// signed by localhost certificate, and client TLS config presenting it
+func makeTLSWithClientCertificates(t *testing.T) (serverConfig, clientConfig *tls.Config) {
+	serverConfig, err := internal.MakeTLSForLocalhost()
+	if err != nil {
+		t.Fatalf("%s : while loading test certs for localhost", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(internal.LocalhostCert) {
+		t.Fatalf("error adding localhost certificate to pool")
+	}
+	serverConfig.ClientCAs = pool
+	serverConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	clientConfig = &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       serverConfig.Certificates,
+	}
+	return serverConfig, clientConfig
+}
+
+func localhostCertificate(t *testing.T) *x509.Certificate {
+	block, _ := pem.Decode(internal.LocalhostCert)
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("%s : while parsing localhost certificate", err)
+	}
+	return certificate
+}
+
+func TestCertificateMapping(t *testing.T) {
+	certificate := localhostCertificate(t)
+	fingerprint := CertificateFingerprint(certificate)
+	testCases := []struct {
+		name     string
+		mapping  CertificateMapping
+		expected string
+	}{
+		{"empty", CertificateMapping{}, ""},
+		{"fingerprint", CertificateMapping{Fingerprints: map[string]string{fingerprint: "app1"}}, "app1"},
+		{"fingerprint with colons", CertificateMapping{Fingerprints: map[string]string{
+			strings.ToUpper(fingerprint[:2] + ":" + fingerprint[2:]): "app2",
+		}}, "app2"},
+		{"subject", CertificateMapping{Subjects: map[string]string{
+			"CN=localhost,O=Internet Widgits Pty Ltd,ST=Some-State,C=AU": "app3",
+		}}, "app3"},
+		{"common name", CertificateMapping{Subjects: map[string]string{"localhost": "app4"}}, "app4"},
+		{"unknown", CertificateMapping{
+			Subjects: map[string]string{"example.org": "app5"},
+			SANs:     map[string]string{"localhost": "app5"},
+		}, ""},
+	}
+	for _, tc := range testCases {
+		username, err := tc.mapping.Map(context.TODO(), nil, certificate)
+		if err != nil {
+			t.Errorf("%s : while mapping certificate in case %s", err, tc.name)
+		}
+		if username != tc.expected {
+			t.Errorf("wrong username %s instead of %s in case %s", username, tc.expected, tc.name)
+		}
+	}
+}
+
+func TestCertificateMapperAuthenticatesAfterSTARTTLS(t *testing.T) {
+	serverConfig, clientConfig := makeTLSWithClientCertificates(t)
+	addr, closer := RunTestServerWithoutTLS(t, &Server{
+		TLSConfig: serverConfig,
+		CertificateMapper: CertificateMapping{
+			Subjects: map[string]string{"localhost": "internal-app"},
+		}.Map,
+		SenderCheckers: []SenderChecker{
+			func(_ context.Context, tr *Transaction) error {
+				if tr.Username != "internal-app" {
+					t.Errorf("wrong username %s", tr.Username)
+				}
+				return nil
+			},
+		},
+	})
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.StartTLS(clientConfig); err != nil {
+		t.Fatalf("STARTTLS failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed for client with certificate: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
+
+func TestCertificateMapperRequiresAuthentication(t *testing.T) {
+	serverConfig, _ := makeTLSWithClientCertificates(t)
+	addr, closer := RunTestServerWithoutTLS(t, &Server{
+		TLSConfig: serverConfig,
+		CertificateMapper: CertificateMapping{
+			Subjects: map[string]string{"localhost": "internal-app"},
+		}.Map,
+	})
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("STARTTLS failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err == nil {
+		t.Errorf("MAIL didn't fail for client without certificate")
+	}
+}
+
+func TestAuthExternal(t *testing.T) {
+	serverConfig, clientConfig := makeTLSWithClientCertificates(t)
+	mapping := CertificateMapping{
+		Fingerprints: map[string]string{CertificateFingerprint(localhostCertificate(t)): "internal-app"},
+	}
+	addr, closer := RunTestServerWithoutTLS(t, &Server{
+		TLSConfig:      serverConfig,
+		SASLMechanisms: []SASLMechanism{ExternalMechanism(mapping.Map)},
+	})
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.StartTLS(clientConfig); err != nil {
+		t.Fatalf("STARTTLS failed: %v", err)
+	}
+	if _, mechanisms := c.Extension("AUTH"); mechanisms != "EXTERNAL" {
+		t.Errorf("wrong mechanisms advertised: %s", mechanisms)
+	}
+	if err = c.Mail("sender@example.org"); err == nil {
+		t.Errorf("MAIL didn't fail before AUTH EXTERNAL")
+	}
+	// `c29tZWJvZHk=` is `somebody`
+	if err = internal.DoCommand(c.Text, 535, "AUTH EXTERNAL c29tZWJvZHk="); err != nil {
+		t.Errorf("AUTH EXTERNAL with wrong authorization identity didn't fail: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 235, "AUTH EXTERNAL ="); err != nil {
+		t.Errorf("AUTH EXTERNAL failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed after AUTH EXTERNAL: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package msmtpd
+
+import (
+	"context"
+	"strings"
+)
+
+// Good read - https://www.rfc-editor.org/rfc/rfc7628 and https://developers.google.com/gmail/imap/xoauth2-protocol
+// Example of OAUTHBEARER initial response:
+// `n,a=user@example.com,^Ahost=server.example.com^Aport=587^Aauth=Bearer vF9dft4qmTc2Nvb3RlckBhbHRhdmlzdGEuY29tCg==^A^A`
+// Example of XOAUTH2 initial response:
+// `user=someuser@example.com^Aauth=Bearer ya29.vF9dft4qmTc2Nvb3RlckBsYXRlbnRh^A^A`
+// When token is rejected, server sends JSON error as challenge, client answers it with
+// dummy response and server rejects AUTH command with 535 reply.
+
+// TokenValidatorFunc checks OAuth 2.0 bearer token of user, if token is not valid, error should be returned
+type TokenValidatorFunc func(ctx context.Context, transaction *Transaction, username, token string) error
+
+// oauthBearerFailure is challenge we send, when token is rejected via OAUTHBEARER mechanism
+const oauthBearerFailure = `{"status":"invalid_token","schemes":"bearer","scope":""}`
+
+// xoauth2Failure is challenge we send, when token is rejected via XOAUTH2 mechanism
+const xoauth2Failure = `{"status":"401","schemes":"bearer","scope":""}`
+
+// OAuthBearerMechanism is OAUTHBEARER mechanism (RFC 7628), which checks bearer tokens by validator.
+// Client must provide authorization identity, which is used as username.
+func OAuthBearerMechanism(validator TokenValidatorFunc) SASLMechanism {
+	return NewSASLMechanism("OAUTHBEARER", func(transaction *Transaction) SASLServer {
+		return oauthServer(transaction, "OAUTHBEARER", validator, oauthBearerFailure, parseOAuthBearerResponse)
+	})
+}
+
+// XOAuth2Mechanism is XOAUTH2 mechanism used by Google and Microsoft, which checks bearer tokens by validator
+func XOAuth2Mechanism(validator TokenValidatorFunc) SASLMechanism {
+	return NewSASLMechanism("XOAUTH2", func(transaction *Transaction) SASLServer {
+		return oauthServer(transaction, "XOAUTH2", validator, xoauth2Failure, parseXOAuth2Response)
+	})
+}
+
+// oauthServer makes SASLServer for OAUTHBEARER and XOAUTH2 mechanisms, which differ only
+// by format of client response and error challenge
+func oauthServer(transaction *Transaction, mechanism string, validator TokenValidatorFunc,
+	failure string, parse func(response string) (username, token string, ok bool)) SASLServer {
+	var validationErr error
+	return SASLServerFunc(func(ctx context.Context, response []byte) ([]byte, bool, error) {
+		if validationErr != nil {
+			// client acknowledged error challenge, so we can reject it
+			return nil, false, validationErr
+		}
+		if response == nil {
+			return []byte{}, false, nil
+		}
+		username, token, ok := parse(string(response))
+		if !ok || username == "" || token == "" {
+			transaction.Hate(missingParameterPenalty)
+			return nil, false, ErrAuthenticationCredentialsMalformed
+		}
+		transaction.LogDebug("Trying to authorise %s with token %s using mechanism %s",
+			username, mask(token), mechanism,
+		)
+		validationErr = validator(ctx, transaction, username, token)
+		if validationErr != nil {
+			transaction.LogDebug("%s : while validating token of %s", validationErr, username)
+			return []byte(failure), false, nil
+		}
+		transaction.Username = username
+		return nil, true, nil
+	})
+}
+
+// parseOAuthBearerResponse extracts authorization identity and token from OAUTHBEARER client response
+func parseOAuthBearerResponse(response string) (username, token string, ok bool) {
+	gs2Header, rest, found := strings.Cut(response, "\x01")
+	if !found {
+		return "", "", false
+	}
+	// gs2-header is `n,a=user@example.com,`, channel binding is not supported
+	parts := strings.Split(gs2Header, ",")
+	if len(parts) != 3 || parts[0] != "n" && parts[0] != "y" {
+		return "", "", false
+	}
+	if strings.HasPrefix(parts[1], "a=") {
+		username, _ = decodeScramUsername(strings.TrimPrefix(parts[1], "a="))
+	}
+	token, ok = parseOAuthToken(rest)
+	return username, token, ok
+}
+
+// parseXOAuth2Response extracts username and token from XOAUTH2 client response
+func parseXOAuth2Response(response string) (username, token string, ok bool) {
+	for _, pair := range strings.Split(response, "\x01") {
+		if value, found := strings.CutPrefix(pair, "user="); found {
+			username = value
+		}
+	}
+	token, ok = parseOAuthToken(response)
+	return username, token, ok
+}
+
+// parseOAuthToken extracts bearer token from `\x01` separated key=value pairs
+func parseOAuthToken(pairs string) (token string, ok bool) {
+	for _, pair := range strings.Split(pairs, "\x01") {
+		value, found := strings.CutPrefix(pair, "auth=")
+		if !found {
+			continue
+		}
+		scheme, token, found := strings.Cut(value, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return "", false
+		}
+		return token, true
+	}
+	return "", false
+}
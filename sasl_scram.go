@@ -0,0 +1,219 @@
+package msmtpd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Good read - https://www.rfc-editor.org/rfc/rfc5802 and https://www.rfc-editor.org/rfc/rfc7677
+// Example of exchange:
+// C: n,,n=user,r=rOprNGfwEbeRWgbNEkqO
+// S: r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096
+// C: c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=
+// S: v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=
+// C: <empty response>
+// S: 235 2.7.0 OK, you are now authenticated
+
+// DefaultScramIterations is iteration count for PBKDF2 recommended by RFC 7677
+const DefaultScramIterations = 4096
+
+// ScramCredentials are credentials of user stored on server for SCRAM-SHA-256 mechanism,
+// so server does not need to know plain text password
+type ScramCredentials struct {
+	// Salt used to derive salted password
+	Salt []byte
+	// Iterations count used to derive salted password
+	Iterations int
+	// StoredKey is H(HMAC(SaltedPassword, "Client Key"))
+	StoredKey []byte
+	// ServerKey is HMAC(SaltedPassword, "Server Key")
+	ServerKey []byte
+}
+
+// ScramCredentialsLookupFunc returns SCRAM-SHA-256 credentials stored for user
+type ScramCredentialsLookupFunc func(ctx context.Context, transaction *Transaction, username string) (ScramCredentials, error)
+
+// NewScramSHA256Credentials derives SCRAM-SHA-256 credentials from password, salt and iterations count
+func NewScramSHA256Credentials(password string, salt []byte, iterations int) (ScramCredentials, error) {
+	saltedPassword, err := pbkdf2.Key(sha256.New, password, salt, iterations, sha256.Size)
+	if err != nil {
+		return ScramCredentials{}, err
+	}
+	clientKey := scramHMAC(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	return ScramCredentials{
+		Salt:       salt,
+		Iterations: iterations,
+		StoredKey:  storedKey[:],
+		ServerKey:  scramHMAC(saltedPassword, "Server Key"),
+	}, nil
+}
+
+// ScramSHA256Mechanism is SCRAM-SHA-256 mechanism (RFC 7677), it uses credentials returned by lookup
+// function. Channel binding is not supported.
+func ScramSHA256Mechanism(lookup ScramCredentialsLookupFunc) SASLMechanism {
+	return NewSASLMechanism("SCRAM-SHA-256", func(transaction *Transaction) SASLServer {
+		s := scramServer{transaction: transaction, lookup: lookup}
+		return SASLServerFunc(s.next)
+	})
+}
+
+// scramServer keeps state of SCRAM-SHA-256 exchange
+type scramServer struct {
+	transaction *Transaction
+	lookup      ScramCredentialsLookupFunc
+	step        int
+
+	gs2Header       string
+	clientFirstBare string
+	serverFirst     string
+	nonce           string
+	username        string
+	credentials     ScramCredentials
+}
+
+func (s *scramServer) next(ctx context.Context, response []byte) ([]byte, bool, error) {
+	switch s.step {
+	case 0:
+		if response == nil {
+			// client have to start exchange, so we send empty challenge
+			return []byte{}, false, nil
+		}
+		s.step++
+		return s.handleClientFirst(ctx, string(response))
+	case 1:
+		s.step++
+		return s.handleClientFinal(string(response))
+	default:
+		if len(response) != 0 {
+			s.transaction.Hate(missingParameterPenalty)
+			return nil, false, ErrAuthenticationCredentialsMalformed
+		}
+		s.transaction.Username = s.username
+		return nil, true, nil
+	}
+}
+
+func (s *scramServer) handleClientFirst(ctx context.Context, clientFirst string) ([]byte, bool, error) {
+	// gs2-header is `n,[a=authzid],` or `y,[a=authzid],`, `p=` means client requires channel binding
+	parts := strings.SplitN(clientFirst, ",", 3)
+	if len(parts) != 3 || (parts[0] != "n" && parts[0] != "y") {
+		s.transaction.Hate(missingParameterPenalty)
+		return nil, false, ErrAuthenticationCredentialsMalformed
+	}
+	s.gs2Header = parts[0] + "," + parts[1] + ","
+	s.clientFirstBare = parts[2]
+	attributes, err := parseScramAttributes(s.clientFirstBare)
+	if err != nil {
+		s.transaction.Hate(missingParameterPenalty)
+		return nil, false, ErrAuthenticationCredentialsMalformed
+	}
+	username, err := decodeScramUsername(attributes["n"])
+	if err != nil || username == "" || attributes["r"] == "" {
+		s.transaction.Hate(missingParameterPenalty)
+		return nil, false, ErrAuthenticationCredentialsMalformed
+	}
+	s.transaction.LogDebug("Trying to authorise %s using mechanism SCRAM-SHA-256", username)
+	s.credentials, err = s.lookup(ctx, s.transaction, username)
+	if err != nil {
+		return nil, false, err
+	}
+	serverNonce := make([]byte, 18)
+	_, err = rand.Read(serverNonce)
+	if err != nil {
+		return nil, false, err
+	}
+	s.username = username
+	s.nonce = attributes["r"] + base64.StdEncoding.EncodeToString(serverNonce)
+	s.serverFirst = fmt.Sprintf("r=%s,s=%s,i=%d",
+		s.nonce, base64.StdEncoding.EncodeToString(s.credentials.Salt), s.credentials.Iterations)
+	return []byte(s.serverFirst), false, nil
+}
+
+func (s *scramServer) handleClientFinal(clientFinal string) ([]byte, bool, error) {
+	withoutProof, proof, found := strings.Cut(clientFinal, ",p=")
+	if !found {
+		s.transaction.Hate(missingParameterPenalty)
+		return nil, false, ErrAuthenticationCredentialsMalformed
+	}
+	attributes, err := parseScramAttributes(withoutProof)
+	if err != nil {
+		s.transaction.Hate(missingParameterPenalty)
+		return nil, false, ErrAuthenticationCredentialsMalformed
+	}
+	if attributes["c"] != base64.StdEncoding.EncodeToString([]byte(s.gs2Header)) {
+		s.transaction.LogDebug("SCRAM-SHA-256 channel binding mismatch")
+		return nil, false, ErrAuthenticationCredentialsInvalid
+	}
+	if attributes["r"] != s.nonce {
+		s.transaction.LogDebug("SCRAM-SHA-256 nonce mismatch")
+		return nil, false, ErrAuthenticationCredentialsInvalid
+	}
+	clientProof, err := base64.StdEncoding.DecodeString(proof)
+	if err != nil || len(clientProof) != sha256.Size {
+		s.transaction.Hate(missingParameterPenalty)
+		return nil, false, ErrAuthenticationCredentialsMalformed
+	}
+	authMessage := s.clientFirstBare + "," + s.serverFirst + "," + withoutProof
+	clientSignature := scramHMAC(s.credentials.StoredKey, authMessage)
+	clientKey := make([]byte, sha256.Size)
+	for i := range clientKey {
+		clientKey[i] = clientProof[i] ^ clientSignature[i]
+	}
+	storedKey := sha256.Sum256(clientKey)
+	if !hmac.Equal(storedKey[:], s.credentials.StoredKey) {
+		return nil, false, ErrAuthenticationCredentialsInvalid
+	}
+	serverSignature := scramHMAC(s.credentials.ServerKey, authMessage)
+	return []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature)), false, nil
+}
+
+// scramHMAC calculates HMAC-SHA-256 of message with key provided
+func scramHMAC(key []byte, message string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// parseScramAttributes parses comma separated attributes like `n=user,r=nonce`
+func parseScramAttributes(input string) (map[string]string, error) {
+	attributes := make(map[string]string, 0)
+	for _, part := range strings.Split(input, ",") {
+		key, value, found := strings.Cut(part, "=")
+		if !found || len(key) != 1 {
+			return nil, fmt.Errorf("malformed SCRAM attribute %s", part)
+		}
+		attributes[key] = value
+	}
+	return attributes, nil
+}
+
+// decodeScramUsername decodes username, where `,` and `=` are encoded as `=2C` and `=3D`
+func decodeScramUsername(input string) (string, error) {
+	var output strings.Builder
+	for i := 0; i < len(input); i++ {
+		if input[i] != '=' {
+			output.WriteByte(input[i])
+			continue
+		}
+		if i+2 >= len(input) {
+			return "", fmt.Errorf("malformed SCRAM username: %s", input)
+		}
+		switch input[i+1 : i+3] {
+		case "2C":
+			output.WriteByte(',')
+		case "3D":
+			output.WriteByte('=')
+		default:
+			return "", fmt.Errorf("malformed SCRAM username: %s", input)
+		}
+		i += 2
+	}
+	return output.String(), nil
+}
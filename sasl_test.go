@@ -0,0 +1,230 @@
+package msmtpd
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+// saslStep sends base64 encoded SASL response and returns reply code and decoded challenge
+func saslStep(t *testing.T, c *textproto.Conn, format string, args ...any) (code int, challenge string) {
+	id, err := c.Cmd(format, args...)
+	if err != nil {
+		t.Fatalf("%s : while sending SASL response", err)
+	}
+	c.StartResponse(id)
+	defer c.EndResponse(id)
+	code, msg, err := c.ReadResponse(0)
+	if err != nil {
+		t.Fatalf("%s : while reading SASL challenge", err)
+	}
+	if code != 334 {
+		return code, msg
+	}
+	decoded, err := base64.StdEncoding.DecodeString(msg)
+	if err != nil {
+		t.Fatalf("%s : while decoding SASL challenge %s", err, msg)
+	}
+	return code, string(decoded)
+}
+
+func dialSASLServer(t *testing.T, server *Server) (*smtp.Client, func()) {
+	addr, closer := RunTestServerWithTLS(t, server)
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("STARTTLS failed: %v", err)
+	}
+	return c, closer
+}
+
+func TestSASLMechanismsAdvertised(t *testing.T) {
+	c, closer := dialSASLServer(t, &Server{
+		SASLMechanisms: []SASLMechanism{
+			ScramSHA256Mechanism(nil),
+			OAuthBearerMechanism(nil),
+			XOAuth2Mechanism(nil),
+		},
+	})
+	defer closer()
+	supported, mechanisms := c.Extension("AUTH")
+	if !supported {
+		t.Fatalf("AUTH is not supported")
+	}
+	if mechanisms != "SCRAM-SHA-256 OAUTHBEARER XOAUTH2" {
+		t.Errorf("wrong mechanisms advertised: %s", mechanisms)
+	}
+	if err := c.Mail("sender@example.org"); err == nil {
+		t.Errorf("MAIL without authentication didn't fail")
+	}
+	if err := internal.DoCommand(c.Text, 502, "AUTH PLAIN"); err != nil {
+		t.Errorf("AUTH with mechanism not registered didn't fail: %v", err)
+	}
+}
+
+func TestSASLScramSHA256(t *testing.T) {
+	salt := []byte("salt of the earth")
+	credentials, err := NewScramSHA256Credentials("pencil", salt, DefaultScramIterations)
+	if err != nil {
+		t.Fatalf("%s : while making credentials", err)
+	}
+	c, closer := dialSASLServer(t, &Server{
+		SASLMechanisms: []SASLMechanism{
+			ScramSHA256Mechanism(func(_ context.Context, tr *Transaction, username string) (ScramCredentials, error) {
+				if username != "user" {
+					return ScramCredentials{}, ErrAuthenticationCredentialsInvalid
+				}
+				return credentials, nil
+			}),
+		},
+	})
+	defer closer()
+
+	scram := func(password string) (code int) {
+		clientFirstBare := "n=user,r=fyko+d2lbbFgONRv9qkxdawL"
+		code, serverFirst := saslStep(t, c.Text, "AUTH SCRAM-SHA-256 %s",
+			base64.StdEncoding.EncodeToString([]byte("n,,"+clientFirstBare)))
+		if code != 334 {
+			t.Fatalf("wrong reply %v %s for client-first-message", code, serverFirst)
+		}
+		attributes, err := parseScramAttributes(serverFirst)
+		if err != nil {
+			t.Fatalf("%s : while parsing server-first-message", err)
+		}
+		if !strings.HasPrefix(attributes["r"], "fyko+d2lbbFgONRv9qkxdawL") || attributes["i"] != "4096" {
+			t.Fatalf("wrong server-first-message %s", serverFirst)
+		}
+		receivedSalt, _ := base64.StdEncoding.DecodeString(attributes["s"])
+		saltedPassword, err := pbkdf2.Key(sha256.New, password, receivedSalt, DefaultScramIterations, sha256.Size)
+		if err != nil {
+			t.Fatalf("%s : while salting password", err)
+		}
+		clientKey := scramHMAC(saltedPassword, "Client Key")
+		storedKey := sha256.Sum256(clientKey)
+		withoutProof := "c=biws,r=" + attributes["r"]
+		authMessage := clientFirstBare + "," + serverFirst + "," + withoutProof
+		clientSignature := scramHMAC(storedKey[:], authMessage)
+		proof := make([]byte, len(clientKey))
+		for i := range clientKey {
+			proof[i] = clientKey[i] ^ clientSignature[i]
+		}
+		code, serverFinal := saslStep(t, c.Text, "%s", base64.StdEncoding.EncodeToString(
+			[]byte(withoutProof+",p="+base64.StdEncoding.EncodeToString(proof))))
+		if code != 334 {
+			return code
+		}
+		serverSignature := scramHMAC(scramHMAC(saltedPassword, "Server Key"), authMessage)
+		if serverFinal != "v="+base64.StdEncoding.EncodeToString(serverSignature) {
+			t.Errorf("wrong server signature %s", serverFinal)
+		}
+		code, _ = saslStep(t, c.Text, "")
+		return code
+	}
+	if code := scram("wrong"); code != 535 {
+		t.Errorf("wrong password accepted with code %v", code)
+	}
+	if code := scram("pencil"); code != 235 {
+		t.Errorf("authentication failed with code %v", code)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL after authentication failed: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
+
+func TestSASLOAuth(t *testing.T) {
+	var usernames []string
+	validator := func(_ context.Context, tr *Transaction, username, token string) error {
+		usernames = append(usernames, username)
+		if token != "valid-token" {
+			return ErrAuthenticationCredentialsInvalid
+		}
+		return nil
+	}
+	c, closer := dialSASLServer(t, &Server{
+		SASLMechanisms: []SASLMechanism{
+			OAuthBearerMechanism(validator),
+			XOAuth2Mechanism(validator),
+		},
+	})
+	defer closer()
+
+	code, challenge := saslStep(t, c.Text, "AUTH OAUTHBEARER %s", base64.StdEncoding.EncodeToString(
+		[]byte("n,a=user@example.org,\x01auth=Bearer expired-token\x01\x01")))
+	if code != 334 || !strings.Contains(challenge, `"status":"invalid_token"`) {
+		t.Errorf("wrong reply %v %s for invalid token", code, challenge)
+	}
+	if code, _ = saslStep(t, c.Text, "AQ=="); code != 535 {
+		t.Errorf("wrong reply %v after error challenge", code)
+	}
+	code, challenge = saslStep(t, c.Text, "AUTH XOAUTH2 %s", base64.StdEncoding.EncodeToString(
+		[]byte("user=user@example.org\x01auth=Bearer expired-token\x01\x01")))
+	if code != 334 || !strings.Contains(challenge, `"status":"401"`) {
+		t.Errorf("wrong reply %v %s for invalid token", code, challenge)
+	}
+	if code, _ = saslStep(t, c.Text, ""); code != 535 {
+		t.Errorf("wrong reply %v after error challenge", code)
+	}
+	if code, _ = saslStep(t, c.Text, "AUTH XOAUTH2 %s", base64.StdEncoding.EncodeToString(
+		[]byte("auth=Bearer valid-token\x01\x01"))); code != 502 {
+		t.Errorf("wrong reply %v for XOAUTH2 without user", code)
+	}
+	code, challenge = saslStep(t, c.Text, "AUTH OAUTHBEARER")
+	if code != 334 || challenge != "" {
+		t.Errorf("wrong reply %v %s for AUTH without initial response", code, challenge)
+	}
+	if code, _ = saslStep(t, c.Text, "%s", base64.StdEncoding.EncodeToString(
+		[]byte("n,a=user@example.org,\x01auth=Bearer valid-token\x01\x01"))); code != 235 {
+		t.Errorf("wrong reply %v for valid token", code)
+	}
+	if strings.Join(usernames, " ") != "user@example.org user@example.org user@example.org" {
+		t.Errorf("wrong usernames validated %v", usernames)
+	}
+	if err := c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
+
+func TestSASLCramMD5(t *testing.T) {
+	c, closer := dialSASLServer(t, &Server{
+		SASLMechanisms: []SASLMechanism{
+			CramMD5Mechanism(func(_ context.Context, tr *Transaction, username string) (string, error) {
+				return "tanstaaftanstaaf", nil
+			}),
+		},
+	})
+	defer closer()
+	code, challenge := saslStep(t, c.Text, "AUTH CRAM-MD5")
+	if code != 334 || !strings.HasSuffix(challenge, "@localhost.localdomain>") {
+		t.Fatalf("wrong reply %v %s for AUTH CRAM-MD5", code, challenge)
+	}
+	if code, _ = saslStep(t, c.Text, "*"); code != 501 {
+		t.Errorf("wrong reply %v for canceled authentication", code)
+	}
+	_, challenge = saslStep(t, c.Text, "AUTH CRAM-MD5")
+	mac := hmac.New(md5.New, []byte("tanstaaftanstaaf"))
+	mac.Write([]byte(challenge))
+	code, _ = saslStep(t, c.Text, "%s", base64.StdEncoding.EncodeToString(
+		[]byte("tim "+hex.EncodeToString(mac.Sum(nil)))))
+	if code != 235 {
+		t.Errorf("wrong reply %v for valid digest", code)
+	}
+	if err := c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
@@ -70,14 +70,58 @@ type Server struct {
 	WriteTimeout time.Duration
 	// DataTimeout Socket timeout for DATA command (default: 5m)
 	DataTimeout time.Duration
+	// ConnectionSetupTimeout limits time spent on TLS handshake for implicit TLS listeners,
+	// resolving PTR records and ConnectionCheckers for every connection (default: 30s)
+	ConnectionSetupTimeout time.Duration
+	// CheckerTimeout limits time every checker, handler or hook can spend. It is enforced via context
+	// passed to them, so they should respect it. Zero value means no limit
+	CheckerTimeout time.Duration
+	// PhaseTimeouts limit total time all plugins of Phase can spend, for example, PhaseTimeouts[PhaseSender]
+	// limits all SenderCheckers called for single MAIL FROM command. Phases not set are not limited
+	PhaseTimeouts map[Phase]time.Duration
 
 	// MaxConnections sets maximum number of concurrent connections, use -1 to disable. (default: 100)
 	MaxConnections int
+	// ConnectionQueueTimeout is how long connection waits for free slot, when MaxConnections is reached,
+	// before being rejected. Zero value means connection is rejected immediately. It is default for
+	// listeners, which do not set ListenerConfig.ConnectionQueueTimeout
+	ConnectionQueueTimeout time.Duration
+	// MaxConnectionsPerIP sets maximum number of concurrent connections from single client IP address
+	// to every listener, which does not set ListenerConfig.MaxConnectionsPerIP. Zero value means no limit.
+	// Connections are counted for every listener separately, so busy MX listener does not starve
+	// submission one for the same client
+	MaxConnectionsPerIP int
+	// MaxConnectionsPerSubnet sets maximum number of concurrent connections from single /24 IPv4
+	// or /64 IPv6 subnet to every listener, which does not set ListenerConfig.MaxConnectionsPerSubnet.
+	// Zero value means no limit. Connections are counted for every listener separately
+	MaxConnectionsPerSubnet int
 	// MaxMessageSize, default is 10240000 bytes
 	MaxMessageSize int
+	// SpoolThreshold is size of message body in bytes, after which body is moved from memory
+	// to temporary file in SpoolDirectory, use -1 to always store body in file. (default: 1048576)
+	SpoolThreshold int
+	// SpoolDirectory is directory used to store temporary files with big message bodies. (default: os.TempDir())
+	SpoolDirectory string
 	// MaxRecipients are limit for RCPT TO calls for each envelope. (default: 100)
 	MaxRecipients int
 
+	// Session limits protect server from clients keeping sessions open for too long.
+	// Client exceeding any of them is disconnected with 421 reply. Zero value means no limit.
+
+	// MaxSessionDuration limits total duration of session
+	MaxSessionDuration time.Duration
+	// MaxCommands limits total number of commands issued during session
+	MaxCommands int
+	// MaxErrors limits number of error replies (4xx and 5xx) client can receive during session,
+	// like smtpd_hard_error_limit of Postfix does
+	MaxErrors int
+	// MaxNOOPs limits number of NOOP commands issued during session
+	MaxNOOPs int
+	// MaxRSETs limits number of RSET commands issued during session
+	MaxRSETs int
+	// MaxEnvelopes limits number of envelopes (accepted MAIL FROM commands) per session
+	MaxEnvelopes int
+
 	// Resolver is net.Resolver used by server and plugins to resolve remote resources against DNS servers
 	Resolver *net.Resolver
 
@@ -113,11 +157,23 @@ type Server struct {
 	// and command will be considered erroneous.
 	RecipientCheckers []RecipientChecker
 
-	// Authenticator, while being not nil, enables PLAIN/LOGIN authentication,
+	// Authenticator, while being not nil, enables PLAIN/LOGIN authentication, if SASLMechanisms are not set,
 	// only available after STARTTLS. Variable can be left empty for no authentication support.
 	// If Authenticator returns error, authentication will be considered erroneous.
 	Authenticator AuthenticatorFunc
 
+	// SASLMechanisms are authentication mechanisms advertised in EHLO response in order provided,
+	// like PlainMechanism, ScramSHA256Mechanism or OAuthBearerMechanism. If they are set,
+	// clients have to authenticate before sending mail. Authentication is only available after STARTTLS.
+	// If left empty, PLAIN and LOGIN mechanisms using Authenticator are used, if it is not nil
+	SASLMechanisms []SASLMechanism
+
+	// CertificateMapper, while being not nil, maps verified TLS client certificates to usernames,
+	// so clients presenting them are authenticated right after TLS handshake without password.
+	// TLSConfig.ClientAuth should be tls.VerifyClientCertIfGiven or stricter, and TLSConfig.ClientCAs
+	// should be set for client certificates to be verified. CertificateMapping.Map can be used here.
+	CertificateMapper CertificateMapperFunc
+
 	// DataCheckers are functions called to check message body before passing it
 	// to DataHandlers for delivery. If left empty, body is not checked. It is worth
 	// mentioning that message body is parsed according to RFC 5322 to ensure mandatory
@@ -130,6 +186,8 @@ type Server struct {
 	// Can be left empty for a NOOP server.
 	// If any of DataHandlers returns error, it will be reported as DATA
 	// command response and command will be considered erroneous.
+	// In LMTP mode, error is reported for every recipient, DataHandler has not
+	// reported delivery result via Transaction.ReportDelivery
 	DataHandlers []DataHandler
 
 	// CloseHandlers are called after connection is closed. They can be used to, for example,
@@ -137,9 +195,45 @@ type Server struct {
 	// or it can even issue shell command to blacklist remote IP by firewall
 	CloseHandlers []CloseHandler
 
+	// StateHooks are called every time session moves from one State to another one, for example,
+	// when client greets server, sender or recipient is accepted, or message body is being sent.
+	// They can be used by plugins to track progress of session, errors they return are only logged
+	StateHooks []StateHook
+
+	// VerdictThresholds define action taken according to scores plugins add via Transaction.AddScore.
+	// By default, all actions are disabled, so scores do not affect transaction
+	VerdictThresholds VerdictThresholds
+
+	// DelayReject makes errors of ConnectionCheckers, HeloCheckers and SenderCheckers, including ones of
+	// verdict, to be reported at RCPT TO command, like smtpd_delay_reject of Postfix does, so sender
+	// and recipients of client rejected are known. Only first error is reported for every recipient
+	DelayReject bool
+	// AlwaysAcceptedRecipients are accepted at RCPT TO regardless of delayed rejection and verdict, and message
+	// sent only to them is not rejected or discarded by verdict. Sender is still rejected at MAIL FROM by
+	// SenderCheckers or verdict, unless DelayReject is set. They can be addresses like `abuse@example.org`
+	// or local parts like `postmaster` matching any domain
+	AlwaysAcceptedRecipients []string
+
+	// Plugins are named sets of checkers, handlers and hooks. Their functions are called after anonymous
+	// ones set above, and they are reported by name in logs, traces and metrics of plugin calls
+	Plugins []Plugin
+
+	// LMTP makes server speak Local Mail Transfer Protocol (RFC 2033) instead of SMTP, so it can be used
+	// as final delivery agent behind MTA like Postfix. Clients have to greet server with LHLO instead of
+	// HELO/EHLO, and after message body they receive reply for every recipient accepted.
+	// DataHandlers can report delivery result for each recipient via Transaction.ReportDelivery
+	LMTP bool
+	// VRFYPolicy defines how VRFY command is answered, default is CommandPolicyRefuse
+	VRFYPolicy CommandPolicy
+	// EXPNPolicy defines how EXPN command is answered, default is CommandPolicyRefuse
+	EXPNPolicy CommandPolicy
+	// HELPPolicy defines how HELP command is answered, default is CommandPolicyRefuse
+	HELPPolicy CommandPolicy
+
 	// EnableXCLIENT enables XClient command support (disabled by default, since it is security risk)
 	EnableXCLIENT bool
-	// EnableProxyProtocol enables Proxy command support (disabled by default, since it is security risk)
+	// EnableProxyProtocol enables Proxy command support (disabled by default, since it is security risk).
+	// It accepts only text v1 header from any client, consider using ProxyListener instead
 	EnableProxyProtocol bool
 	// HideTransactionHeader hides transaction header
 	HideTransactionHeader bool
@@ -152,13 +246,27 @@ type Server struct {
 	// Tracer is OpenTelemetry tracer which starts spans for every Transaction
 	Tracer trace.Tracer
 
-	// mu guards doneChan and makes closing it and listener atomic from
+	// Listeners are named listeners with their own policy started by Server.ListenAndServeAll
+	Listeners []ListenerConfig
+
+	// commands are custom commands registered via Server.RegisterCommand
+	commands map[string]customCommand
+
+	// mu guards doneChan, listeners and configuring defaults, and makes closing them atomic from
 	// perspective of Serve()
 	mu         sync.Mutex
 	doneChan   chan struct{}
-	listener   *net.Listener
+	listeners  []*listener
 	waitgrp    sync.WaitGroup
 	inShutdown atomic.Bool
+	// draining is true, if server is gracefully shut down by ShutdownContext
+	draining atomic.Bool
+	// transactions are being served, they are guarded by mu
+	transactions map[*Transaction]struct{}
+	// addresses are numbers of concurrent connections per client IP address and subnet,
+	// they are guarded by addressesMu
+	addresses   map[string]int
+	addressesMu sync.Mutex
 
 	// Context is main context in which server is started
 	Context context.Context
@@ -173,49 +281,80 @@ type Server struct {
 	transactionsFail         uint64
 	transactionsActive       int32
 	lastTransactionStartedAt time.Time
+
+	messagesDelivered           uint64
+	messagesRejected            uint64
+	connectionsQueued           int32
+	connectionsRejectedByLimit  uint64
+	connectionsRejectedByIP     uint64
+	connectionsRejectedBySubnet uint64
+	pluginPanics                uint64
+	pluginTimeouts              uint64
+	pluginMetricsMu             sync.Mutex
+	pluginMetrics               map[pluginMetricsKey]*PluginMetrics
 }
 
 // startTransaction takes network connection and wraps it into Transaction object to handle all remote
-// client interactions via (E)SMTP protocol.
-func (srv *Server) startTransaction(c net.Conn) (t *Transaction) {
-	var err error
-	var ptrs []string
+// client interactions via (E)SMTP protocol. Error is returned, if connection is accepted by ProxyListener
+// and PROXY protocol header is malformed, so transaction should be closed. Expensive work, like
+// TLS handshake and PTR lookups, is done later by setupTransaction.
+func (srv *Server) startTransaction(c net.Conn, l *listener) (t *Transaction, proxyErr error) {
+	var proxyHeader *ProxyHeader
+	if pc, ok := proxyConnection(c); ok {
+		proxyHeader, proxyErr = pc.Header()
+	}
 	now := time.Now()
 	mu := sync.Mutex{}
 	atomic.AddUint64(&srv.transactionsAll, 1)
 	atomic.AddInt32(&srv.transactionsActive, 1)
+	// transactions can be started by many listeners concurrently
+	srv.mu.Lock()
 	srv.lastTransactionStartedAt = now
+	srv.mu.Unlock()
 	ctx, cancel := context.WithCancel(srv.Context)
-	remoteAddr := c.RemoteAddr().(*net.TCPAddr)
-	ctxWithTracer, span := srv.Tracer.Start(ctx, "transaction",
-		trace.WithSpanKind(trace.SpanKindServer), // важно
-		trace.WithAttributes(
-			semconv.OSName(runtime.GOOS),
-			semconv.HostArchKey.String(runtime.GOARCH),
-			semconv.ServerAddress(srv.Address().String()),
-			semconv.HostName(srv.Hostname),
+	attributes := []attribute.KeyValue{
+		semconv.OSName(runtime.GOOS),
+		semconv.HostArchKey.String(runtime.GOARCH),
+		semconv.ServerAddress(l.netListener.Addr().String()),
+		semconv.HostName(srv.Hostname),
+		semconv.TelemetrySDKLanguageGo,
+		attribute.String("listener", l.Name),
+	}
+	if remoteAddr, ok := c.RemoteAddr().(*net.TCPAddr); ok {
+		attributes = append(attributes,
 			semconv.ClientAddress(remoteAddr.IP.String()),
 			semconv.ClientPort(remoteAddr.Port),
-			semconv.TelemetrySDKLanguageGo,
-		),
+		)
+	} else {
+		// clients connected via unix domain socket have no address
+		attributes = append(attributes, semconv.NetworkTransportKey.String(c.RemoteAddr().Network()))
+	}
+	ctxWithTracer, span := srv.Tracer.Start(ctx, "transaction",
+		trace.WithSpanKind(trace.SpanKindServer), // важно
+		trace.WithAttributes(attributes...),
 	)
 	t = &Transaction{
 		ID:        span.SpanContext().TraceID().String(),
 		StartedAt: now,
 
 		server:     srv,
+		listener:   l,
+		Listener:   l.Name,
 		ServerName: srv.Hostname,
 		Logger:     srv.Logger,
 
 		Span: span,
 
-		conn:   c,
-		reader: bufio.NewReader(srv.wrapWithCounters(c)),
-		writer: bufio.NewWriter(srv.wrapWithCounters(c)),
-		Addr:   c.RemoteAddr(),
-		PTRs:   make([]string, 0),
-		ctx:    ctxWithTracer,
-		cancel: cancel,
+		conn:         c,
+		acceptedConn: c,
+		reader:       bufio.NewReader(srv.wrapWithCounters(c)),
+		writer:       bufio.NewWriter(srv.wrapWithCounters(c)),
+		Addr:         c.RemoteAddr(),
+		PTRs:         make([]string, 0),
+		ctx:          ctxWithTracer,
+		cancel:       cancel,
+
+		ProxyHeader: proxyHeader,
 
 		Aliases:  nil,
 		facts:    make(map[string]string, 0),
@@ -223,62 +362,97 @@ func (srv *Server) startTransaction(c net.Conn) (t *Transaction) {
 		flags:    make(map[string]bool, 0),
 		mu:       &mu,
 	}
-	t.LogInfo("Starting transaction %s for %s.", t.ID, t.Addr.String())
+	t.LogInfo("Starting transaction %s for %s on listener %s.", t.ID, t.Addr.String(), l.Name)
+	t.readPeerCredentials()
+	if proxyErr != nil {
+		t.LogError(proxyErr, "while reading PROXY protocol header")
+		span.SetStatus(codes.Error, proxyErr.Error())
+		span.RecordError(proxyErr)
+		return t, proxyErr
+	}
+	if proxyHeader != nil {
+		t.LogDebug("PROXY protocol v%v header received from %s",
+			proxyHeader.Version, c.RemoteAddr().String())
+		span.SetAttributes(attribute.Int("proxy_version", proxyHeader.Version))
+		if proxyHeader.Authority != "" {
+			span.SetAttributes(attribute.String("proxy_authority", proxyHeader.Authority))
+		}
+		if proxyHeader.ALPN != "" {
+			span.SetAttributes(attribute.String("proxy_alpn", proxyHeader.ALPN))
+		}
+		if proxyHeader.TLS != nil {
+			span.SetAttributes(attribute.String("proxy_tls_version", proxyHeader.TLS.Version))
+		}
+	}
 	// Check if the underlying connection is already TLS.
 	// This will happen if the Listener provided Serve()
 	// is from tls.Listen()
-	var tlsConn *tls.Conn
-	tlsConn, t.Encrypted = c.(*tls.Conn)
+	_, t.Encrypted = c.(*tls.Conn)
 	if t.Encrypted {
 		span.SetAttributes(attribute.Bool("encrypted", true))
-		// run handshake otherwise it's done when we first
-		// read/write and connection state will be invalid
-		err = tlsConn.Handshake()
-		if err != nil {
-			t.LogError(err, "while performing handshake")
-			t.Secured = false
-			t.Hate(tlsHandshakeFailedHate)
-			span.SetAttributes(attribute.Bool("secured", false))
+	}
+	return t, nil
+}
+
+// handshake performs TLS handshake for connection, which is already encrypted, otherwise
+// it's done when we first read/write and connection state will be invalid
+func (t *Transaction) handshake(ctx context.Context) {
+	tlsConn := t.conn.(*tls.Conn)
+	err := tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		t.LogError(err, "while performing handshake")
+		t.Secured = false
+		t.Hate(tlsHandshakeFailedHate)
+		t.Span.SetAttributes(attribute.Bool("secured", false))
+	} else {
+		t.Secured = true
+		t.Span.SetAttributes(attribute.Bool("secured", true))
+		version, found := TLSVersions[tlsConn.ConnectionState().Version]
+		if found {
+			t.LogInfo("Connection with %s is already encrypted for server `%s` with %s",
+				t.Addr.String(), tlsConn.ConnectionState().ServerName, version,
+			)
 		} else {
-			t.Secured = true
-			span.SetAttributes(attribute.Bool("secured", true))
-			version, found := TLSVersions[tlsConn.ConnectionState().Version]
-			if found {
-				t.LogInfo("Connection with %s is already encrypted for server `%s` with %s",
-					t.Addr.String(), tlsConn.ConnectionState().ServerName, version,
-				)
-			} else {
-				t.LogWarn("Connection with %s is already encrypted for server `%s` with unknown protocol version %v",
-					t.Addr.String(), tlsConn.ConnectionState().ServerName, tlsConn.ConnectionState().Version,
-				)
-			}
+			t.LogWarn("Connection with %s is already encrypted for server `%s` with unknown protocol version %v",
+				t.Addr.String(), tlsConn.ConnectionState().ServerName, tlsConn.ConnectionState().Version,
+			)
 		}
-		state := tlsConn.ConnectionState()
-		t.TLS = &state
-	}
-	if !srv.SkipResolvingPTR {
-		ptrs, err = t.Resolver().LookupAddr(t.Context(), remoteAddr.IP.String())
-		if err != nil {
-			if strings.Contains(err.Error(), "no such host") {
-				t.LogDebug("unable to resolve PTR record for %s: %s",
-					remoteAddr.IP.String(), err,
-				)
-			} else {
-				t.LogError(err, "while resolving remote address PTR record")
-			}
-			t.PTRs = make([]string, 0)
-		} else {
-			t.LogDebug("PTR addresses resolved for %s : %v",
-				remoteAddr, ptrs,
+	}
+	state := tlsConn.ConnectionState()
+	t.TLS = &state
+	if t.Secured {
+		t.authenticateByCertificate(ctx)
+	}
+}
+
+// resolvePTR resolves PTR records of client IP address, unless Server.SkipResolvingPTR is set
+func (t *Transaction) resolvePTR(ctx context.Context) {
+	if t.server.SkipResolvingPTR {
+		t.LogDebug("PTR resolution disabled")
+		return
+	}
+	ip := t.RemoteIP()
+	if ip == nil {
+		t.LogDebug("Client is not connected via TCP, so there are no PTR records to resolve")
+		return
+	}
+	ptrs, err := t.Resolver().LookupAddr(ctx, ip.String())
+	if err != nil {
+		if strings.Contains(err.Error(), "no such host") {
+			t.LogDebug("unable to resolve PTR record for %s: %s",
+				ip.String(), err,
 			)
-			t.PTRs = ptrs
-			span.SetAttributes(attribute.StringSlice("ptr", ptrs))
+		} else {
+			t.LogError(err, "while resolving remote address PTR record")
 		}
+		t.PTRs = make([]string, 0)
 	} else {
-		t.LogDebug("PTR resolution disabled")
+		t.LogDebug("PTR addresses resolved for %s : %v",
+			ip, ptrs,
+		)
+		t.PTRs = ptrs
+		t.Span.SetAttributes(attribute.StringSlice("ptr", ptrs))
 	}
-	t.scanner = bufio.NewScanner(t.reader)
-	return
 }
 
 // ListenAndServe starts the SMTP server and listens on the address provided
@@ -303,22 +477,28 @@ func (srv *Server) runCloseHandlers(transaction *Transaction) {
 		return
 	}
 	var closeError error
-	srv.Logger.Debugf(transaction, "Starting %v close handlers...", len(srv.CloseHandlers))
-	for k := range srv.CloseHandlers {
-		srv.Logger.Debugf(transaction, "Starting close handler %v...", k)
-		closeError = srv.CloseHandlers[k](transaction.Context(), transaction)
+	closeHandlers := transaction.listener.closeHandlers
+	srv.Logger.Debugf(transaction, "Starting %v close handlers...", len(closeHandlers))
+	ctx, cancel := transaction.phaseContext(context.WithoutCancel(transaction.Context()), PhaseClose)
+	defer cancel()
+	for k := range closeHandlers {
+		name := transaction.listener.pluginName(PhaseClose, k)
+		srv.Logger.Debugf(transaction, "Starting close handler %s...", name)
+		closeError = transaction.callPlugin(ctx, PhaseClose, k, func(pluginCtx context.Context) error {
+			return closeHandlers[k](pluginCtx, transaction)
+		})
 		if closeError != nil {
 			closedProperly = false
-			transaction.LogError(closeError, "while calling close handler")
+			transaction.LogError(closeError, "while calling close handler "+name)
 		} else {
-			transaction.LogDebug("closing handler %v is called", k)
+			transaction.LogDebug("closing handler %s is called", name)
 		}
 	}
 	transaction.closeHandlersCalled = true
 	srv.Logger.Infof(transaction, "Closing transaction %s.", transaction.ID)
 	atomic.AddInt32(&srv.transactionsActive, -1)
 	if closedProperly {
-		if transaction.dataHandlersCalledProperly {
+		if transaction.messagesDelivered > 0 {
 			transaction.Span.SetStatus(codes.Ok, "Transaction completed")
 			atomic.AddUint64(&srv.transactionsSuccess, 1)
 		} else {
@@ -331,18 +511,43 @@ func (srv *Server) runCloseHandlers(transaction *Transaction) {
 
 // Serve starts the SMTP server and listens on the Listener provided
 func (srv *Server) Serve(l net.Listener) error {
+	return srv.ServeListener(l, ListenerConfig{Name: DefaultListenerName})
+}
+
+// ServeListener starts the SMTP server and listens on the Listener provided with its own policy.
+// It can be called many times for different listeners with different names. If config.TLS is TLSPolicyImplicit,
+// connections accepted are encrypted, so Listener provided should not be encrypted by itself
+func (srv *Server) ServeListener(l net.Listener, config ListenerConfig) error {
 	var err error
-	var broken bool
 	if srv.inShutdown.Load() {
 		return ErrServerClosed
 	}
 	srv.configureDefaults()
+	served, err := srv.resolveListener(config)
+	if err != nil {
+		return err
+	}
+	if served.TLS == TLSPolicyImplicit {
+		tlsConfig := served.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = srv.TLSConfig
+		}
+		l = tls.NewListener(l, tlsConfig)
+	}
 	l = &onceCloseListener{Listener: l}
 	defer l.Close()
-	srv.listener = &l
+	served.netListener = l
+	err = srv.addListener(served)
+	if err != nil {
+		return err
+	}
+	defer srv.removeListener(served)
+	if srv.inShutdown.Load() {
+		return ErrServerClosed
+	}
 	var limiter chan struct{}
-	if srv.MaxConnections > 0 {
-		limiter = make(chan struct{}, srv.MaxConnections)
+	if served.MaxConnections > 0 {
+		limiter = make(chan struct{}, served.MaxConnections)
 	}
 	for {
 		conn, e := l.Accept()
@@ -359,70 +564,109 @@ func (srv *Server) Serve(l net.Listener) error {
 			}
 			return e
 		}
-		broken = false
-		transaction := srv.startTransaction(conn)
-		for k := range srv.ConnectionCheckers {
-			err = srv.ConnectionCheckers[k](transaction.Context(), transaction)
-			if err != nil {
-				transaction.LogWarn("%s : after connection checker %v executed", err, k)
-				transaction.error(err)
-				broken = true
-				break
-			}
-		}
-		if broken {
-			transaction.LogDebug("Connection checkers failed - closing broken transaction...")
-			transaction.close()
-			srv.runCloseHandlers(transaction)
-			transaction.LogInfo("Connection checkers failed - broken transaction is closed")
-			transaction.cancel()
-			continue
-		}
-		if transaction.Encrypted {
-			if !transaction.Secured {
-				transaction.LogDebug("Connection TLS handshake failed - closing transaction...")
-				transaction.close()
-				srv.runCloseHandlers(transaction)
-				transaction.LogInfo("Connection TLS handshake failed -  transaction is closed")
-				transaction.cancel()
-				continue
-			}
-		}
-		transaction.LogInfo("Accepting connection from %s...", transaction.Addr)
-
 		srv.waitgrp.Add(1)
 		go func() {
 			defer srv.waitgrp.Done()
-			if limiter != nil {
-				select {
-				case limiter <- struct{}{}:
-					transaction.serve()
-					<-limiter
-				default:
-					srv.runCloseHandlers(transaction)
-					transaction.reject()
-				}
-			} else {
-				transaction.serve()
-			}
+			srv.handleConnection(conn, served, limiter)
 		}()
 	}
 }
 
+// handleConnection sets up transaction for connection accepted and serves it. It is called
+// in its own goroutine, so slow TLS handshakes, DNS lookups and ConnectionCheckers do not stop
+// server from accepting other clients. Connection limits are applied before expensive setup work
+func (srv *Server) handleConnection(conn net.Conn, served *listener, limiter chan struct{}) {
+	transaction, proxyErr := srv.startTransaction(conn, served)
+	if proxyErr != nil {
+		srv.closeBrokenTransaction(transaction, "PROXY protocol header is malformed")
+		return
+	}
+	keys, admissionErr := srv.admitAddress(transaction)
+	if admissionErr != nil {
+		transaction.error(admissionErr)
+		srv.closeBrokenTransaction(transaction, "Too many concurrent connections from address")
+		return
+	}
+	defer srv.releaseAddress(keys)
+	if limiter != nil {
+		if !srv.waitForSlot(transaction, limiter) {
+			srv.runCloseHandlers(transaction)
+			transaction.reject()
+			transaction.cancel()
+			return
+		}
+		defer func() { <-limiter }()
+	}
+	if !srv.setupTransaction(transaction) {
+		return
+	}
+	transaction.LogInfo("Accepting connection from %s...", transaction.Addr)
+	transaction.serve()
+}
+
+// setupTransaction performs TLS handshake for implicit TLS listeners, resolves PTR records of client
+// and calls ConnectionCheckers, all of them limited by Server.ConnectionSetupTimeout. Transaction is
+// closed and false is returned, if any of them fails
+func (srv *Server) setupTransaction(t *Transaction) bool {
+	ctx, cancel := context.WithTimeout(t.Context(), srv.ConnectionSetupTimeout)
+	defer cancel()
+	err := t.conn.SetDeadline(time.Now().Add(srv.ConnectionSetupTimeout))
+	if err != nil {
+		t.LogError(err, "while setting deadline for connection setup")
+		srv.closeBrokenTransaction(t, "Connection setup failed")
+		return false
+	}
+	if t.Encrypted {
+		t.handshake(ctx)
+		if !t.Secured {
+			srv.closeBrokenTransaction(t, "Connection TLS handshake failed")
+			return false
+		}
+		t.setState(ctx, StateSecured)
+	}
+	t.resolvePTR(ctx)
+	checkerErr := t.runPhase(ctx, PhaseConnection, len(t.listener.ConnectionCheckers),
+		func(pluginCtx context.Context, k int) error {
+			return t.listener.ConnectionCheckers[k](pluginCtx, t)
+		})
+	// deadline is reset before replying, because it can be already exceeded
+	err = t.conn.SetDeadline(time.Time{})
+	if err != nil {
+		t.LogError(err, "while resetting deadline after connection setup")
+		srv.closeBrokenTransaction(t, "Connection setup failed")
+		return false
+	}
+	if ctx.Err() != nil {
+		t.LogWarn("Connection setup took longer than %s", srv.ConnectionSetupTimeout)
+		t.error(ErrConnectionSetupTimeout)
+		srv.closeBrokenTransaction(t, "Connection setup timed out")
+		return false
+	}
+	if checkerErr != nil && !t.delayRejection(t.Span, PhaseConnection, checkerErr) {
+		t.error(checkerErr)
+		srv.closeBrokenTransaction(t, "Connection checkers failed")
+		return false
+	}
+	return true
+}
+
+// closeBrokenTransaction closes transaction, which is not served
+func (srv *Server) closeBrokenTransaction(t *Transaction, reason string) {
+	t.LogDebug("%s - closing broken transaction...", reason)
+	t.close()
+	srv.runCloseHandlers(t)
+	t.LogInfo("%s - broken transaction is closed", reason)
+	t.cancel()
+}
+
 // Shutdown instructs the server to shut down, starting by closing the
-// associated listener. If wait is true, it will wait for the shutdown
+// associated listeners. If wait is true, it will wait for the shutdown
 // to complete. If wait is false, Wait must be called afterwards.
 func (srv *Server) Shutdown(wait bool) error {
-	var lnerr error
 	srv.inShutdown.Store(true)
 
-	// First close the listener
-	srv.mu.Lock()
-	if srv.listener != nil {
-		lnerr = (*srv.listener).Close()
-	}
-	srv.closeDoneChanLocked()
-	srv.mu.Unlock()
+	// First close the listeners
+	lnerr := srv.closeListeners()
 
 	// Now wait for all client connections to close
 	if wait {
@@ -437,6 +681,100 @@ func (srv *Server) Shutdown(wait bool) error {
 	return lnerr
 }
 
+// ShutdownContext gracefully shuts down the server. Listeners are closed, sessions waiting for
+// the next command from client receive 421 reply and are closed right away, and sessions handling
+// commands, like DATA, are closed after command is processed. If sessions are still running when ctx
+// is done, they are force-closed and ctx.Err() is returned after short grace period, even if some of them
+// are still stuck in plugins ignoring their context. CloseHandlers are called for every session, even for
+// force-closed ones, with context, which is not canceled, but they can be still running, when ctx.Err()
+// is returned.
+func (srv *Server) ShutdownContext(ctx context.Context) error {
+	srv.inShutdown.Store(true)
+	srv.draining.Store(true)
+	lnerr := srv.closeListeners()
+	srv.interruptIdleTransactions()
+
+	done := make(chan struct{})
+	go func() {
+		srv.waitgrp.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+		srv.forceCloseTransactions()
+		grace := time.NewTimer(forceCloseGracePeriod)
+		select {
+		case <-done:
+		case <-grace.C:
+		}
+		grace.Stop()
+	}
+	if srv.Cancel != nil {
+		srv.Cancel()
+	}
+	if err != nil {
+		return err
+	}
+	return lnerr
+}
+
+// closeListeners closes all listeners being served and makes Serve return ErrServerClosed
+func (srv *Server) closeListeners() (lnerr error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for i := range srv.listeners {
+		err := srv.listeners[i].netListener.Close()
+		if err != nil && lnerr == nil {
+			lnerr = err
+		}
+	}
+	srv.closeDoneChanLocked()
+	return lnerr
+}
+
+// trackTransaction remembers transaction being served, so it can be closed on ShutdownContext
+func (srv *Server) trackTransaction(t *Transaction) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.transactions == nil {
+		srv.transactions = make(map[*Transaction]struct{})
+	}
+	srv.transactions[t] = struct{}{}
+}
+
+// forgetTransaction forgets transaction, which is not served anymore
+func (srv *Server) forgetTransaction(t *Transaction) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	delete(srv.transactions, t)
+}
+
+// interruptIdleTransactions wakes up transactions waiting for the next command from client,
+// so they can send 421 reply and close connection
+func (srv *Server) interruptIdleTransactions() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for t := range srv.transactions {
+		if t.idle.Load() {
+			t.acceptedConn.SetReadDeadline(time.Now())
+		}
+	}
+}
+
+// forceCloseTransactions cancels contexts and closes connections of all transactions being served
+func (srv *Server) forceCloseTransactions() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for t := range srv.transactions {
+		t.LogWarn("Transaction is force-closed due to server shutdown")
+		t.cancel()
+		t.acceptedConn.Close()
+	}
+}
+
 // Wait waits for all client connections to close and the server to finish
 // shutting down.
 func (srv *Server) Wait() error {
@@ -447,18 +785,30 @@ func (srv *Server) Wait() error {
 	return nil
 }
 
-// Address returns the listening address of the server
+// Address returns the listening address of the server, if it has many listeners,
+// address of the first one started is returned, see Server.ListenerAddress
 func (srv *Server) Address() net.Addr {
-	return (*srv.listener).Addr()
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.listeners) == 0 {
+		return nil
+	}
+	return srv.listeners[0].netListener.Addr()
 }
 
 func (srv *Server) configureDefaults() {
+	// listeners can be started concurrently
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
 	if srv.Context == nil {
 		srv.Context, srv.Cancel = context.WithCancel(context.Background())
 	}
 	if srv.MaxMessageSize == 0 {
 		srv.MaxMessageSize = 10240000
 	}
+	if srv.SpoolThreshold == 0 {
+		srv.SpoolThreshold = DefaultSpoolThreshold
+	}
 	if srv.MaxConnections == 0 {
 		srv.MaxConnections = 100
 	}
@@ -474,6 +824,15 @@ func (srv *Server) configureDefaults() {
 	if srv.DataTimeout == 0 {
 		srv.DataTimeout = time.Minute * 5
 	}
+	if srv.ConnectionSetupTimeout == 0 {
+		srv.ConnectionSetupTimeout = time.Second * 30
+	}
+	if srv.Authenticator != nil && len(srv.SASLMechanisms) == 0 {
+		srv.SASLMechanisms = []SASLMechanism{
+			PlainMechanism(srv.Authenticator),
+			LoginMechanism(srv.Authenticator),
+		}
+	}
 	if srv.ForceTLS && srv.TLSConfig == nil {
 		log.Fatal("Cannot use ForceTLS with no TLSConfig")
 	}
@@ -481,7 +840,11 @@ func (srv *Server) configureDefaults() {
 		srv.Hostname = "localhost.localdomain"
 	}
 	if srv.WelcomeMessage == "" {
-		srv.WelcomeMessage = fmt.Sprintf("%s ESMTP ready.", srv.Hostname)
+		if srv.LMTP {
+			srv.WelcomeMessage = fmt.Sprintf("%s LMTP ready.", srv.Hostname)
+		} else {
+			srv.WelcomeMessage = fmt.Sprintf("%s ESMTP ready.", srv.Hostname)
+		}
 	}
 	if srv.Resolver == nil {
 		srv.Resolver = net.DefaultResolver
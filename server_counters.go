@@ -35,32 +35,57 @@ func (srv *Server) wrapWithCounters(stream io.ReadWriteCloser) (wrapped io.ReadW
 
 // GetBytesWritten returns number of bytes written
 func (srv *Server) GetBytesWritten() uint64 {
-	return srv.bytesWritten
+	return atomic.LoadUint64(&srv.bytesWritten)
 }
 
 // GetBytesRead returns number of bytes written
 func (srv *Server) GetBytesRead() uint64 {
-	return srv.bytesRead
+	return atomic.LoadUint64(&srv.bytesRead)
 }
 
 // GetTransactionsCount returns number of all transactions this server processed
 func (srv *Server) GetTransactionsCount() uint64 {
-	return srv.transactionsAll
+	return atomic.LoadUint64(&srv.transactionsAll)
 }
 
 // GetActiveTransactionsCount returns number of active transactions this server is processing
 func (srv *Server) GetActiveTransactionsCount() int32 {
-	return srv.transactionsActive
+	return atomic.LoadInt32(&srv.transactionsActive)
 }
 
 // GetSuccessfulTransactionsCount returns number of successful transactions this server processed
 func (srv *Server) GetSuccessfulTransactionsCount() uint64 {
-	return srv.transactionsSuccess
+	return atomic.LoadUint64(&srv.transactionsSuccess)
 }
 
 // GetFailedTransactionsCount returns number of failed transactions this server processed
 func (srv *Server) GetFailedTransactionsCount() uint64 {
-	return srv.transactionsFail
+	return atomic.LoadUint64(&srv.transactionsFail)
+}
+
+// GetMessagesCount returns number of messages delivered and rejected by this server, unlike transactions,
+// which are SMTP sessions, many messages can be sent during single session
+func (srv *Server) GetMessagesCount() (delivered, rejected uint64) {
+	return atomic.LoadUint64(&srv.messagesDelivered), atomic.LoadUint64(&srv.messagesRejected)
+}
+
+// GetQueuedConnectionsCount returns number of connections waiting for free slot, see Server.ConnectionQueueTimeout
+func (srv *Server) GetQueuedConnectionsCount() int32 {
+	return atomic.LoadInt32(&srv.connectionsQueued)
+}
+
+// GetRejectedConnectionsCount returns number of connections rejected because of Server.MaxConnections,
+// Server.MaxConnectionsPerIP and Server.MaxConnectionsPerSubnet limits
+func (srv *Server) GetRejectedConnectionsCount() (byLimit, byIP, bySubnet uint64) {
+	return atomic.LoadUint64(&srv.connectionsRejectedByLimit),
+		atomic.LoadUint64(&srv.connectionsRejectedByIP),
+		atomic.LoadUint64(&srv.connectionsRejectedBySubnet)
+}
+
+// GetPluginFailuresCount returns number of plugins panicked and exceeded their time budgets,
+// see Server.CheckerTimeout and Server.PhaseTimeouts
+func (srv *Server) GetPluginFailuresCount() (panics, timeouts uint64) {
+	return atomic.LoadUint64(&srv.pluginPanics), atomic.LoadUint64(&srv.pluginTimeouts)
 }
 
 // ResetCounters resets counters
@@ -78,20 +103,62 @@ func (srv *Server) StartPrometheusScrapperEndpoint(address, path string) (err er
 		Handler: http.DefaultServeMux,
 	}
 	http.HandleFunc(path, func(res http.ResponseWriter, req *http.Request) {
+		srv.mu.Lock()
+		lastTransactionStartedAt := srv.lastTransactionStartedAt
+		srv.mu.Unlock()
 		res.Header().Add("Content-Type", "text/plain; version=0.0.4")
 		res.WriteHeader(http.StatusOK)
 		fmt.Fprintf(res, "bytes_read{hostname=\"%s\"} %v %v\n",
-			srv.Hostname, srv.GetBytesRead(), srv.lastTransactionStartedAt.UnixMilli())
+			srv.Hostname, srv.GetBytesRead(), lastTransactionStartedAt.UnixMilli())
 		fmt.Fprintf(res, "bytes_written{hostname=\"%s\"} %v %v\n",
-			srv.Hostname, srv.GetBytesWritten(), srv.lastTransactionStartedAt.UnixMilli())
+			srv.Hostname, srv.GetBytesWritten(), lastTransactionStartedAt.UnixMilli())
 		fmt.Fprintf(res, "active_transactions_count{hostname=\"%s\"} %v %v\n",
-			srv.Hostname, srv.GetActiveTransactionsCount(), srv.lastTransactionStartedAt.UnixMilli())
+			srv.Hostname, srv.GetActiveTransactionsCount(), lastTransactionStartedAt.UnixMilli())
 		fmt.Fprintf(res, "all_transactions_count{hostname=\"%s\"} %v %v\n",
-			srv.Hostname, srv.GetTransactionsCount(), srv.lastTransactionStartedAt.UnixMilli())
+			srv.Hostname, srv.GetTransactionsCount(), lastTransactionStartedAt.UnixMilli())
 		fmt.Fprintf(res, "successfull_transactions_count{hostname=\"%s\"} %v %v\n",
-			srv.Hostname, srv.GetSuccessfulTransactionsCount(), srv.lastTransactionStartedAt.UnixMilli())
+			srv.Hostname, srv.GetSuccessfulTransactionsCount(), lastTransactionStartedAt.UnixMilli())
 		fmt.Fprintf(res, "failed_transactions_count{hostname=\"%s\"} %v %v\n",
-			srv.Hostname, srv.GetFailedTransactionsCount(), srv.lastTransactionStartedAt.UnixMilli())
+			srv.Hostname, srv.GetFailedTransactionsCount(), lastTransactionStartedAt.UnixMilli())
+		delivered, rejected := srv.GetMessagesCount()
+		fmt.Fprintf(res, "delivered_messages_count{hostname=\"%s\"} %v %v\n",
+			srv.Hostname, delivered, lastTransactionStartedAt.UnixMilli())
+		fmt.Fprintf(res, "rejected_messages_count{hostname=\"%s\"} %v %v\n",
+			srv.Hostname, rejected, lastTransactionStartedAt.UnixMilli())
+		fmt.Fprintf(res, "queued_connections_count{hostname=\"%s\"} %v %v\n",
+			srv.Hostname, srv.GetQueuedConnectionsCount(), lastTransactionStartedAt.UnixMilli())
+		byLimit, byIP, bySubnet := srv.GetRejectedConnectionsCount()
+		fmt.Fprintf(res, "rejected_connections_count{hostname=\"%s\",limit=\"connections\"} %v %v\n",
+			srv.Hostname, byLimit, lastTransactionStartedAt.UnixMilli())
+		fmt.Fprintf(res, "rejected_connections_count{hostname=\"%s\",limit=\"ip\"} %v %v\n",
+			srv.Hostname, byIP, lastTransactionStartedAt.UnixMilli())
+		fmt.Fprintf(res, "rejected_connections_count{hostname=\"%s\",limit=\"subnet\"} %v %v\n",
+			srv.Hostname, bySubnet, lastTransactionStartedAt.UnixMilli())
+		panics, timeouts := srv.GetPluginFailuresCount()
+		fmt.Fprintf(res, "plugin_panics_count{hostname=\"%s\"} %v %v\n",
+			srv.Hostname, panics, lastTransactionStartedAt.UnixMilli())
+		fmt.Fprintf(res, "plugin_timeouts_count{hostname=\"%s\"} %v %v\n",
+			srv.Hostname, timeouts, lastTransactionStartedAt.UnixMilli())
+		for _, metrics := range srv.GetPluginMetrics() {
+			labels := fmt.Sprintf("hostname=\"%s\",phase=\"%s\",plugin=\"%s\"",
+				srv.Hostname, metrics.Phase, metrics.Name)
+			fmt.Fprintf(res, "plugin_calls_count{%s,result=\"%s\"} %v %v\n",
+				labels, PluginPassed, metrics.Passed, lastTransactionStartedAt.UnixMilli())
+			fmt.Fprintf(res, "plugin_calls_count{%s,result=\"%s\"} %v %v\n",
+				labels, PluginRejected, metrics.Rejected, lastTransactionStartedAt.UnixMilli())
+			fmt.Fprintf(res, "plugin_calls_count{%s,result=\"%s\"} %v %v\n",
+				labels, PluginFailed, metrics.Failed, lastTransactionStartedAt.UnixMilli())
+			for i := range PluginLatencyBuckets {
+				fmt.Fprintf(res, "plugin_duration_seconds_bucket{%s,le=\"%v\"} %v %v\n",
+					labels, PluginLatencyBuckets[i].Seconds(), metrics.Buckets[i], lastTransactionStartedAt.UnixMilli())
+			}
+			fmt.Fprintf(res, "plugin_duration_seconds_bucket{%s,le=\"+Inf\"} %v %v\n",
+				labels, metrics.Count, lastTransactionStartedAt.UnixMilli())
+			fmt.Fprintf(res, "plugin_duration_seconds_sum{%s} %v %v\n",
+				labels, metrics.Sum.Seconds(), lastTransactionStartedAt.UnixMilli())
+			fmt.Fprintf(res, "plugin_duration_seconds_count{%s} %v %v\n",
+				labels, metrics.Count, lastTransactionStartedAt.UnixMilli())
+		}
 	})
 	go func() {
 		<-srv.Context.Done()
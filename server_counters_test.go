@@ -138,7 +138,7 @@ func TestCountersHttpExporter(t *testing.T) {
 	if !bytes.Contains(data, []byte("bytes_read{hostname=\"localhost.localdomain\"} 22")) {
 		t.Errorf("bytes read wrong")
 	}
-	if !bytes.Contains(data, []byte("bytes_written{hostname=\"localhost.localdomain\"} 199")) {
+	if !bytes.Contains(data, []byte("bytes_written{hostname=\"localhost.localdomain\"} 283")) {
 		t.Errorf("bytes read wrong")
 	}
 	if !bytes.Contains(data, []byte("active_transactions_count{hostname=\"localhost.localdomain\"} 0")) {
@@ -0,0 +1,208 @@
+package msmtpd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+// runTestServerForShutdown starts server, which counts close handlers called
+// with context not canceled
+func runTestServerForShutdown(t *testing.T, closed *int32) (*Server, string) {
+	server := &Server{
+		CloseHandlers: []CloseHandler{
+			func(ctx context.Context, _ *Transaction) error {
+				if ctx.Err() != nil {
+					t.Errorf("%s : close handler is called with canceled context", ctx.Err())
+				}
+				atomic.AddInt32(closed, 1)
+				return nil
+			},
+		},
+	}
+	addr, _ := RunTestServerWithoutTLS(t, server)
+	return server, addr
+}
+
+func TestShutdownContextClosesIdleSessions(t *testing.T) {
+	var closed int32
+	server, addr := runTestServerForShutdown(t, &closed)
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	started := time.Now()
+	err = server.ShutdownContext(ctx)
+	if err != nil {
+		t.Errorf("%s : while shutting down server", err)
+	}
+	if time.Since(started) > 2*time.Second {
+		t.Errorf("idle session is not closed right away")
+	}
+	code, msg, err := c.Text.ReadResponse(421)
+	if err != nil {
+		t.Errorf("wrong reply %v %s for idle session: %v", code, msg, err)
+	}
+	if atomic.LoadInt32(&closed) != 1 {
+		t.Errorf("close handlers are called %v times", closed)
+	}
+}
+
+func TestShutdownContextWaitsForData(t *testing.T) {
+	var closed int32
+	server, addr := runTestServerForShutdown(t, &closed)
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed: %v", err)
+	}
+	if err = c.Rcpt("recipient@example.net"); err != nil {
+		t.Errorf("RCPT failed: %v", err)
+	}
+	wc, err := c.Data()
+	if err != nil {
+		t.Fatalf("DATA failed: %v", err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		result <- server.ShutdownContext(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	_, err = fmt.Fprint(wc, internal.MakeTestMessage("sender@example.org", "recipient@example.net"))
+	if err != nil {
+		t.Errorf("%s : while sending message body", err)
+	}
+	if err = wc.Close(); err != nil {
+		t.Errorf("message sent during shutdown is not accepted: %v", err)
+	}
+	if err = <-result; err != nil {
+		t.Errorf("%s : while shutting down server", err)
+	}
+	if err = internal.DoCommand(c.Text, 250, "NOOP"); err == nil {
+		t.Errorf("session is not closed after DATA")
+	}
+	if atomic.LoadInt32(&closed) != 1 {
+		t.Errorf("close handlers are called %v times", closed)
+	}
+}
+
+func TestShutdownContextForceClosesSessions(t *testing.T) {
+	var closed int32
+	server, addr := runTestServerForShutdown(t, &closed)
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed: %v", err)
+	}
+	if err = c.Rcpt("recipient@example.net"); err != nil {
+		t.Errorf("RCPT failed: %v", err)
+	}
+	wc, err := c.Data()
+	if err != nil {
+		t.Fatalf("DATA failed: %v", err)
+	}
+	// client never finishes message body
+	_, err = fmt.Fprint(wc, "Subject: never ending story\r\n")
+	if err != nil {
+		t.Errorf("%s : while sending message body", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	err = server.ShutdownContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error %v instead of deadline exceeded", err)
+	}
+	if atomic.LoadInt32(&closed) != 1 {
+		t.Errorf("close handlers are called %v times", closed)
+	}
+}
+
+func TestShutdownContextDoesNotWaitForStuckSessions(t *testing.T) {
+	release := make(chan struct{})
+	server := &Server{
+		DataHandlers: []DataHandler{
+			func(_ context.Context, _ *Transaction) error {
+				// handler ignores its context
+				<-release
+				return nil
+			},
+		},
+	}
+	addr, _ := RunTestServerWithoutTLS(t, server)
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed: %v", err)
+	}
+	if err = c.Rcpt("recipient@example.net"); err != nil {
+		t.Errorf("RCPT failed: %v", err)
+	}
+	wc, err := c.Data()
+	if err != nil {
+		t.Fatalf("DATA failed: %v", err)
+	}
+	_, err = fmt.Fprint(wc, internal.MakeTestMessage("sender@example.org", "recipient@example.net"))
+	if err != nil {
+		t.Errorf("%s : while sending message body", err)
+	}
+	go wc.Close()
+	time.Sleep(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	err = server.ShutdownContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wrong error %v instead of deadline exceeded", err)
+	}
+	if time.Since(started) > forceCloseGracePeriod+time.Second {
+		t.Errorf("shutdown waits for stuck session for %s", time.Since(started))
+	}
+	close(release)
+	waitForTransactionsClosed(server)
+}
+
+func TestShutdownContextDuringAuthentication(t *testing.T) {
+	server := &Server{
+		Authenticator: AuthenticatorForTestsThatAlwaysWorks,
+	}
+	addr, _ := RunTestServerWithTLS(t, server)
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Errorf("STARTTLS failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 334, "AUTH LOGIN"); err != nil {
+		t.Errorf("AUTH didn't work: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = server.ShutdownContext(ctx); err != nil {
+		t.Errorf("%s : while shutting down server", err)
+	}
+	code, msg, err := c.Text.ReadResponse(421)
+	if err != nil {
+		t.Errorf("wrong reply %v %s for session waiting for authentication response: %v", code, msg, err)
+	}
+}
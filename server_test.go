@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/smtp"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -32,6 +33,9 @@ func TestSMTP(t *testing.T) {
 	if supported, _ := c.Extension("STARTTLS"); supported {
 		t.Error("STARTTLS supported")
 	}
+	if supported, _ := c.Extension("ENHANCEDSTATUSCODES"); !supported {
+		t.Error("ENHANCEDSTATUSCODES not supported")
+	}
 	if err = c.Mail("sender@example.org"); err != nil {
 		t.Errorf("Mail failed: %v", err)
 	}
@@ -509,3 +513,57 @@ func TestServerContextDoneInTransaction(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestSlowConnectionCheckerDoesNotBlockAccept(t *testing.T) {
+	var connections int32
+	addr, closer := RunTestServerWithoutTLS(t, &Server{
+		ConnectionCheckers: []ConnectionChecker{
+			func(_ context.Context, _ *Transaction) error {
+				if atomic.AddInt32(&connections, 1) == 1 {
+					time.Sleep(2 * time.Second)
+				}
+				return nil
+			},
+		},
+	})
+	defer closer()
+	slow, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer slow.Close()
+	// wait for slow connection to be accepted before dialing fast one
+	for atomic.LoadInt32(&connections) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	started := time.Now()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if time.Since(started) > time.Second {
+		t.Errorf("connection is accepted after slow connection checker finished")
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
+
+func TestConnectionSetupTimeout(t *testing.T) {
+	addr, closer := RunTestServerWithoutTLS(t, &Server{
+		ConnectionSetupTimeout: 100 * time.Millisecond,
+		ConnectionCheckers: []ConnectionChecker{
+			func(_ context.Context, _ *Transaction) error {
+				time.Sleep(200 * time.Millisecond)
+				return nil
+			},
+		},
+	})
+	defer closer()
+	_, err := smtp.Dial(addr)
+	if err == nil {
+		t.Errorf("connection is accepted after setup timed out")
+	} else if err.Error() != ErrConnectionSetupTimeout.Error() {
+		t.Errorf("wrong error for connection setup timed out: %s", err)
+	}
+}
@@ -0,0 +1,90 @@
+package msmtpd
+
+import (
+	"fmt"
+	"time"
+)
+
+// Good read - https://www.postfix.org/postconf.5.html#smtpd_hard_error_limit
+// Socket timeouts only limit time client spends on single command, so client can keep session
+// open forever by sending NOOP, RSET or bad commands. Session limits are checked before every
+// command, and if client exceeds any of them, it is disconnected with 421 reply and karma penalty.
+
+// sessionLimits counts commands issued by client during whole session
+type sessionLimits struct {
+	commands  int
+	errors    int
+	noops     int
+	rsets     int
+	envelopes int
+}
+
+// deadline returns moment, when socket operation with timeout provided should be aborted,
+// it is never later, than moment when session exceeds Server.MaxSessionDuration
+func (t *Transaction) deadline(timeout time.Duration) time.Time {
+	deadline := time.Now().Add(timeout)
+	if t.server.MaxSessionDuration > 0 {
+		sessionDeadline := t.StartedAt.Add(t.server.MaxSessionDuration)
+		if sessionDeadline.Before(deadline) {
+			return sessionDeadline
+		}
+	}
+	return deadline
+}
+
+// durationExceeded returns description of session limit exceeded, if session lasts longer
+// than Server.MaxSessionDuration
+func (t *Transaction) durationExceeded() string {
+	if t.server.MaxSessionDuration > 0 && time.Since(t.StartedAt) >= t.server.MaxSessionDuration {
+		return fmt.Sprintf("session lasts too long (%s)", time.Since(t.StartedAt).Round(time.Second))
+	}
+	return ""
+}
+
+// countCommand accounts command client issued and returns description of session limit exceeded, if any
+func (t *Transaction) countCommand(cmd command) string {
+	srv := t.server
+	t.limits.commands++
+	if srv.MaxCommands > 0 && t.limits.commands > srv.MaxCommands {
+		return fmt.Sprintf("too many commands (%v)", t.limits.commands)
+	}
+	if reason := t.durationExceeded(); reason != "" {
+		return reason
+	}
+	switch cmd.action {
+	case "NOOP":
+		t.limits.noops++
+		if srv.MaxNOOPs > 0 && t.limits.noops > srv.MaxNOOPs {
+			return fmt.Sprintf("too many NOOP commands (%v)", t.limits.noops)
+		}
+	case "RSET":
+		t.limits.rsets++
+		if srv.MaxRSETs > 0 && t.limits.rsets > srv.MaxRSETs {
+			return fmt.Sprintf("too many RSET commands (%v)", t.limits.rsets)
+		}
+	case "MAIL":
+		if srv.MaxEnvelopes > 0 && t.limits.envelopes >= srv.MaxEnvelopes {
+			return fmt.Sprintf("too many envelopes (%v)", t.limits.envelopes)
+		}
+	}
+	return ""
+}
+
+// errorsExceeded returns description of session limit exceeded, if client has received too many error replies
+func (t *Transaction) errorsExceeded() string {
+	if t.server.MaxErrors > 0 && t.limits.errors > t.server.MaxErrors {
+		return fmt.Sprintf("too many errors (%v)", t.limits.errors)
+	}
+	return ""
+}
+
+// exceedSessionLimit disconnects client, who exceeded session limit
+func (t *Transaction) exceedSessionLimit(reason string) {
+	t.LogWarn("Closing transaction, because session limit is exceeded: %s", reason)
+	t.Span.AddEvent("Session limit exceeded: " + reason)
+	t.Hate(sessionLimitExceededPenalty)
+	// write deadline set before waiting for command can be already exceeded
+	t.conn.SetWriteDeadline(time.Now().Add(t.server.WriteTimeout))
+	t.reply(421, "4.7.0", "You are too talkative. Take a break, please.")
+	t.close()
+}
@@ -0,0 +1,115 @@
+package msmtpd
+
+import (
+	"context"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+// runTestServerWithLimits starts server with session limits provided, which reports
+// karma of transactions closed into channel returned
+func runTestServerWithLimits(t *testing.T, server *Server) (string, chan int) {
+	karma := make(chan int, 1)
+	server.CloseHandlers = []CloseHandler{
+		func(_ context.Context, tr *Transaction) error {
+			karma <- tr.Karma()
+			return nil
+		},
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	t.Cleanup(closer)
+	return addr, karma
+}
+
+func TestSessionLimits(t *testing.T) {
+	testCases := []struct {
+		name     string
+		server   *Server
+		command  string
+		code     int
+		attempts int
+	}{
+		{"commands", &Server{MaxCommands: 3}, "NOOP", 250, 3},
+		{"noops", &Server{MaxNOOPs: 2}, "NOOP", 250, 2},
+		{"rsets", &Server{MaxRSETs: 2}, "RSET", 250, 2},
+		{"errors", &Server{MaxErrors: 2}, "WTF", 502, 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			addr, karma := runTestServerWithLimits(t, tc.server)
+			c, err := smtp.Dial(addr)
+			if err != nil {
+				t.Fatalf("Dial failed: %v", err)
+			}
+			for i := 0; i < tc.attempts; i++ {
+				if err = internal.DoCommand(c.Text, tc.code, "%s", tc.command); err != nil {
+					t.Errorf("%s failed before limit is exceeded: %v", tc.command, err)
+				}
+			}
+			if tc.name == "errors" {
+				// the last error reply is sent right before 421 one
+				id, err := c.Text.Cmd("%s", tc.command)
+				if err != nil {
+					t.Fatalf("%s failed: %v", tc.command, err)
+				}
+				c.Text.StartResponse(id)
+				_, _, err = c.Text.ReadResponse(tc.code)
+				if err != nil {
+					t.Errorf("%s reply is wrong: %v", tc.command, err)
+				}
+				_, _, err = c.Text.ReadResponse(421)
+				c.Text.EndResponse(id)
+				if err != nil {
+					t.Errorf("client exceeding limit is not disconnected: %v", err)
+				}
+			} else if err = internal.DoCommand(c.Text, 421, "%s", tc.command); err != nil {
+				t.Errorf("client exceeding limit is not disconnected: %v", err)
+			}
+			if <-karma >= 0 {
+				t.Errorf("client exceeding limit is not hated")
+			}
+		})
+	}
+}
+
+func TestSessionLimitsEnvelopes(t *testing.T) {
+	addr, _ := runTestServerWithLimits(t, &Server{MaxEnvelopes: 1})
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed: %v", err)
+	}
+	if err = c.Reset(); err != nil {
+		t.Errorf("RSET failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 421, "MAIL FROM:<sender@example.org>"); err != nil {
+		t.Errorf("second envelope is accepted: %v", err)
+	}
+}
+
+func TestSessionLimitsDuration(t *testing.T) {
+	addr, karma := runTestServerWithLimits(t, &Server{MaxSessionDuration: time.Second})
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	started := time.Now()
+	_, _, err = c.Text.ReadResponse(421)
+	if err != nil {
+		t.Errorf("session lasting too long is not closed: %v", err)
+	}
+	if time.Since(started) > 2*time.Second {
+		t.Errorf("session is closed after ReadTimeout, not MaxSessionDuration")
+	}
+	if <-karma >= 0 {
+		t.Errorf("client exceeding limit is not hated")
+	}
+}
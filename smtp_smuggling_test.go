@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/mail"
 	"net/smtp"
 	"strings"
@@ -34,22 +35,25 @@ func makeSmugglingMessage(separator, from string, to ...string) string {
 func TestSMTPSmugglingNotWorks(t *testing.T) {
 	type testCase struct {
 		separator string
+		// pipelined means separator is proper end of message body, so commands after it
+		// start next mail transaction and should be accepted
+		pipelined bool
 	}
 
 	// list of separators
 	// https://github.com/The-Login/SMTP-Smuggling-Tools/blob/235cbf27ec66437f767013ae9f37c56a30648932/smtp_smuggling_scanner.py#L13
 	testCases := []testCase{
-		{"\r\n.\r\n"}, // correct one
-		{"\n.\n"},
-		{"\n.\r"},
-		{"\r.\n"},
-		{"\r.\r"},
-		{"\n.\r\n"},
-		{"\r.\r\n"},
-		{"\r\n\x00.\r\n"},
-		{"\r\n.\r\r\n"},
-		{"\r\r\n.\r\r\n"},
-		{"\r\n\x00.\r\n"},
+		{"\r\n.\r\n", true}, // correct one
+		{"\n.\n", false},
+		{"\n.\r", false},
+		{"\r.\n", false},
+		{"\r.\r", false},
+		{"\n.\r\n", false},
+		{"\r.\r\n", false},
+		{"\r\n\x00.\r\n", false},
+		{"\r\n.\r\r\n", false},
+		{"\r\r\n.\r\r\n", false},
+		{"\r\n\x00.\r\n", false},
 	}
 
 	for i := range testCases {
@@ -58,7 +62,7 @@ func TestSMTPSmugglingNotWorks(t *testing.T) {
 			addr, closer := RunTestServerWithoutTLS(tt, &Server{
 				HeloCheckers: []HelloChecker{
 					func(_ context.Context, tr *Transaction) error {
-						if tr.HeloName == "lol" {
+						if tr.HeloName == "lol" && !testCases[i].pipelined {
 							tt.Errorf("smuggling encountered, helo accepted from message body")
 						}
 						return nil
@@ -66,7 +70,7 @@ func TestSMTPSmugglingNotWorks(t *testing.T) {
 				},
 				SenderCheckers: []SenderChecker{
 					func(_ context.Context, tr *Transaction) error {
-						if tr.MailFrom.Address == "bad@example.org" {
+						if tr.MailFrom.Address == "bad@example.org" && !testCases[i].pipelined {
 							tt.Errorf("smuggling encountered, MAIL FROM accepted from message body")
 						}
 						return nil
@@ -74,7 +78,7 @@ func TestSMTPSmugglingNotWorks(t *testing.T) {
 				},
 				RecipientCheckers: []RecipientChecker{
 					func(_ context.Context, tr *Transaction, recipient *mail.Address) error {
-						if recipient.Address == "bad@example.org" {
+						if recipient.Address == "bad@example.org" && !testCases[i].pipelined {
 							tt.Errorf("smuggling encountered, RCPT TO accepted from message body")
 						}
 						return nil
@@ -83,7 +87,11 @@ func TestSMTPSmugglingNotWorks(t *testing.T) {
 				DataHandlers: []DataHandler{
 					func(_ context.Context, tr *Transaction) error {
 						atomic.AddUint32(&numberOfMessagesAccepted, 1)
-						tt.Log("Message content: ", string(tr.Body))
+						body, err := io.ReadAll(tr.BodyReader())
+						if err != nil {
+							tt.Errorf("%s : while reading message body", err)
+						}
+						tt.Log("Message content: ", string(body))
 						return nil
 					},
 				},
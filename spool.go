@@ -0,0 +1,120 @@
+package msmtpd
+
+import (
+	"io"
+	"os"
+)
+
+// DefaultSpoolThreshold is size of message body, after which it is moved from memory to temporary file
+const DefaultSpoolThreshold = 1024 * 1024
+
+// spool stores message body in memory, until it grows bigger than threshold,
+// then body is moved to temporary file, so many concurrent big messages do not eat all RAM
+type spool struct {
+	directory string
+	threshold int64
+	size      int64
+	buf       []byte
+	file      *os.File
+	// err is error occurred while writing to temporary file
+	err error
+}
+
+func newSpool(directory string, threshold int) *spool {
+	return &spool{
+		directory: directory,
+		threshold: int64(threshold),
+	}
+}
+
+// Write appends data to spool, moving it to temporary file, if threshold is exceeded.
+// It never fails, so client input is consumed in full, and error occurred while writing
+// to temporary file is reported by Err
+func (s *spool) Write(p []byte) (int, error) {
+	s.size += int64(len(p))
+	if s.err != nil {
+		return len(p), nil
+	}
+	if s.file == nil && s.size > s.threshold {
+		s.file, s.err = os.CreateTemp(s.directory, "msmtpd-*.eml")
+		if s.err != nil {
+			s.buf = nil
+			return len(p), nil
+		}
+		_, s.err = s.file.Write(s.buf)
+		s.buf = nil
+	}
+	if s.err != nil {
+		return len(p), nil
+	}
+	if s.file != nil {
+		_, s.err = s.file.Write(p)
+	} else {
+		s.buf = append(s.buf, p...)
+	}
+	return len(p), nil
+}
+
+// Err returns error occurred while writing to temporary file
+func (s *spool) Err() error {
+	return s.err
+}
+
+// ReadAt implements io.ReaderAt
+func (s *spool) ReadAt(p []byte, off int64) (n int, err error) {
+	if s.file != nil {
+		return s.file.ReadAt(p, off)
+	}
+	if off >= int64(len(s.buf)) {
+		return 0, io.EOF
+	}
+	n = copy(p, s.buf[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Size returns number of bytes written to spool
+func (s *spool) Size() int64 {
+	return s.size
+}
+
+// InMemory returns true, if spool has not been moved to temporary file
+func (s *spool) InMemory() bool {
+	return s.file == nil
+}
+
+// Close releases memory and removes temporary file, if it was created
+func (s *spool) Close() error {
+	s.buf = nil
+	if s.file == nil {
+		return nil
+	}
+	name := s.file.Name()
+	err := s.file.Close()
+	s.file = nil
+	if err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// messageReaderAt joins headers prepended to message and message body into single io.ReaderAt
+type messageReaderAt struct {
+	headers []byte
+	body    io.ReaderAt
+}
+
+// ReadAt implements io.ReaderAt
+func (m messageReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	headersSize := int64(len(m.headers))
+	if off < headersSize {
+		n = copy(p, m.headers[off:])
+		if n == len(p) {
+			return n, nil
+		}
+	}
+	bodyN, err := m.body.ReadAt(p[n:], off+int64(n)-headersSize)
+	return n + bodyN, err
+}
@@ -0,0 +1,167 @@
+package msmtpd
+
+import (
+	"context"
+	"io"
+	"net/smtp"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func TestSpoolMovesBodyToFile(t *testing.T) {
+	dir := t.TempDir()
+	s := newSpool(dir, 10)
+	_, err := s.Write([]byte("Hello, "))
+	if err != nil {
+		t.Fatalf("%s : while writing to spool", err)
+	}
+	if !s.InMemory() {
+		t.Errorf("body is moved to file before threshold is exceeded")
+	}
+	_, err = s.Write([]byte("world!"))
+	if err != nil {
+		t.Fatalf("%s : while writing to spool", err)
+	}
+	if s.InMemory() {
+		t.Errorf("body is not moved to file after threshold is exceeded")
+	}
+	if s.Size() != 13 {
+		t.Errorf("wrong size %v", s.Size())
+	}
+	reader := io.NewSectionReader(messageReaderAt{headers: []byte("Header: 1\r\n"), body: s}, 0, 11+s.Size())
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("%s : while reading spool", err)
+	}
+	if string(data) != "Header: 1\r\nHello, world!" {
+		t.Errorf("wrong data `%s`", string(data))
+	}
+	buf := make([]byte, 6)
+	_, err = reader.ReadAt(buf, 8)
+	if err != nil {
+		t.Fatalf("%s : while reading spool", err)
+	}
+	if string(buf) != "1\r\nHel" {
+		t.Errorf("wrong data `%s` read across headers and body", string(buf))
+	}
+	err = s.Close()
+	if err != nil {
+		t.Fatalf("%s : while closing spool", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("%s : while reading spool directory", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("temporary file is not removed")
+	}
+}
+
+func TestSpoolReportsStorageError(t *testing.T) {
+	s := newSpool("/this/directory/does/not/exist", 1)
+	n, err := s.Write([]byte("Hello, world!"))
+	if err != nil || n != 13 {
+		t.Errorf("write failed with %v bytes written and %v error", n, err)
+	}
+	if s.Err() == nil {
+		t.Errorf("storage error is not reported")
+	}
+}
+
+func TestBigMessageIsSpooledToFile(t *testing.T) {
+	dir := t.TempDir()
+	message := internal.MakeTestMessage("sender@example.org", "recipient@example.net")
+	var delivered bool
+	server := &Server{
+		SpoolThreshold: 100,
+		SpoolDirectory: dir,
+		DataHandlers: []DataHandler{
+			func(_ context.Context, tr *Transaction) error {
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					t.Errorf("%s : while reading spool directory", err)
+				}
+				if len(entries) != 1 {
+					t.Errorf("wrong number of spooled files %v", len(entries))
+				}
+				body, err := io.ReadAll(tr.BodyReader())
+				if err != nil {
+					t.Errorf("%s : while reading message body", err)
+				}
+				if int64(len(body)) != tr.BodySize() {
+					t.Errorf("wrong body size %v instead of %v", tr.BodySize(), len(body))
+				}
+				if !strings.HasPrefix(string(body), "Received: ") {
+					t.Errorf("received line is not on top of message")
+				}
+				if !strings.Contains(string(body), "This is test message send from sender@example.org") {
+					t.Errorf("wrong message body: %s", string(body))
+				}
+				delivered = true
+				return nil
+			},
+		},
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	err := smtp.SendMail(addr, nil, "sender@example.org", []string{"recipient@example.net"}, []byte(message))
+	if err != nil {
+		t.Errorf("%s : while sending message", err)
+	}
+	waitForTransactionsClosed(server)
+	if !delivered {
+		t.Errorf("message is not delivered")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("%s : while reading spool directory", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("temporary file is not removed after delivery")
+	}
+}
+
+func TestSpoolStorageErrorRejectsMessage(t *testing.T) {
+	server := &Server{
+		SpoolThreshold: -1,
+		SpoolDirectory: "/this/directory/does/not/exist",
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	err := smtp.SendMail(addr, nil, "sender@example.org", []string{"recipient@example.net"},
+		[]byte(internal.MakeTestMessage("sender@example.org", "recipient@example.net")))
+	waitForTransactionsClosed(server)
+	if err == nil {
+		t.Fatalf("message is accepted without storage")
+	}
+	if !strings.HasPrefix(err.Error(), "452 4.3.1") {
+		t.Errorf("wrong error %s", err)
+	}
+}
+
+func TestSetBodyFromBodyReader(t *testing.T) {
+	dir := t.TempDir()
+	tr := &Transaction{server: &Server{SpoolDirectory: dir, SpoolThreshold: 10}}
+	defer tr.releaseBody()
+	err := tr.SetBody(strings.NewReader("Hello, world!"))
+	if err != nil {
+		t.Fatalf("%s : while setting body", err)
+	}
+	err = tr.SetBody(io.MultiReader(strings.NewReader("Header: 1\r\n"), tr.BodyReader()))
+	if err != nil {
+		t.Fatalf("%s : while rewriting body", err)
+	}
+	if body := string(tr.Body()); body != "Header: 1\r\nHello, world!" {
+		t.Errorf("wrong body `%s`", body)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("%s : while reading spool directory", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("wrong number of temporary files %v", len(entries))
+	}
+}
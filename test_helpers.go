@@ -60,7 +60,7 @@ func AuthenticatorForTestsThatAlwaysWorks(_ context.Context, tr *Transaction, us
 // AuthenticatorForTestsThatAlwaysFails should not be used for production
 func AuthenticatorForTestsThatAlwaysFails(_ context.Context, tr *Transaction, username, password string) error {
 	tr.LogInfo("Pretend we authenticate as %s %s and fail!", username, password)
-	return ErrorSMTP{Code: 550, Message: "Denied"}
+	return ErrorSMTP{Code: 550, EnhancedCode: "5.7.8", Message: "Denied"}
 }
 
 // RunTestServerWithoutTLS runs test server for unit tests without TLS support
@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/mail"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -23,6 +24,10 @@ const (
 	// ESMTP means Extended Simple Mail Transfer Protocol, because it has some extra features
 	// Simple Mail Transfer Protocol doesn't have
 	ESMTP Protocol = "ESMTP"
+
+	// LMTP means Local Mail Transfer Protocol, it is ESMTP with LHLO greeting and replies
+	// for every recipient after message body, see RFC 2033
+	LMTP Protocol = "LMTP"
 )
 
 // Transaction used to handle all SMTP protocol interactions with client
@@ -34,6 +39,8 @@ type Transaction struct {
 
 	// ServerName depicts how out smtp server names itself
 	ServerName string
+	// Listener is name of listener, which accepted connection, see ListenerConfig
+	Listener string
 	// Addr depicts network address of remote client
 	Addr net.Addr
 	// PTRs are  DNS PTR record is exactly the opposite of the 'A' record, which provides the IP address associated with a
@@ -47,25 +54,40 @@ type Transaction struct {
 	Encrypted bool
 	// Secured means TLS handshake succeeded
 	Secured bool
+	// ProxyHeader is PROXY protocol header sent by load balancer, if connection is accepted by ProxyListener
+	// from trusted network
+	ProxyHeader *ProxyHeader
+	// PeerCredentials are credentials of local process, if client is connected via unix domain socket
+	PeerCredentials *PeerCredentials
 
 	// Logger is logging system inherited from server
 	Logger Logger
 
 	// HeloName is how client introduced himself via HELO/EHLO command
 	HeloName string
-	// Protocol used, SMTP or ESMTP
+	// Protocol used, SMTP, ESMTP or LMTP
 	Protocol Protocol
+	// extended is true, if session is greeted via EHLO or LHLO, so ESMTP parameters are allowed.
+	// Unlike Protocol, it is not changed by XCLIENT, which describes original client of proxy
+	extended bool
 	// Username as provided by via authorization process command
 	Username string
 	// Password from authentication, if authenticated
 	Password string
 	// MailFrom stores address from which this message is originated as client says via `MAIL FROM:`
 	MailFrom mail.Address
+	// SMTPUTF8 means client provided SMTPUTF8 parameter to `MAIL FROM:`, so internationalized
+	// email addresses and UTF-8 message headers are allowed in this envelope
+	SMTPUTF8 bool
+	// MailFromParameters stores ESMTP parameters client provided via `MAIL FROM:`, like SIZE or BODY
+	MailFromParameters Parameters
 	// RcptTo stores addresses for which this message should be delivered as client says via `RCPT TO:`
 	RcptTo []mail.Address
+	// RcptToParameters stores ESMTP parameters client provided via `RCPT TO:` for each recipient,
+	// keys are recipient addresses as in RcptTo. Parameters are stored before RecipientCheckers are called,
+	// so checkers can read them.
+	RcptToParameters map[string]Parameters
 
-	// Body stores unparsed message body
-	Body []byte
 	// Parsed stores parsed message body
 	Parsed *mail.Message
 
@@ -77,9 +99,15 @@ type Transaction struct {
 	counters map[string]float64
 	// flags are map of bool data related to transaction
 	flags map[string]bool
+	// scores are added by plugins via Transaction.AddScore to make Verdict
+	scores []Score
+	// delayedRejection is error of plugins reported at RCPT TO command, see Server.DelayReject
+	delayedRejection *delayedRejection
 
 	// Aliases are actual users addresses used by delivery plugins
 	Aliases []mail.Address
+	// aliasOf maps aliases added via Transaction.AddAlias to original recipients they expand
+	aliasOf map[string]string
 
 	// ctx is main transaction context
 	ctx context.Context
@@ -89,17 +117,41 @@ type Transaction struct {
 	Span trace.Span
 
 	server *Server
+	// listener is policy of listener, which accepted connection
+	listener *listener
+
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+	// acceptedConn is connection as it was accepted by listener, unlike conn, it is not replaced
+	// after STARTTLS, so it is safe to use it from other goroutines
+	acceptedConn net.Conn
+	// idle is true, while transaction waits for the next command from client
+	idle atomic.Bool
+	// limits count commands issued during session
+	limits sessionLimits
+
+	// body stores message body received via DATA or BDAT commands, as client sent it
+	body *spool
+	// headers are added to message by AddHeader and AddReceivedLine, they are stored
+	// separately and are prepended to body by Transaction.BodyReader
+	headers []byte
+	// chunks accumulates message body being transferred by BDAT commands
+	chunks *spool
+	// deliveryErrors are results of message delivery DataHandlers reported for each recipient
+	// via Transaction.ReportDelivery
+	deliveryErrors map[string]error
+	// envelope stores facts, counters and flags of session, while envelope started by MAIL FROM is active
+	envelope *metadataSnapshot
+	// messagesDelivered and messagesRejected are numbers of messages processed during session
+	messagesDelivered int
+	messagesRejected  int
 
-	conn    net.Conn
-	reader  *bufio.Reader
-	writer  *bufio.Writer
-	scanner *bufio.Scanner
+	// state is current phase of session, see Transaction.State
+	state State
 
 	// closeHandlersCalled used to ensure close handlers are called only once
 	closeHandlersCalled bool
-	// dataHandlersCalledProperly shows if data handlers for transaction are called properly,
-	// so we consider it is delivered
-	dataHandlersCalledProperly bool
 }
 
 // Context returns transaction context, which is canceled when transaction is closed
@@ -110,6 +162,16 @@ func (t *Transaction) Context() context.Context {
 	return t.ctx
 }
 
+// RemoteIP returns IP address of client, or nil, if client is not connected via TCP,
+// like local clients connected via unix domain socket are
+func (t *Transaction) RemoteIP() net.IP {
+	addr, ok := t.Addr.(*net.TCPAddr)
+	if !ok {
+		return nil
+	}
+	return addr.IP
+}
+
 /*
  * Metadata manipulation
  */
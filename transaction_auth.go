@@ -1,8 +1,8 @@
 package msmtpd
 
 import (
-	"bytes"
 	"encoding/base64"
+	"errors"
 	"strings"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -22,108 +22,94 @@ func (t *Transaction) handleAUTH(cmd command) {
 	)
 	defer span.End()
 
-	var mechanism, username, password string
+	var mechanism string
 	if len(cmd.fields) < 2 {
-		t.reply(502, "Invalid syntax.")
+		t.reply(502, "5.5.4", "Invalid syntax.")
 		t.Hate(missingParameterPenalty)
 		return
 	}
-	if t.server.Authenticator == nil {
-		t.reply(502, "AUTH not supported.")
+	if !t.authenticationSupported() {
+		t.reply(502, "5.5.1", "AUTH not supported.")
 		t.Hate(missingParameterPenalty)
 		return
 	}
-	if t.HeloName == "" {
-		t.reply(502, "Please introduce yourself first.")
-		t.Hate(missingParameterPenalty)
-		return
-	}
-
-	if !t.Encrypted {
-		t.reply(502, "Cannot AUTH in plain text mode. Use STARTTLS.")
-		t.Hate(missingParameterPenalty)
+	if !t.transition(span, "AUTH", StateAuthenticated) {
 		return
 	}
 	mechanism = strings.ToUpper(cmd.fields[1])
 	span.SetAttributes(attribute.String("mechanism", mechanism))
 	t.Span.SetAttributes(attribute.String("mechanism", mechanism))
-	switch mechanism {
-	case "PLAIN":
-		auth := ""
-		if len(cmd.fields) < 3 {
-			t.reply(334, "Give me your credentials")
-			if !t.scanner.Scan() {
+	sasl, found := t.server.saslMechanism(mechanism)
+	if !found {
+		t.LogDebug("unknown authentication mechanism: %s", mechanism)
+		t.reply(502, "5.5.4", "Unknown authentication mechanism")
+		return
+	}
+	var response []byte
+	var err error
+	if len(cmd.fields) > 2 {
+		// `=` means initial response is empty, see RFC 4954 section 4
+		if cmd.fields[2] == "=" {
+			response = []byte{}
+		} else {
+			response, err = base64.StdEncoding.DecodeString(cmd.fields[2])
+			if err != nil {
+				t.Hate(missingParameterPenalty)
+				t.error(ErrAuthenticationCredentialsMalformed)
 				return
 			}
-			auth = t.scanner.Text()
-		} else {
-			auth = cmd.fields[2]
 		}
-		data, err := base64.StdEncoding.DecodeString(auth)
-		if err != nil {
-			t.Hate(missingParameterPenalty)
-			t.reply(502, "Couldn't decode your credentials")
+	}
+	exchange := sasl.Start(t)
+	for {
+		challenge, done, nextErr := exchange.Next(ctxWithTracer, response)
+		if nextErr != nil {
+			span.AddEvent("authentication failed")
+			t.error(nextErr)
 			return
 		}
-		parts := bytes.Split(data, []byte{0})
-		if len(parts) != 3 {
+		if done {
+			break
+		}
+		t.reply(334, "", base64.StdEncoding.EncodeToString(challenge))
+		t.flush()
+		line, readErr := t.readLine()
+		if errors.Is(readErr, errLineTooLong) {
+			span.AddEvent("authentication response is too long")
 			t.Hate(missingParameterPenalty)
-			t.reply(502, "Couldn't decode your credentials")
+			t.reply(500, "5.5.6", "Authentication Exchange line is too long")
 			return
 		}
-		username = string(parts[1])
-		password = string(parts[2])
-
-	case "LOGIN":
-		encodedUsername := ""
-		if len(cmd.fields) < 3 {
-			t.reply(334, "VXNlcm5hbWU6") // `Username:`
-			if !t.scanner.Scan() {
-				return
-			}
-			encodedUsername = t.scanner.Text()
-		} else {
-			encodedUsername = cmd.fields[2]
-		}
-		byteUsername, err := base64.StdEncoding.DecodeString(encodedUsername)
-		if err != nil {
-			t.Hate(missingParameterPenalty)
-			t.reply(502, "Couldn't decode your credentials")
+		if readErr != nil {
+			// network errors and ErrServerClosed are reported by Transaction.serve,
+			// which reads next command from the same connection
 			return
 		}
-		t.reply(334, "UGFzc3dvcmQ6") // `Password:`
-		if !t.scanner.Scan() {
+		if line == "*" {
+			t.LogDebug("authentication via %s is canceled by client", mechanism)
+			span.AddEvent("authentication canceled")
+			t.reply(501, "5.7.0", "Authentication canceled.")
 			return
 		}
-		bytePassword, err := base64.StdEncoding.DecodeString(t.scanner.Text())
+		response, err = base64.StdEncoding.DecodeString(line)
 		if err != nil {
-			t.reply(502, "Couldn't decode your credentials")
+			t.Hate(missingParameterPenalty)
+			t.error(ErrAuthenticationCredentialsMalformed)
 			return
 		}
-		username = string(byteUsername)
-		password = string(bytePassword)
-
-	default:
-		t.LogDebug("unknown authentication mechanism: %s", mechanism)
-		t.reply(502, "Unknown authentication mechanism")
-		return
 	}
-	t.LogDebug("Trying to authorise %s with password %s using mechanism %s",
-		username, mask(password), mechanism,
-	)
-	err := t.server.Authenticator(ctxWithTracer, t, username, password)
-	if err != nil {
-		t.error(err)
+	if t.Username == "" {
+		t.LogWarn("%s mechanism completed exchange without setting username", mechanism)
+		t.error(ErrAuthenticationCredentialsInvalid)
 		return
 	}
-	t.Username = username
-	t.Password = password
-	// i know saving password here is security risk, but we can implement something like
-	// Haraka plugin to prevent credential leaks
-	// https://haraka.github.io/plugins/prevent_credential_leaks
-	t.Span.SetAttributes(semconv.UserName(username))
-	t.Span.SetAttributes(attribute.String("user.password", mask(password)))
-	span.SetAttributes(semconv.UserName(username))
-	span.SetAttributes(attribute.String("user.password", mask(password)))
-	t.reply(235, "OK, you are now authenticated")
+	t.LogInfo("Authenticated as %s using mechanism %s", t.Username, mechanism)
+	t.Span.SetAttributes(semconv.UserName(t.Username))
+	span.SetAttributes(semconv.UserName(t.Username))
+	if t.Password != "" {
+		t.Span.SetAttributes(attribute.String("user.password", mask(t.Password)))
+		span.SetAttributes(attribute.String("user.password", mask(t.Password)))
+	}
+	t.setState(ctxWithTracer, StateAuthenticated)
+	t.reply(235, "2.7.0", "OK, you are now authenticated")
 }
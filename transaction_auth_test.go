@@ -3,6 +3,7 @@ package msmtpd
 import (
 	"crypto/tls"
 	"net/smtp"
+	"strings"
 	"testing"
 
 	"github.com/vodolaz095/msmtpd/internal"
@@ -201,3 +202,38 @@ func TestAuthenticationErrors(t *testing.T) {
 		t.Errorf("Quit failed: %v", err)
 	}
 }
+
+func TestAuthResponseTooLong(t *testing.T) {
+	server := &Server{
+		Authenticator: AuthenticatorForTestsThatAlwaysWorks,
+	}
+	addr, closer := RunTestServerWithTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.StartTLS(&tls.Config{InsecureSkipVerify: true}); err != nil {
+		t.Errorf("STARTTLS failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 334, "AUTH LOGIN"); err != nil {
+		t.Errorf("AUTH didn't work: %v", err)
+	}
+	id, err := c.Text.Cmd("%s", strings.Repeat("Zm9v", maxLineLength/4+1))
+	if err != nil {
+		t.Fatalf("%s : while sending too long response", err)
+	}
+	c.Text.StartResponse(id)
+	_, msg, err := c.Text.ReadResponse(500)
+	c.Text.EndResponse(id)
+	if err != nil || !strings.HasPrefix(msg, "5.5.6 ") {
+		t.Errorf("too long response is not rejected: %v", err)
+	}
+	if err = c.Noop(); err != nil {
+		t.Errorf("NOOP failed after too long response: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+}
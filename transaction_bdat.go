@@ -0,0 +1,101 @@
+package msmtpd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Good read - https://www.rfc-editor.org/rfc/rfc3030
+// Example: `BDAT 86 LAST` followed by 86 bytes of message body
+
+func (t *Transaction) handleBDAT(cmd command) {
+	ctx, span := t.server.Tracer.Start(t.Context(), "handle_bdat",
+		trace.WithSpanKind(trace.SpanKindInternal), // важно
+	)
+	cmd.attachToSpan(span)
+	defer span.End()
+
+	var last bool
+	if len(cmd.fields) < 2 || len(cmd.fields) > 3 {
+		t.Hate(missingParameterPenalty)
+		t.reply(502, "5.5.4", "Invalid syntax.")
+		return
+	}
+	size, err := strconv.ParseUint(cmd.fields[1], 10, 63)
+	if err != nil {
+		t.Hate(missingParameterPenalty)
+		t.reply(502, "5.5.4", "Invalid syntax.")
+		return
+	}
+	if len(cmd.fields) == 3 {
+		if strings.ToUpper(cmd.fields[2]) != "LAST" {
+			t.Hate(missingParameterPenalty)
+			t.reply(502, "5.5.4", "Invalid syntax.")
+			return
+		}
+		last = true
+	}
+	span.SetAttributes(attribute.Int64("chunk_size", int64(size)), attribute.Bool("last", last))
+	// chunk is always sent by client without waiting for our reply,
+	// so we need to consume it, even if we are going to reject it
+	if !t.transition(span, "BDAT", StateData) {
+		t.discardChunk(size)
+		return
+	}
+	err = t.conn.SetDeadline(t.deadline(t.server.DataTimeout))
+	if err != nil {
+		t.LogError(err, "while setting deadline for connection")
+		return
+	}
+	if t.chunks == nil {
+		t.chunks = t.startBody()
+		t.setState(ctx, StateData)
+	}
+	if uint64(t.chunks.Size())+size > uint64(t.listener.MaxMessageSize) {
+		t.LogDebug("BDAT chunk of %v bytes makes message bigger than %v bytes",
+			size, t.listener.MaxMessageSize)
+		span.AddEvent("message is too big")
+		if !t.discardChunk(size) {
+			return
+		}
+		if last {
+			// in LMTP mode, reply is sent for every recipient after last chunk
+			t.rejectMessage(t.errMessageTooBig())
+		} else {
+			t.error(t.errMessageTooBig())
+		}
+		t.Hate(tooBigMessagePenalty)
+		t.finishMessage(false)
+		return
+	}
+	_, err = io.CopyN(t.chunks, t.reader, int64(size))
+	if err != nil {
+		t.LogError(err, "possible network error while reading BDAT chunk")
+		return
+	}
+	if !last {
+		t.LogDebug("BDAT chunk of %v bytes received, %v bytes in total",
+			size, t.chunks.Size())
+		t.reply(250, "2.0.0", fmt.Sprintf("%d bytes received, go on, please!", size))
+		return
+	}
+	t.LogDebug("Last BDAT chunk of %v bytes received, message has %v bytes",
+		size, t.chunks.Size())
+	t.chunks = nil
+	t.processMessage(ctx, span)
+}
+
+// discardChunk reads BDAT chunk of size provided from client and throws it away
+func (t *Transaction) discardChunk(size uint64) (ok bool) {
+	_, err := io.CopyN(io.Discard, t.reader, int64(size))
+	if err != nil {
+		t.LogDebug("possible network error: %s", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package msmtpd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func sendChunk(c *smtp.Client, expectedCode int, chunk string, last bool) error {
+	var err error
+	if last {
+		_, err = fmt.Fprintf(c.Text.W, "BDAT %d LAST\r\n%s", len(chunk), chunk)
+	} else {
+		_, err = fmt.Fprintf(c.Text.W, "BDAT %d\r\n%s", len(chunk), chunk)
+	}
+	if err != nil {
+		return err
+	}
+	err = c.Text.W.Flush()
+	if err != nil {
+		return err
+	}
+	_, _, err = c.Text.ReadResponse(expectedCode)
+	return err
+}
+
+func TestBDATExtensionsAdvertised(t *testing.T) {
+	server := &Server{}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Errorf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if supported, _ := c.Extension("CHUNKING"); !supported {
+		t.Error("CHUNKING not supported")
+	}
+	if supported, _ := c.Extension("BINARYMIME"); !supported {
+		t.Error("BINARYMIME not supported")
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("QUIT failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+}
+
+func TestBDATSuccess(t *testing.T) {
+	var delivered bool
+	message := internal.MakeTestMessage("sender@example.org", "recipient@example.net")
+	server := &Server{
+		DataHandlers: []DataHandler{
+			func(_ context.Context, tr *Transaction) error {
+				body, err := io.ReadAll(tr.BodyReader())
+				if err != nil {
+					t.Errorf("%s : while reading message body", err)
+				}
+				if !strings.Contains(string(body), message) {
+					t.Errorf("wrong message body: %s", string(body))
+				}
+				if !strings.HasPrefix(tr.Parsed.Header.Get("Subject"), "Test email send on") {
+					t.Errorf("wrong subject %s", tr.Parsed.Header.Get("Subject"))
+				}
+				delivered = true
+				return nil
+			},
+		},
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Errorf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed: %v", err)
+	}
+	if err = c.Rcpt("recipient@example.net"); err != nil {
+		t.Errorf("RCPT failed: %v", err)
+	}
+	half := len(message) / 2
+	if err = sendChunk(c, 250, message[:half], false); err != nil {
+		t.Errorf("%s : while sending 1st chunk", err)
+	}
+	err = internal.DoCommand(c.Text, 503, "DATA")
+	if err != nil {
+		t.Errorf("%s : while calling DATA after BDAT", err)
+	}
+	if err = sendChunk(c, 250, message[half:], true); err != nil {
+		t.Errorf("%s : while sending last chunk", err)
+	}
+	if !delivered {
+		t.Errorf("message is not delivered")
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("QUIT failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+}
+
+func TestBDATMaxMessageSize(t *testing.T) {
+	server := &Server{
+		MaxMessageSize: 100,
+		DataHandlers: []DataHandler{
+			func(_ context.Context, tr *Transaction) error {
+				t.Errorf("message should not be delivered")
+				return nil
+			},
+		},
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Errorf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed: %v", err)
+	}
+	if err = c.Rcpt("recipient@example.net"); err != nil {
+		t.Errorf("RCPT failed: %v", err)
+	}
+	if err = sendChunk(c, 250, strings.Repeat("a", 60), false); err != nil {
+		t.Errorf("%s : while sending 1st chunk", err)
+	}
+	if err = sendChunk(c, 552, strings.Repeat("b", 60), true); err != nil {
+		t.Errorf("%s : while sending chunk exceeding message size", err)
+	}
+	if err = c.Noop(); err != nil {
+		t.Errorf("%s : while sending NOOP after chunk is discarded", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("QUIT failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+}
+
+func TestBDATWrongOrder(t *testing.T) {
+	server := &Server{}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Errorf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = sendChunk(c, 502, "something", true); err != nil {
+		t.Errorf("%s : while sending BDAT without MAIL FROM", err)
+	}
+	err = internal.DoCommand(c.Text, 502, "BDAT something")
+	if err != nil {
+		t.Errorf("%s : while sending malformed BDAT", err)
+	}
+	if err = c.Noop(); err != nil {
+		t.Errorf("%s : while sending NOOP after chunk is discarded", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("QUIT failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+}
+
+func TestBINARYMIMERequiresBDAT(t *testing.T) {
+	server := &Server{}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 250, "MAIL FROM:<sender@example.org> BODY=BINARYMIME"); err != nil {
+		t.Errorf("MAIL FROM failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 250, "RCPT TO:<recipient@example.net>"); err != nil {
+		t.Errorf("RCPT TO failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 503, "DATA"); err != nil {
+		t.Errorf("DATA is accepted for BINARYMIME message: %v", err)
+	}
+	if err = sendChunk(c, 250, internal.MakeTestMessage("sender@example.org", "recipient@example.net"), true); err != nil {
+		t.Errorf("%s : while sending BINARYMIME message via BDAT", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("QUIT failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+}
@@ -0,0 +1,97 @@
+package msmtpd
+
+import (
+	"io"
+)
+
+/*
+ * Message body access
+ */
+
+// BodyReader returns reader for message body received via DATA or BDAT commands,
+// with headers added by AddHeader and AddReceivedLine on top. Body is stored in memory or,
+// if it is bigger than Server.SpoolThreshold, in temporary file, so DataCheckers and DataHandlers
+// should read it in chunks instead of loading it into memory. Every call returns new reader,
+// so body can be read many times, even concurrently.
+func (t *Transaction) BodyReader() *io.SectionReader {
+	return io.NewSectionReader(t.bodyReaderAt(), 0, t.BodySize())
+}
+
+// BodySize returns size of message body in bytes, with headers added by AddHeader and AddReceivedLine
+func (t *Transaction) BodySize() int64 {
+	if t.body == nil {
+		return int64(len(t.headers))
+	}
+	return int64(len(t.headers)) + t.body.Size()
+}
+
+// SetBody replaces message body with data from reader provided, headers added by AddHeader
+// and AddReceivedLine are dropped. It can be used by plugins rewriting messages, and by tests,
+// which make Transaction without Server. Reader can be obtained via BodyReader, so plugins can
+// stream rewritten message without loading it into memory. Previous body is kept, if error occurs.
+// Transaction.Parsed is not updated.
+func (t *Transaction) SetBody(r io.Reader) error {
+	body := t.newBody()
+	_, err := io.Copy(body, r)
+	if err == nil {
+		err = body.Err()
+	}
+	if err != nil {
+		closeErr := body.Close()
+		if closeErr != nil {
+			t.LogError(closeErr, "while removing message body spool")
+		}
+		return err
+	}
+	t.releaseBody()
+	t.body = body
+	return nil
+}
+
+// Body returns message body with headers added by AddHeader and AddReceivedLine on top,
+// loading whole message into memory.
+//
+// Deprecated: Body was public byte slice before message bodies were spooled to temporary files,
+// use BodyReader and BodySize to read message body, and SetBody to replace it.
+func (t *Transaction) Body() []byte {
+	body, err := io.ReadAll(t.BodyReader())
+	if err != nil {
+		t.LogError(err, "while reading message body")
+	}
+	return body
+}
+
+func (t *Transaction) bodyReaderAt() io.ReaderAt {
+	if t.body == nil {
+		return messageReaderAt{headers: t.headers, body: newSpool("", 0)}
+	}
+	return messageReaderAt{headers: t.headers, body: t.body}
+}
+
+// startBody releases previous message body and prepares spool for the new one
+func (t *Transaction) startBody() *spool {
+	t.releaseBody()
+	t.body = t.newBody()
+	return t.body
+}
+
+// newBody makes empty spool for message body according to Server.SpoolDirectory and Server.SpoolThreshold
+func (t *Transaction) newBody() *spool {
+	if t.server == nil {
+		return newSpool("", DefaultSpoolThreshold)
+	}
+	return newSpool(t.server.SpoolDirectory, t.server.SpoolThreshold)
+}
+
+// releaseBody frees memory and removes temporary file used by message body
+func (t *Transaction) releaseBody() {
+	t.headers = nil
+	if t.body == nil {
+		return
+	}
+	err := t.body.Close()
+	if err != nil {
+		t.LogError(err, "while removing message body spool")
+	}
+	t.body = nil
+}
@@ -1,11 +1,12 @@
 package msmtpd
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/mail"
 	"net/textproto"
+	"strings"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -39,190 +40,236 @@ func (t *Transaction) handleDATA(cmd command) {
 	cmd.attachToSpan(span)
 	defer span.End()
 
+	if !t.transition(span, "DATA", StateData) {
+		return
+	}
+	if strings.EqualFold(t.MailFromParameters.Get("BODY"), "BINARYMIME") {
+		// binary content cannot be transferred via DATA, see RFC 3030, section 3
+		span.AddEvent("DATA called for BINARYMIME message")
+		t.LogDebug("DATA called for message declared as BODY=BINARYMIME")
+		t.Hate(wrongCommandOrderPenalty)
+		t.reply(503, "5.5.1", "Message declared as BODY=BINARYMIME should be sent via BDAT, please.")
+		return
+	}
+	t.LogDebug("DATA is called...")
+	t.setState(ctx, StateData)
+	t.reply(354, "", "Ok, you managed to talk me into accepting your message. Go on, end your data with <CR><LF>.<CR><LF>")
+	t.flush()
+	err := t.conn.SetDeadline(t.deadline(t.server.DataTimeout))
+	if err != nil {
+		t.LogError(err, "while setting deadline for connection")
+		return
+	}
+	data := t.startBody()
+	reader := textproto.NewReader(t.reader).DotReader()
+	_, err = io.CopyN(data, reader, int64(t.listener.MaxMessageSize))
+	if err != nil {
+		if err == io.EOF {
+			// EOF was reached before MaxMessageSize, so we can accept and deliver message
+			t.processMessage(ctx, span)
+			return
+		}
+		t.LogError(err, "possible network error while reading message data")
+	}
+
+	// Discard the rest and report an error.
+	_, err = io.Copy(io.Discard, reader)
+	if err != nil {
+		t.LogDebug("possible network error: %s", err)
+		return
+	}
+	t.rejectMessage(t.errMessageTooBig())
+	t.Hate(tooBigMessagePenalty)
+	t.finishMessage(false)
+}
+
+// errMessageTooBig is reported to client, when message is bigger than MaxMessageSize of listener
+func (t *Transaction) errMessageTooBig() ErrorSMTP {
+	return ErrorSMTP{
+		Code:         552,
+		EnhancedCode: "5.3.4",
+		Message: fmt.Sprintf("Your message is too big, try to say it in less than %d bytes, please!",
+			t.listener.MaxMessageSize),
+	}
+}
+
+// processMessage parses message body received via DATA or BDAT commands, and passes it
+// to DataCheckers and DataHandlers
+func (t *Transaction) processMessage(ctx context.Context, span trace.Span) {
 	var checkErr error
 	var deliverErr error
 	var createdAt time.Time
 	var from []*mail.Address
+	var delivered bool
+	// message is either accepted or rejected, so mail transaction is finished anyway
+	defer func() {
+		t.finishMessage(delivered)
+	}()
 
-	if t.HeloName == "" {
-		t.LogDebug("DATA called without HELO/EHLO!")
-		span.AddEvent("DATA called without HELO/EHLO!")
-		t.Hate(missingParameterPenalty)
-		t.reply(502, "Please introduce yourself first.")
+	if t.body.Err() != nil {
+		t.LogError(t.body.Err(), "while spooling message body")
+		t.rejectMessage(ErrInsufficientStorage)
 		return
 	}
-	if !t.Encrypted && t.server.ForceTLS {
-		t.LogDebug("DATA called without STARTTLS!")
-		span.AddEvent("DATA called without STARTTLS!")
-		t.Hate(missingParameterPenalty)
-		t.reply(502, "Please turn on TLS by issuing a STARTTLS command.")
-		return
+	size := t.body.Size()
+	if !t.server.HideTransactionHeader {
+		t.AddHeader("MSMTPD-Transaction-Id", t.ID)
 	}
-	if t.server.Authenticator != nil && t.Username == "" {
-		t.LogDebug("DATA called without authentication!")
-		span.AddEvent("DATA called without authentication!")
-		t.Hate(missingParameterPenalty)
-		t.reply(530, "Authentication Required.")
+	t.AddReceivedLine() // will be added as first one
+	t.LogDebug("Parsing message body with size %v (stored in memory: %v)...", size, t.body.InMemory())
+	t.Span.SetAttributes(attribute.Int64("size", size))
+	span.SetAttributes(attribute.Int64("size", size))
+	t.Parsed, checkErr = mail.ReadMessage(t.BodyReader())
+	if checkErr != nil {
+		t.LogWarn("%s : while parsing message body", checkErr)
+		t.Hate(tooBigMessagePenalty)
+		t.rejectMessage(ErrorSMTP{
+			Code:         521,
+			EnhancedCode: "5.6.0",
+			Message:      "Stop sending me this nonsense, please!",
+		})
 		return
 	}
-	if t.MailFrom.Address == "" && !t.IsFlagSet(NullSenderFlag) {
-		t.Hate(missingParameterPenalty)
-		t.LogDebug("DATA called without MAIL FROM!")
-		span.AddEvent("DATA called without MAIL FROM!")
-		t.reply(502, "It seems you haven't called MAIL FROM in order to explain who sends your message.")
+	// date header is mandatory according to RFC 5322
+	createdAt, checkErr = t.Parsed.Header.Date()
+	if checkErr != nil {
+		t.LogWarn("%s : while parsing message date", checkErr)
+		t.Hate(malformedMessagePenalty)
+		t.rejectMessage(ErrorSMTP{
+			Code:         521,
+			EnhancedCode: "5.6.0",
+			Message:      "Stop sending me this nonsense, please!",
+		})
 		return
 	}
-	if len(t.RcptTo) == 0 {
-		t.Hate(missingParameterPenalty)
-		t.LogDebug("DATA called without RCPT TO!")
-		t.reply(502, "It seems you haven't called RCPT TO in order to explain for whom do you want to deliver your message.")
+	t.LogInfo("Message created on %s - %s ago",
+		createdAt.Format(timeFormatForHeaders),
+		time.Since(createdAt).String(),
+	)
+	// from header is mandatory according to RFC 5322
+	from, checkErr = t.Parsed.Header.AddressList("From")
+	if checkErr != nil {
+		t.LogWarn("%s : while parsing message from header %s",
+			checkErr, t.Parsed.Header.Get("From"),
+		)
+		t.Hate(malformedMessagePenalty)
+		t.rejectMessage(ErrorSMTP{
+			Code:         521,
+			EnhancedCode: "5.6.0",
+			Message:      "Stop sending me this nonsense, please!",
+		})
 		return
 	}
-	t.LogDebug("DATA is called...")
-	t.reply(354, "Ok, you managed to talk me into accepting your message. Go on, end your data with <CR><LF>.<CR><LF>")
-	err := t.conn.SetDeadline(time.Now().Add(t.server.DataTimeout))
-	if err != nil {
-		t.LogError(err, "while setting deadline for connection")
+	if len(from) != 1 {
+		t.LogWarn("From should contain 1 address")
+		t.Hate(malformedMessagePenalty)
+		t.rejectMessage(ErrorSMTP{
+			Code:         521,
+			EnhancedCode: "5.6.0",
+			Message:      "Stop sending me this nonsense, please!",
+		})
 		return
 	}
-	data := bytes.NewBufferString("")
-	reader := textproto.NewReader(t.reader).DotReader()
-	_, err = io.CopyN(data, reader, int64(t.server.MaxMessageSize))
-	if err != nil {
-		if err == io.EOF {
-			// EOF was reached before MaxMessageSize, so we can accept and deliver message
-			t.Body = data.Bytes()
-			if !t.server.HideTransactionHeader {
-				t.AddHeader("MSMTPD-Transaction-Id", t.ID)
-			}
-			t.AddReceivedLine() // will be added as first one
-			t.LogDebug("Parsing message body with size %v...", data.Len())
-			t.Span.SetAttributes(attribute.Int("size", data.Len()))
-			span.SetAttributes(attribute.Int("size", data.Len()))
-			t.Parsed, checkErr = mail.ReadMessage(bytes.NewReader(t.Body))
-			if checkErr != nil {
-				t.LogWarn("%s : while parsing message body", checkErr)
-				t.Hate(tooBigMessagePenalty)
-				t.error(ErrorSMTP{
-					Code:    521,
-					Message: "Stop sending me this nonsense, please!",
-				})
-				return
-			}
-			// date header is mandatory according to RFC 5322
-			createdAt, checkErr = t.Parsed.Header.Date()
-			if checkErr != nil {
-				t.LogWarn("%s : while parsing message date", checkErr)
-				t.Hate(malformedMessagePenalty)
-				t.error(ErrorSMTP{
-					Code:    521,
-					Message: "Stop sending me this nonsense, please!",
-				})
-				return
-			}
-			t.LogInfo("Message created on %s - %s ago",
-				createdAt.Format(timeFormatForHeaders),
-				time.Since(createdAt).String(),
-			)
-			// from header is mandatory according to RFC 5322
-			from, checkErr = t.Parsed.Header.AddressList("From")
-			if checkErr != nil {
-				t.LogWarn("%s : while parsing message from header %s",
-					checkErr, t.Parsed.Header.Get("From"),
+
+	// check for duplicate headers
+	for _, header := range uniqueHeaders {
+		parts, found := t.Parsed.Header[header]
+		if found {
+			if len(parts) > 1 {
+				t.LogWarn("Duplicate header %s %v is found",
+					header, parts,
 				)
 				t.Hate(malformedMessagePenalty)
-				t.error(ErrorSMTP{
-					Code:    521,
-					Message: "Stop sending me this nonsense, please!",
-				})
-				return
-			}
-			if len(from) != 1 {
-				t.LogWarn("From should contain 1 address")
-				t.Hate(malformedMessagePenalty)
-				t.error(ErrorSMTP{
-					Code:    521,
-					Message: "Stop sending me this nonsense, please!",
+				t.rejectMessage(ErrorSMTP{
+					Code:         521,
+					EnhancedCode: "5.6.0",
+					Message:      "Stop sending me this nonsense, please!",
 				})
 				return
 			}
+		}
+	}
 
-			// check for duplicate headers
-			for _, header := range uniqueHeaders {
-				parts, found := t.Parsed.Header[header]
-				if found {
-					if len(parts) > 1 {
-						t.LogWarn("Duplicate header %s %v is found",
-							header, parts,
-						)
-						t.error(ErrorSMTP{
-							Code:    521,
-							Message: "Stop sending me this nonsense, please!",
-						})
-					}
-				}
-			}
-
-			subject := t.Parsed.Header.Get("Subject")
-			if subject != "" {
-				decoded, decodeErr := decodeBase64EncodedSubject(subject)
-				if decodeErr != nil {
-					t.LogWarn("%s : while decoding base64 encoded header", decodeErr)
-				} else {
-					subject = decoded
-					t.LogInfo("Subject: %s", subject)
-					t.Span.SetAttributes(attribute.String("subject", subject))
-					span.SetAttributes(attribute.String("subject", subject))
-					t.SetFact(SubjectFact, subject)
-				}
-			}
+	subject := t.Parsed.Header.Get("Subject")
+	if subject != "" {
+		decoded, decodeErr := decodeBase64EncodedSubject(subject)
+		if decodeErr != nil {
+			t.LogWarn("%s : while decoding base64 encoded header", decodeErr)
+		} else {
+			subject = decoded
+			t.LogInfo("Subject: %s", subject)
+			t.Span.SetAttributes(attribute.String("subject", subject))
+			span.SetAttributes(attribute.String("subject", subject))
+			t.SetFact(SubjectFact, subject)
+		}
+	}
 
-			t.LogDebug("Message body of %v bytes is parsed, calling %v DataCheckers on it",
-				data.Len(), len(t.server.DataCheckers))
-			for j := range t.server.DataCheckers {
-				checkErr = t.server.DataCheckers[j](ctx, t)
-				if checkErr != nil {
-					t.error(checkErr)
-					return
-				}
-			}
-			t.LogInfo("Body (%v bytes) checked by %v DataCheckers successfully!",
-				data.Len(), len(t.server.DataCheckers))
-			t.Love(commandExecutedProperly)
+	t.LogDebug("Message body of %v bytes is parsed, calling %v DataCheckers on it",
+		size, len(t.listener.DataCheckers))
+	checkErr = t.runPhase(ctx, PhaseData, len(t.listener.DataCheckers),
+		func(pluginCtx context.Context, j int) error {
+			return t.listener.DataCheckers[j](pluginCtx, t)
+		})
+	alwaysAccepted := t.recipientsAlwaysAccepted()
+	if checkErr == nil && !alwaysAccepted {
+		checkErr = t.verdictError(span)
+	}
+	if checkErr != nil {
+		t.rejectMessage(checkErr)
+		return
+	}
+	t.LogInfo("Body (%v bytes) checked by %v DataCheckers successfully!",
+		size, len(t.listener.DataCheckers))
+	t.Love(commandExecutedProperly)
 
-			t.LogDebug("Starting delivery by %v DataHandlers...", len(t.server.DataHandlers))
-			for k := range t.server.DataHandlers {
-				deliverErr = t.server.DataHandlers[k](ctx, t)
-				if deliverErr != nil {
-					t.error(deliverErr)
-					return
-				}
-			}
-			if len(t.server.DataHandlers) > 0 {
-				t.LogInfo("Message delivered by %v DataHandlers...", len(t.server.DataHandlers))
-			} else {
-				t.LogWarn("Message silently discarded - no DataHandlers set...")
-			}
-			span.AddEvent("body accepted")
-			t.reply(250, "Thank you.")
-			t.Love(commandExecutedProperly)
-			t.reset()
-			t.dataHandlersCalledProperly = true
-			return
+	verdict := t.Verdict()
+	if alwaysAccepted && verdict.Action != VerdictQuarantine {
+		// message to postmaster or abuse is delivered, even if it looks like spam
+		verdict.Action = VerdictAccept
+	}
+	if len(verdict.Scores) > 0 {
+		t.AddHeader(VerdictHeader, verdict.String())
+	}
+	switch verdict.Action {
+	case VerdictDiscard:
+		// client is told message is accepted, so it will not retry delivery
+		t.LogInfo("Message is silently discarded according to verdict: %s", verdict)
+		span.AddEvent("body discarded")
+		if t.server.LMTP {
+			t.replyForRecipients(nil)
+		} else {
+			t.reply(250, "2.6.0", "Thank you.")
 		}
-		t.LogError(err, "possible network error while reading message data")
+		return
+	case VerdictQuarantine:
+		t.LogInfo("Message is delivered to quarantine according to verdict: %s", verdict)
+		span.AddEvent("body quarantined")
+		t.SetFlag(QuarantineFlag)
 	}
 
-	// Discard the rest and report an error.
-	_, err = io.Copy(io.Discard, reader)
-	if err != nil {
-		t.LogDebug("possible network error: %s", err)
+	t.LogDebug("Starting delivery by %v DataHandlers...", len(t.listener.DataHandlers))
+	deliverErr = t.runPhase(ctx, PhaseDelivery, len(t.listener.DataHandlers),
+		func(pluginCtx context.Context, k int) error {
+			return t.listener.DataHandlers[k](pluginCtx, t)
+		})
+	if t.server.LMTP {
+		if !t.replyForRecipients(deliverErr) {
+			t.LogWarn("Message is not delivered to any of %v recipients", len(t.RcptTo))
+			return
+		}
+	} else if deliverErr != nil {
+		t.error(deliverErr)
 		return
 	}
-	t.reply(552, fmt.Sprintf(
-		"Your message is too big, try to say it in less than %d bytes, please!",
-		t.server.MaxMessageSize,
-	))
-	t.Hate(tooBigMessagePenalty)
-	t.reset()
+	if len(t.listener.DataHandlers) > 0 {
+		t.LogInfo("Message delivered by %v DataHandlers...", len(t.listener.DataHandlers))
+	} else {
+		t.LogWarn("Message silently discarded - no DataHandlers set...")
+	}
+	span.AddEvent("body accepted")
+	if !t.server.LMTP {
+		t.reply(250, "2.6.0", "Thank you.")
+	}
+	t.Love(commandExecutedProperly)
+	delivered = true
 }
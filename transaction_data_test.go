@@ -5,6 +5,7 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"net/mail"
 	"net/smtp"
 	"strings"
@@ -64,8 +65,12 @@ func TestDataHandler(t *testing.T) {
 		if tr.RcptTo[0].Address != "recipient@example.net" {
 			t.Errorf("Unknown recipient: %v", tr.RcptTo[0].Address)
 		}
-		if !strings.Contains(string(tr.Body), "This is test message send from sender@example.org to recipient@example.net on") {
-			t.Errorf("Wrong message body: %v", string(tr.Body))
+		body, err := io.ReadAll(tr.BodyReader())
+		if err != nil {
+			t.Errorf("%s : while reading message body", err)
+		}
+		if !strings.Contains(string(body), "This is test message send from sender@example.org to recipient@example.net on") {
+			t.Errorf("Wrong message body: %v", string(body))
 		}
 		subject, found := tr.GetFact(SubjectFact)
 		if !found {
@@ -157,7 +162,7 @@ func TestWrongOrderForData(t *testing.T) {
 	}
 	_, err = c.Data()
 	if err != nil {
-		if err.Error() != "502 Please introduce yourself first." {
+		if err.Error() != "502 5.5.1 Please introduce yourself first." {
 			t.Errorf("%s : wrong error while helo not called", err)
 		}
 	} else {
@@ -169,7 +174,7 @@ func TestWrongOrderForData(t *testing.T) {
 	}
 	_, err = c.Data()
 	if err != nil {
-		if err.Error() != "502 Please turn on TLS by issuing a STARTTLS command." {
+		if err.Error() != "502 5.7.0 Please turn on TLS by issuing a STARTTLS command." {
 			t.Errorf("%s : wrong error while STARTTLS not called", err)
 		}
 	} else {
@@ -181,7 +186,7 @@ func TestWrongOrderForData(t *testing.T) {
 	}
 	_, err = c.Data()
 	if err != nil {
-		if err.Error() != "530 Authentication Required." {
+		if err.Error() != "530 5.7.0 Authentication Required." {
 			t.Errorf("%s : wrong error while STARTTLS not called", err)
 		}
 	} else {
@@ -193,7 +198,7 @@ func TestWrongOrderForData(t *testing.T) {
 	}
 	_, err = c.Data()
 	if err != nil {
-		if err.Error() != "502 It seems you haven't called MAIL FROM in order to explain who sends your message." {
+		if err.Error() != "502 5.5.1 It seems you haven't called MAIL FROM in order to explain who sends your message." {
 			t.Errorf("%s : wrong error while MAIL FROM not called", err)
 		}
 	} else {
@@ -205,7 +210,7 @@ func TestWrongOrderForData(t *testing.T) {
 	}
 	_, err = c.Data()
 	if err != nil {
-		if err.Error() != "502 It seems you haven't called RCPT TO in order to explain for whom do you want to deliver your message." {
+		if err.Error() != "502 5.5.1 It seems you haven't called RCPT TO in order to explain for whom do you want to deliver your message." {
 			t.Errorf("%s : wrong error while RCPT TO not called", err)
 		}
 	} else {
@@ -270,7 +275,7 @@ func TestRejectByDataChecker(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() != "502 something is broken" {
+		if err.Error() != "502 5.0.0 something is broken" {
 			t.Errorf("%s : while closing data", err)
 		}
 	} else {
@@ -286,7 +291,11 @@ func TestEnvelopeReceived(t *testing.T) {
 		Hostname: "foobar.example.net",
 		DataHandlers: []DataHandler{
 			func(_ context.Context, tr *Transaction) error {
-				if !bytes.HasPrefix(tr.Body, []byte("Received: from localhost ([127.0.0.1]) by foobar.example.net with ESMTP;")) {
+				body, err := io.ReadAll(tr.BodyReader())
+				if err != nil {
+					t.Errorf("%s : while reading message body", err)
+				}
+				if !bytes.HasPrefix(body, []byte("Received: from localhost ([127.0.0.1]) by foobar.example.net with ESMTP;")) {
 					t.Error("Wrong received line.")
 				}
 				return nil
@@ -331,7 +340,11 @@ func TestAddExtraHeader(t *testing.T) {
 		DataHandlers: []DataHandler{
 			func(_ context.Context, tr *Transaction) error {
 				tr.AddHeader("Something", "interesting")
-				if !bytes.HasPrefix(tr.Body, []byte("Something: interesting")) {
+				body, err := io.ReadAll(tr.BodyReader())
+				if err != nil {
+					t.Errorf("%s : while reading message body", err)
+				}
+				if !bytes.HasPrefix(body, []byte("Something: interesting")) {
 					t.Error("Wrong extra header line.")
 				}
 				val, found := tr.Parsed.Header["Something"]
@@ -391,10 +404,14 @@ func TestTwoExtraHeadersMakeMessageParsable(t *testing.T) {
 				tr.AddHeader("Something1", "interesting 1")
 				tr.AddHeader("Something2", "interesting 2")
 				tr.AddReceivedLine()
-				if !bytes.HasPrefix(tr.Body, []byte("Received: from localhost ([127.0.0.1]) by foobar.example.net with ESMTP;")) {
+				body, err := io.ReadAll(tr.BodyReader())
+				if err != nil {
+					t.Errorf("%s : while reading message body", err)
+				}
+				if !bytes.HasPrefix(body, []byte("Received: from localhost ([127.0.0.1]) by foobar.example.net with ESMTP;")) {
 					t.Error("Wrong received line.")
 				}
-				msg, err := mail.ReadMessage(bytes.NewReader(tr.Body))
+				msg, err := mail.ReadMessage(tr.BodyReader())
 				if err != nil {
 					t.Errorf("%s : while parsing email message", err)
 					return err
@@ -467,7 +484,7 @@ func TestMalformedMessageBody(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() != "521 Stop sending me this nonsense, please!" {
+		if err.Error() != "521 5.6.0 Stop sending me this nonsense, please!" {
 			t.Errorf("%s : while closing message body", err)
 		}
 	} else {
@@ -512,7 +529,7 @@ func TestBodyParseAndCheckHeadersMissingMandatoryHeaderFrom(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() == "521 Stop sending me this nonsense, please!" {
+		if err.Error() == "521 5.6.0 Stop sending me this nonsense, please!" {
 			t.Logf("proper error is thrown")
 			return
 		}
@@ -555,7 +572,7 @@ func TestBodyParseAndCheckHeadersMissingMandatoryHeaderDate(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() == "521 Stop sending me this nonsense, please!" {
+		if err.Error() == "521 5.6.0 Stop sending me this nonsense, please!" {
 			t.Logf("proper error is thrown")
 			return
 		}
@@ -599,7 +616,7 @@ func TestBodyParseAndCheckHeadersDuplicate(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() == "521 Stop sending me this nonsense, please!" {
+		if err.Error() == "521 5.6.0 Stop sending me this nonsense, please!" {
 			t.Logf("proper error is thrown")
 			return
 		}
@@ -699,7 +716,7 @@ func TestBodyParseAndCheckHeadersDateMalformed(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() == "521 Stop sending me this nonsense, please!" {
+		if err.Error() == "521 5.6.0 Stop sending me this nonsense, please!" {
 			t.Logf("proper error is thrown")
 			return
 		}
@@ -742,7 +759,7 @@ func TestBodyParseTwoFromSenders(t *testing.T) {
 	}
 	err = wc.Close()
 	if err != nil {
-		if err.Error() == "521 Stop sending me this nonsense, please!" {
+		if err.Error() == "521 5.6.0 Stop sending me this nonsense, please!" {
 			t.Logf("proper error is thrown")
 			return
 		}
@@ -0,0 +1,95 @@
+package msmtpd
+
+import (
+	"maps"
+	"net/mail"
+	"sync/atomic"
+)
+
+// Good read - https://www.rfc-editor.org/rfc/rfc5321#section-3.3
+// Mail transaction starts with MAIL FROM command and ends after message body is accepted or rejected,
+// or when it is aborted by RSET, HELO or EHLO command. Client can start many mail transactions
+// during single session, so envelope and facts related to message are forgotten, when it ends.
+
+// metadataSnapshot stores facts, counters and flags as they were before envelope was started
+type metadataSnapshot struct {
+	facts    map[string]string
+	counters map[string]float64
+	flags    map[string]bool
+	scores   int
+}
+
+// startEnvelope remembers facts, counters, flags and scores of session, so ones set by SenderCheckers,
+// RecipientCheckers, DataCheckers and DataHandlers are forgotten, when envelope is reset
+func (t *Transaction) startEnvelope() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.envelope = &metadataSnapshot{
+		facts:    maps.Clone(t.facts),
+		counters: maps.Clone(t.counters),
+		flags:    maps.Clone(t.flags),
+		scores:   len(t.scores),
+	}
+}
+
+// resetEnvelope forgets sender, recipients and facts, counters, flags and scores set since envelope was started.
+// Karma is related to whole session, so it is kept
+func (t *Transaction) resetEnvelope() {
+	t.MailFrom = mail.Address{}
+	t.SMTPUTF8 = false
+	t.MailFromParameters = nil
+	t.RcptTo = nil
+	t.RcptToParameters = nil
+	t.Aliases = nil
+	t.aliasOf = nil
+	if t.delayedRejection != nil && t.delayedRejection.phase == PhaseSender {
+		t.delayedRejection = nil
+	}
+	if t.envelope == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	karma, found := t.counters[karmaCounterName]
+	t.facts = t.envelope.facts
+	t.counters = t.envelope.counters
+	t.flags = t.envelope.flags
+	t.scores = t.scores[:t.envelope.scores]
+	if found {
+		t.counters[karmaCounterName] = karma
+	}
+	t.envelope = nil
+}
+
+// finishMessage ends mail transaction after message body is accepted or rejected
+func (t *Transaction) finishMessage(delivered bool) {
+	if delivered {
+		t.messagesDelivered++
+		atomic.AddUint64(&t.server.messagesDelivered, 1)
+	} else {
+		t.messagesRejected++
+		atomic.AddUint64(&t.server.messagesRejected, 1)
+	}
+	t.reset()
+}
+
+// Messages returns number of messages delivered and rejected during session
+func (t *Transaction) Messages() (delivered, rejected int) {
+	return t.messagesDelivered, t.messagesRejected
+}
+
+// AddAlias adds alias to Transaction.Aliases remembering original recipient it expands, so delivery
+// plugins can relay DSN parameters client provided for original recipient to the next hop for alias
+func (t *Transaction) AddAlias(alias mail.Address, recipient string) {
+	t.Aliases = append(t.Aliases, alias)
+	if t.aliasOf == nil {
+		t.aliasOf = make(map[string]string, 0)
+	}
+	t.aliasOf[alias.Address] = recipient
+}
+
+// AliasOf returns original recipient alias added via Transaction.AddAlias expands
+func (t *Transaction) AliasOf(alias string) (recipient string, found bool) {
+	recipient, found = t.aliasOf[alias]
+	return recipient, found
+}
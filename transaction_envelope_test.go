@@ -0,0 +1,107 @@
+package msmtpd
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"net/smtp"
+	"testing"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func TestManyMessagesPerSession(t *testing.T) {
+	closed := make(chan *Transaction, 1)
+	var senders int
+	server := &Server{
+		ConnectionCheckers: []ConnectionChecker{
+			func(_ context.Context, tr *Transaction) error {
+				tr.SetFlag("session")
+				return nil
+			},
+		},
+		SenderCheckers: []SenderChecker{
+			func(_ context.Context, tr *Transaction) error {
+				if _, found := tr.GetFact("sender"); found {
+					return fmt.Errorf("fact of previous message is not forgotten")
+				}
+				if !tr.IsFlagSet("session") {
+					return fmt.Errorf("flag of session is forgotten")
+				}
+				if senders > 0 && tr.Karma() > -50 {
+					return fmt.Errorf("karma of session is not kept between messages")
+				}
+				if senders == 0 {
+					tr.Hate(100)
+				}
+				tr.SetFact("sender", tr.MailFrom.Address)
+				senders++
+				return nil
+			},
+		},
+		DataCheckers: []DataChecker{
+			func(_ context.Context, tr *Transaction) error {
+				if _, found := tr.AliasOf("alias@example.net"); found || len(tr.Aliases) > 0 {
+					return fmt.Errorf("alias of previous message is not forgotten")
+				}
+				tr.AddAlias(mail.Address{Address: "alias@example.net"}, "recipient@example.net")
+				return nil
+			},
+		},
+		CloseHandlers: []CloseHandler{
+			func(_ context.Context, tr *Transaction) error {
+				closed <- tr
+				return nil
+			},
+		},
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = c.Mail(fmt.Sprintf("sender%v@example.org", i)); err != nil {
+			t.Errorf("MAIL failed for message %v: %v", i, err)
+		}
+		if err = c.Rcpt("recipient@example.net"); err != nil {
+			t.Errorf("RCPT failed for message %v: %v", i, err)
+		}
+		wc, err := c.Data()
+		if err != nil {
+			t.Fatalf("DATA failed for message %v: %v", i, err)
+		}
+		if _, err = fmt.Fprint(wc, internal.MakeTestMessage("sender@example.org", "recipient@example.net")); err != nil {
+			t.Errorf("Data body failed for message %v: %v", i, err)
+		}
+		if err = wc.Close(); err != nil {
+			t.Errorf("Data close failed for message %v: %v", i, err)
+		}
+	}
+	// envelope is reset by RSET, so recipient requires new sender
+	if err = c.Mail("sender2@example.org"); err != nil {
+		t.Errorf("MAIL failed: %v", err)
+	}
+	if err = c.Reset(); err != nil {
+		t.Errorf("RSET failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 502, "RCPT TO:<recipient@example.net>"); err != nil {
+		t.Errorf("RCPT is accepted after RSET: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	tr := <-closed
+	delivered, rejected := tr.Messages()
+	if delivered != 2 || rejected != 0 {
+		t.Errorf("wrong number of messages delivered %v and rejected %v", delivered, rejected)
+	}
+	delivered64, _ := server.GetMessagesCount()
+	if delivered64 != 2 {
+		t.Errorf("wrong number of messages delivered by server %v", delivered64)
+	}
+}
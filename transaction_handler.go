@@ -5,10 +5,21 @@ import "fmt"
 func (t *Transaction) handle(line string) {
 	t.LogDebug("Command received: %s", line)
 	cmd := parseLine(line)
+	if reason := t.countCommand(cmd); reason != "" {
+		t.exceedSessionLimit(reason)
+		return
+	}
 	// Commands are dispatched to the appropriate handler functions.
 	// If a network error occurs during handling, the handler should
 	// just return and let the error be handled on the next read.
 
+	if custom, found := t.server.commands[cmd.action]; found {
+		t.handleCustomCommand(custom, cmd)
+		if synchronizationPoints[cmd.action] {
+			t.flush()
+		}
+		return
+	}
 	switch cmd.action {
 	case "PROXY":
 		t.handlePROXY(cmd)
@@ -16,6 +27,8 @@ func (t *Transaction) handle(line string) {
 		t.handleHELO(cmd)
 	case "EHLO":
 		t.handleEHLO(cmd)
+	case "LHLO":
+		t.handleLHLO(cmd)
 	case "MAIL":
 		t.handleMAIL(cmd)
 	case "RCPT":
@@ -24,6 +37,8 @@ func (t *Transaction) handle(line string) {
 		t.handleSTARTTLS(cmd)
 	case "DATA":
 		t.handleDATA(cmd)
+	case "BDAT":
+		t.handleBDAT(cmd)
 	case "RSET":
 		t.handleRSET(cmd)
 	case "NOOP":
@@ -34,26 +49,35 @@ func (t *Transaction) handle(line string) {
 		t.handleAUTH(cmd)
 	case "XCLIENT":
 		t.handleXCLIENT(cmd)
+	case "VRFY":
+		t.handleVRFY(cmd)
+	case "EXPN":
+		t.handleEXPN(cmd)
+	case "HELP":
+		t.handleHELP(cmd)
 	default:
 		t.Hate(unknownCommandPenalty)
 		t.LogDebug("Unsupported command received: %s", line)
-		t.reply(502, "Unsupported command.")
+		t.reply(502, "5.5.2", "Unsupported command.")
+	}
+	if synchronizationPoints[cmd.action] {
+		t.flush()
 	}
 }
 
 func (t *Transaction) handleRSET(_ command) {
 	t.Span.AddEvent("Reset is called")
 	t.reset()
-	t.reply(250, "I forgot everything you have said, go ahead please!")
+	t.reply(250, "2.0.0", "I forgot everything you have said, go ahead please!")
 }
 
 func (t *Transaction) handleNOOP(_ command) {
 	t.Span.AddEvent("NOOP is called")
-	t.reply(250, "I'm finishing procrastinating, go ahead please!")
+	t.reply(250, "2.0.0", "I'm finishing procrastinating, go ahead please!")
 }
 
 func (t *Transaction) handleQUIT(_ command) {
 	t.Span.AddEvent("Quite is called")
-	t.reply(221, fmt.Sprintf("Farewell, my friend! Transaction %s is finished", t.ID))
+	t.reply(221, "2.0.0", fmt.Sprintf("Farewell, my friend! Transaction %s is finished", t.ID))
 	t.close()
 }
@@ -3,7 +3,6 @@ package msmtpd
 import (
 	"crypto/tls"
 	"fmt"
-	"net"
 	"time"
 )
 
@@ -11,15 +10,13 @@ import (
  * Header manipulation
  */
 
-// AddHeader adds header to the Transaction.Parsed, and to the Transaction.Body, so,
-// it should be called before AddReceivedLine, since it adds header to the top
+// AddHeader adds header to the Transaction.Parsed, and on top of message returned by Transaction.BodyReader,
+// so, it should be called before AddReceivedLine, since it adds header to the top.
+// Message body itself is not copied.
 func (t *Transaction) AddHeader(name, value string) {
 	t.LogDebug("Adding header `%s: %s`", name, value)
 	line := wrap([]byte(fmt.Sprintf("%s: %s\r\n", name, value)))
-	t.Body = append(t.Body, line...)
-	// Move the new newly added header line up front
-	copy(t.Body[len(line):], t.Body[0:len(t.Body)-len(line)])
-	copy(t.Body, line)
+	t.headers = append(line, t.headers...)
 
 	if t.Parsed != nil {
 		// add header to parsed body
@@ -32,7 +29,7 @@ func (t *Transaction) AddHeader(name, value string) {
 	}
 }
 
-// AddReceivedLine prepends a Received header to the Transaction.Body
+// AddReceivedLine prepends a Received header to the message returned by Transaction.BodyReader
 func (t *Transaction) AddReceivedLine() {
 	tlsDetails := ""
 	if t.TLS != nil {
@@ -47,21 +44,20 @@ func (t *Transaction) AddReceivedLine() {
 			cipher,
 		)
 	}
-	peerIP := ""
-	if addr, ok := t.Addr.(*net.TCPAddr); ok {
-		peerIP = addr.IP.String()
+	peer := "[]"
+	if ip := t.RemoteIP(); ip != nil {
+		peer = "[" + ip.String() + "]"
+	} else if t.PeerCredentials != nil {
+		peer = fmt.Sprintf("unix socket, uid %v", t.PeerCredentials.UID)
 	}
 	line := wrap([]byte(fmt.Sprintf(
-		"Received: from %s ([%s]) by %s with %s;%s\r\n\t%s\r\n",
+		"Received: from %s (%s) by %s with %s;%s\r\n\t%s\r\n",
 		t.HeloName,
-		peerIP,
+		peer,
 		t.ServerName,
 		t.Protocol,
 		tlsDetails,
 		time.Now().Format(timeFormatForHeaders),
 	)))
-	t.Body = append(t.Body, line...)
-	// Move the new Received line up front
-	copy(t.Body[len(line):], t.Body[0:len(t.Body)-len(line)])
-	copy(t.Body, line)
+	t.headers = append(line, t.headers...)
 }
@@ -1,7 +1,9 @@
 package msmtpd
 
 import (
+	"context"
 	"fmt"
+	"strings"
 
 	"go.opentelemetry.io/otel/attribute"
 	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
@@ -16,56 +18,72 @@ func (t *Transaction) handleHELO(cmd command) {
 	defer span.End()
 
 	var err error
-	if len(cmd.fields) < 2 {
-		t.reply(502, "i think you have missed parameter")
-		t.Hate(missingParameterPenalty)
+	if t.server.LMTP {
+		t.rejectGreetingInLMTP(span, "HELO")
 		return
 	}
-	if t.dataHandlersCalledProperly {
-		span.AddEvent("HELO called after DATA accepted")
-		t.LogWarn("HELO called after DATA accepted")
-		t.reply(502, "wrong order of commands")
-		t.Hate(wrongCommandOrderPenalty)
+	if len(cmd.fields) < 2 {
+		t.reply(502, "5.5.4", "i think you have missed parameter")
+		t.Hate(missingParameterPenalty)
 		return
 	}
-	if t.HeloName != "" {
+	if t.state >= StateGreeted {
 		// Reset envelope in case of duplicate HELO
 		t.reset()
 	}
 	t.LogDebug("HELO <%s> is received...", cmd.fields[1])
 	t.HeloName = cmd.fields[1]
 	t.Protocol = SMTP
+	t.extended = false
 	t.Span.SetAttributes(attribute.String("helo", t.HeloName))
 	t.Span.SetAttributes(semconv.NetworkProtocolName("smtp"))
 	span.SetAttributes(attribute.String("helo", t.HeloName))
 	span.SetAttributes(semconv.NetworkProtocolName("smtp"))
-	for k := range t.server.HeloCheckers {
-		err = t.server.HeloCheckers[k](ctxWithTracer, t)
-		if err != nil {
-			t.error(err)
-			return
-		}
+	err = t.runPhase(ctxWithTracer, PhaseHelo, len(t.listener.HeloCheckers),
+		func(pluginCtx context.Context, k int) error {
+			return t.listener.HeloCheckers[k](pluginCtx, t)
+		})
+	if err != nil && !t.delayRejection(span, PhaseHelo, err) {
+		t.rejectGreeting(ctxWithTracer, err)
+		return
 	}
+	t.setState(ctxWithTracer, t.greetedState())
 	t.LogInfo("HELO <%s> is accepted!", cmd.fields[1])
 	span.AddEvent("HELO accepted")
-	t.reply(250, "Go on, i'm listening...")
+	t.reply(250, "", "Go on, i'm listening...")
 	t.Love(commandExecutedProperly)
 }
 
+// rejectGreeting reports error of HeloCheckers and forgets greeting, so client, who greeted server before,
+// cannot proceed with rejected name
+func (t *Transaction) rejectGreeting(ctx context.Context, err error) {
+	t.HeloName = ""
+	t.Protocol = ""
+	t.extended = false
+	t.setState(ctx, t.ungreetedState())
+	t.error(err)
+}
+
 func (t *Transaction) extensions() []string {
 	extensions := []string{
-		fmt.Sprintf("SIZE %d", t.server.MaxMessageSize),
+		fmt.Sprintf("SIZE %d", t.listener.MaxMessageSize),
 		"8BITMIME",
 		"PIPELINING",
+		"CHUNKING",
+		"BINARYMIME",
+		"SMTPUTF8",
+		"ENHANCEDSTATUSCODES",
+		"DSN",
 	}
 	if t.server.EnableXCLIENT {
 		extensions = append(extensions, "XCLIENT")
 	}
-	if t.server.TLSConfig != nil && !t.Encrypted {
+	if t.tlsConfig() != nil && !t.Encrypted {
 		extensions = append(extensions, "STARTTLS")
 	}
-	if t.server.Authenticator != nil && t.Encrypted {
-		extensions = append(extensions, "AUTH PLAIN LOGIN")
+	extensions = append(extensions, t.server.customExtensions()...)
+	if t.authenticationSupported() && t.Encrypted {
+		extensions = append(extensions, "AUTH "+strings.Join(t.server.saslMechanismNames(), " "))
 	}
 	return extensions
 }
@@ -78,38 +96,44 @@ func (t *Transaction) handleEHLO(cmd command) {
 	defer span.End()
 
 	var err error
-	if len(cmd.fields) < 2 {
-		t.reply(502, "i think you have missed parameter")
-		t.Hate(missingParameterPenalty)
+	if t.server.LMTP {
+		t.rejectGreetingInLMTP(span, "EHLO")
 		return
 	}
-	if t.dataHandlersCalledProperly {
-		span.AddEvent("EHLO called after DATA accepted")
-		t.LogWarn("EHLO called after DATA accepted")
-		t.reply(502, "wrong order of commands")
-		t.Hate(wrongCommandOrderPenalty)
+	if len(cmd.fields) < 2 {
+		t.reply(502, "5.5.4", "i think you have missed parameter")
+		t.Hate(missingParameterPenalty)
 		return
 	}
-	if t.HeloName != "" {
+	if t.state >= StateGreeted {
 		// Reset envelope in case of duplicate HELO
 		t.reset()
 	}
 	t.LogDebug("EHLO <%s> is received...", cmd.fields[1])
 	t.HeloName = cmd.fields[1]
 	t.Protocol = ESMTP
+	t.extended = true
 	t.Span.SetAttributes(attribute.String("ehlo", t.HeloName))
 	t.Span.SetAttributes(semconv.NetworkProtocolName("esmtp"))
 	span.SetAttributes(attribute.String("ehlo", t.HeloName))
 	span.SetAttributes(semconv.NetworkProtocolName("esmtp"))
-	for k := range t.server.HeloCheckers {
-		err = t.server.HeloCheckers[k](ctxWithTracer, t)
-		if err != nil {
-			t.error(err)
-			return
-		}
+	err = t.runPhase(ctxWithTracer, PhaseHelo, len(t.listener.HeloCheckers),
+		func(pluginCtx context.Context, k int) error {
+			return t.listener.HeloCheckers[k](pluginCtx, t)
+		})
+	if err != nil && !t.delayRejection(span, PhaseHelo, err) {
+		t.rejectGreeting(ctxWithTracer, err)
+		return
 	}
+	t.setState(ctxWithTracer, t.greetedState())
 	t.LogInfo("EHLO <%s> is accepted!", cmd.fields[1])
 	span.AddEvent("ehlo accepted")
+	t.replyWithExtensions()
+	t.Love(commandExecutedProperly)
+}
+
+// replyWithExtensions sends multiline response for EHLO/LHLO with extensions we support
+func (t *Transaction) replyWithExtensions() {
 	fmt.Fprintf(t.writer, "250-%s\r\n", t.server.Hostname)
 	extensions := t.extensions()
 	if len(extensions) > 1 {
@@ -117,6 +141,5 @@ func (t *Transaction) handleEHLO(cmd command) {
 			fmt.Fprintf(t.writer, "250-%s\r\n", ext)
 		}
 	}
-	t.reply(250, extensions[len(extensions)-1])
-	t.Love(commandExecutedProperly)
+	t.reply(250, "", extensions[len(extensions)-1])
 }
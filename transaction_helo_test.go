@@ -3,6 +3,8 @@ package msmtpd
 import (
 	"context"
 	"net/smtp"
+	"net/textproto"
+	"strings"
 	"testing"
 
 	"github.com/vodolaz095/msmtpd/internal"
@@ -73,3 +75,45 @@ func TestInvalidHelo(t *testing.T) {
 		t.Errorf("%s : while closing transaction", err)
 	}
 }
+
+func TestRejectedRepeatedGreeting(t *testing.T) {
+	server := &Server{
+		HeloCheckers: []HelloChecker{
+			func(_ context.Context, transaction *Transaction) error {
+				if transaction.HeloName == "bad.local" {
+					return ErrorSMTP{Code: 550, EnhancedCode: "5.7.1", Message: "Denied"}
+				}
+				return nil
+			},
+		},
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if _, _, err = c.ReadResponse(220); err != nil {
+		t.Errorf("%s : while reading greeting", err)
+	}
+	if err = internal.DoCommand(c, 250, "EHLO good.local"); err != nil {
+		t.Errorf("EHLO failed: %v", err)
+	}
+	if err = internal.DoCommand(c, 550, "EHLO bad.local"); err != nil {
+		t.Errorf("EHLO with bad name is not rejected: %v", err)
+	}
+	id, err := c.Cmd("MAIL FROM:<test@example.org>")
+	if err != nil {
+		t.Fatalf("%s : while sending MAIL FROM", err)
+	}
+	c.StartResponse(id)
+	_, msg, err := c.ReadResponse(502)
+	c.EndResponse(id)
+	if err != nil || !strings.HasPrefix(msg, "5.5.1 ") {
+		t.Errorf("MAIL FROM after rejected greeting is not rejected: %v", err)
+	}
+	if err = internal.DoCommand(c, 221, "QUIT"); err != nil {
+		t.Errorf("QUIT failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+}
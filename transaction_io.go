@@ -1,75 +1,189 @@
 package msmtpd
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
+	"runtime/debug"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// errLineTooLong is returned by Transaction.readLine when client sends command line longer than maxLineLength
+var errLineTooLong = errors.New("line too long")
+
 func (t *Transaction) serve() {
+	t.server.trackTransaction(t)
 	defer func() {
 		t.server.runCloseHandlers(t)
 		t.close()
+		t.releaseBody()
 		if t.Span != nil {
 			t.Span.End()
 		}
 		t.cancel()
+		t.server.forgetTransaction(t)
+	}()
+	// panics of checkers and handlers are recovered by Transaction.callPlugin, and this recovers panics
+	// of other code provided by user, like custom command handlers, authenticators and SASL servers,
+	// so only session is closed instead of whole server
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		atomic.AddUint64(&t.server.pluginPanics, 1)
+		t.LogError(fmt.Errorf("panic while serving session: %v", recovered), string(debug.Stack()))
+		t.error(ErrPluginFailed)
+		t.flush()
 	}()
 	if !t.server.EnableProxyProtocol {
 		t.welcome()
 	}
 	for {
-		for t.scanner.Scan() {
-			line := t.scanner.Text()
+		line, err := t.readLine()
+		if err == nil {
 			t.LogTrace("Received: %s", strings.TrimSpace(line))
 			t.handle(line)
+			if reason := t.errorsExceeded(); reason != "" {
+				t.exceedSessionLimit(reason)
+				break
+			}
+			continue
 		}
-		err := t.scanner.Err()
-		if err == bufio.ErrTooLong {
-			t.reply(500, "Line too long")
-			// Advance reader to the next newline
-			t.reader.ReadString('\n')
-			t.scanner = bufio.NewScanner(t.reader)
+		if errors.Is(err, errLineTooLong) {
+			t.reply(500, "5.5.2", "Line too long")
 			// Reset and have the client start over.
 			t.reset()
+			if reason := t.errorsExceeded(); reason != "" {
+				t.exceedSessionLimit(reason)
+				break
+			}
 			continue
 		}
+		if reason := t.durationExceeded(); reason != "" {
+			t.exceedSessionLimit(reason)
+			break
+		}
+		if t.server.draining.Load() {
+			t.LogInfo("Closing transaction due to server shutdown")
+			t.reply(421, "4.3.2", "Server is shutting down. Try again later, please.")
+		}
 		break
 	}
 }
 
+// readLine reads single line from client without trailing <CR><LF>. We do not use bufio.Scanner here,
+// because it reads ahead, so bytes client sends right after command line (like BDAT chunks do)
+// are lost for Transaction.reader
+func (t *Transaction) readLine() (line string, err error) {
+	var chunk []byte
+	var isPrefix bool
+	buf := make([]byte, 0, 128)
+	// Client has not pipelined more commands, so it waits for our replies
+	// and we have to send them before waiting for input
+	if t.reader.Buffered() == 0 {
+		t.flush()
+		// server can be shut down while we wait, so it has to know we are idle
+		t.idle.Store(true)
+		defer t.idle.Store(false)
+		if t.server.draining.Load() {
+			return "", ErrServerClosed
+		}
+	}
+	for {
+		chunk, isPrefix, err = t.reader.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		if len(buf)+len(chunk) > maxLineLength {
+			// Advance reader to the next newline
+			for isPrefix {
+				_, isPrefix, err = t.reader.ReadLine()
+				if err != nil {
+					return "", err
+				}
+			}
+			return "", errLineTooLong
+		}
+		buf = append(buf, chunk...)
+		if !isPrefix {
+			return string(buf), nil
+		}
+	}
+}
+
 func (t *Transaction) reject() {
-	t.reply(421, "I'm tired. Take a break, please.")
+	t.reply(421, "4.3.2", "I'm tired. Take a break, please.")
 	t.close()
 }
 
 func (t *Transaction) reset() {
-	t.Body = nil
+	t.resetEnvelope()
+	t.releaseBody()
 	t.Parsed = nil
+	t.chunks = nil
+	t.deliveryErrors = nil
+	t.setState(t.Context(), t.idleState())
 }
 
 func (t *Transaction) welcome() {
-	t.reply(220, t.server.WelcomeMessage)
+	t.reply(220, "", t.listener.WelcomeMessage)
+}
+
+// reply sends response to client. Enhanced status code should be omitted for greetings,
+// HELO/EHLO responses and intermediate 334/354 replies.
+// Replies are buffered, so responses to pipelined commands are sent in one batch,
+// when client has nothing more to say, or when synchronization point is reached
+func (t *Transaction) reply(code int, enhancedCode, message string) {
+	if code >= 400 {
+		t.limits.errors++
+	}
+	if enhancedCode == "" {
+		t.LogTrace("Sending: %d %s", code, message)
+		fmt.Fprintf(t.writer, "%d %s\r\n", code, message)
+	} else {
+		t.LogTrace("Sending: %d %s %s", code, enhancedCode, message)
+		fmt.Fprintf(t.writer, "%d %s %s\r\n", code, enhancedCode, message)
+	}
+}
+
+// Reply sends response to client, it can be used by custom command handlers.
+// Enhanced status code can be empty, if it is not applicable for response
+func (t *Transaction) Reply(code int, enhancedCode, message string) {
+	t.reply(code, enhancedCode, message)
 }
 
-func (t *Transaction) reply(code int, message string) {
-	t.LogTrace("Sending: %d %s", code, message)
-	fmt.Fprintf(t.writer, "%d %s\r\n", code, message)
-	t.flush()
+// ReplyLines sends multiline response to client, every line except the last one is sent
+// with dash after code, like `214-2.0.0 line`
+func (t *Transaction) ReplyLines(code int, enhancedCode string, lines ...string) {
+	if len(lines) == 0 {
+		t.reply(code, enhancedCode, "")
+		return
+	}
+	for _, line := range lines[:len(lines)-1] {
+		if enhancedCode == "" {
+			t.LogTrace("Sending: %d-%s", code, line)
+			fmt.Fprintf(t.writer, "%d-%s\r\n", code, line)
+		} else {
+			t.LogTrace("Sending: %d-%s %s", code, enhancedCode, line)
+			fmt.Fprintf(t.writer, "%d-%s %s\r\n", code, enhancedCode, line)
+		}
+	}
+	t.reply(code, enhancedCode, lines[len(lines)-1])
 }
 
 func (t *Transaction) flush() {
 	t.conn.SetWriteDeadline(time.Now().Add(t.server.WriteTimeout))
 	t.writer.Flush()
-	t.conn.SetReadDeadline(time.Now().Add(t.server.ReadTimeout))
+	t.conn.SetReadDeadline(t.deadline(t.server.ReadTimeout))
 }
 
 func (t *Transaction) error(err error) {
 	if smtpdError, ok := err.(ErrorSMTP); ok {
-		t.reply(smtpdError.Code, smtpdError.Message)
+		t.reply(smtpdError.Code, smtpdError.enhancedCode(), smtpdError.Message)
 	} else {
-		t.reply(502, fmt.Sprintf("%s", err))
+		t.reply(502, "5.0.0", fmt.Sprintf("%s", err))
 	}
 }
 
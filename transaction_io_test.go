@@ -0,0 +1,78 @@
+package msmtpd
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"net/smtp"
+	"testing"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func TestPipelinedCommands(t *testing.T) {
+	var delivered bool
+	addr, closer := RunTestServerWithoutTLS(t, &Server{
+		RecipientCheckers: []RecipientChecker{
+			func(_ context.Context, tr *Transaction, recipient *mail.Address) error {
+				if recipient.Address == "unknown@example.net" {
+					return ErrorSMTP{Code: 550, EnhancedCode: "5.1.1", Message: "no such user"}
+				}
+				return nil
+			},
+		},
+		DataHandlers: []DataHandler{
+			func(_ context.Context, tr *Transaction) error {
+				if len(tr.RcptTo) != 2 {
+					t.Errorf("wrong number of recipients %v", len(tr.RcptTo))
+				}
+				delivered = true
+				return nil
+			},
+		},
+	})
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Errorf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if supported, _ := c.Extension("PIPELINING"); !supported {
+		t.Error("PIPELINING not supported")
+	}
+	_, err = fmt.Fprint(c.Text.W, "MAIL FROM:<sender@example.org>\r\n"+
+		"RCPT TO:<recipient1@example.net>\r\n"+
+		"RCPT TO:<unknown@example.net>\r\n"+
+		"RCPT TO:<recipient2@example.net>\r\n"+
+		"DATA\r\n")
+	if err != nil {
+		t.Errorf("%s : while sending pipelined commands", err)
+	}
+	if err = c.Text.W.Flush(); err != nil {
+		t.Errorf("%s : while sending pipelined commands", err)
+	}
+	for i, code := range []int{250, 250, 550, 250, 354} {
+		if _, _, err = c.Text.ReadResponse(code); err != nil {
+			t.Errorf("%s : wrong response %v for pipelined commands", err, i)
+		}
+	}
+	wc := c.Text.DotWriter()
+	_, err = fmt.Fprint(wc, internal.MakeTestMessage("sender@example.org", "recipient1@example.net"))
+	if err != nil {
+		t.Errorf("%s : while sending message body", err)
+	}
+	if err = wc.Close(); err != nil {
+		t.Errorf("%s : while sending message body", err)
+	}
+	if _, _, err = c.Text.ReadResponse(250); err != nil {
+		t.Errorf("%s : while sending message body", err)
+	}
+	if !delivered {
+		t.Errorf("message is not delivered")
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("QUIT failed: %v", err)
+	}
+}
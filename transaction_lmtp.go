@@ -0,0 +1,131 @@
+package msmtpd
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Good read - https://www.rfc-editor.org/rfc/rfc2033
+// LMTP session is the same as ESMTP one, but client greets server with `LHLO` and, after message body
+// is sent via DATA or BDAT LAST, server replies once for every recipient accepted by `RCPT TO:`,
+// so message can be delivered to some recipients and rejected for others.
+
+// ReportDelivery records result of message delivery for recipient provided, nil error means
+// message is delivered. DataHandlers can call it to report per-recipient status - in LMTP mode
+// client receives reply for every recipient after message body. Recipients without reported result
+// receive reply according to error returned by DataHandlers.
+func (t *Transaction) ReportDelivery(recipient string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.deliveryErrors == nil {
+		t.deliveryErrors = make(map[string]error, 0)
+	}
+	t.deliveryErrors[recipient] = err
+	if err != nil {
+		t.LogDebug("Delivery to %s failed: %s", recipient, err)
+	} else {
+		t.LogDebug("Delivery to %s succeeded", recipient)
+	}
+}
+
+func (t *Transaction) handleLHLO(cmd command) {
+	ctxWithTracer, span := t.server.Tracer.Start(t.Context(), "handle_lhlo",
+		trace.WithSpanKind(trace.SpanKindInternal), // важно
+	)
+	cmd.attachToSpan(span)
+	defer span.End()
+
+	var err error
+	if !t.server.LMTP {
+		t.Hate(unknownCommandPenalty)
+		t.LogDebug("LHLO received, but server is not in LMTP mode")
+		span.AddEvent("LHLO called for SMTP server")
+		t.reply(502, "5.5.2", "Unsupported command.")
+		return
+	}
+	if len(cmd.fields) < 2 {
+		t.reply(502, "5.5.4", "i think you have missed parameter")
+		t.Hate(missingParameterPenalty)
+		return
+	}
+	if t.state >= StateGreeted {
+		// Reset envelope in case of duplicate LHLO
+		t.reset()
+	}
+	t.LogDebug("LHLO <%s> is received...", cmd.fields[1])
+	t.HeloName = cmd.fields[1]
+	t.Protocol = LMTP
+	t.extended = true
+	t.Span.SetAttributes(attribute.String("lhlo", t.HeloName))
+	t.Span.SetAttributes(semconv.NetworkProtocolName("lmtp"))
+	span.SetAttributes(attribute.String("lhlo", t.HeloName))
+	span.SetAttributes(semconv.NetworkProtocolName("lmtp"))
+	err = t.runPhase(ctxWithTracer, PhaseHelo, len(t.listener.HeloCheckers),
+		func(pluginCtx context.Context, k int) error {
+			return t.listener.HeloCheckers[k](pluginCtx, t)
+		})
+	if err != nil && !t.delayRejection(span, PhaseHelo, err) {
+		t.rejectGreeting(ctxWithTracer, err)
+		return
+	}
+	t.setState(ctxWithTracer, t.greetedState())
+	t.LogInfo("LHLO <%s> is accepted!", cmd.fields[1])
+	span.AddEvent("lhlo accepted")
+	t.replyWithExtensions()
+	t.Love(commandExecutedProperly)
+}
+
+// rejectGreetingInLMTP complains about HELO/EHLO sent to server in LMTP mode
+func (t *Transaction) rejectGreetingInLMTP(span trace.Span, action string) {
+	t.LogDebug("%s called in LMTP session", action)
+	span.AddEvent(action + " called in LMTP session")
+	t.Hate(wrongCommandOrderPenalty)
+	t.reply(502, "5.5.1", "This is LMTP server, please, introduce yourself via LHLO.")
+}
+
+// rejectMessage reports error for message body received - once in SMTP mode,
+// and once for every recipient in LMTP mode
+func (t *Transaction) rejectMessage(err error) {
+	if !t.server.LMTP {
+		t.error(err)
+		return
+	}
+	for i := range t.RcptTo {
+		t.errorForRecipient(t.RcptTo[i].Address, err)
+	}
+}
+
+// replyForRecipients sends reply for every recipient after message body in LMTP mode, using
+// results reported by DataHandlers via ReportDelivery. Recipients without reported results
+// receive reply according to handlersErr. It returns true, if message is delivered to at least
+// one recipient
+func (t *Transaction) replyForRecipients(handlersErr error) (delivered bool) {
+	for i := range t.RcptTo {
+		err, reported := t.deliveryErrors[t.RcptTo[i].Address]
+		if !reported {
+			err = handlersErr
+		}
+		if err != nil {
+			t.LogInfo("Message is not delivered to %s: %s", t.RcptTo[i].Address, err)
+			t.errorForRecipient(t.RcptTo[i].Address, err)
+			continue
+		}
+		delivered = true
+		t.reply(250, "2.0.0", fmt.Sprintf("<%s> Thank you.", t.RcptTo[i].Address))
+	}
+	return delivered
+}
+
+// errorForRecipient sends error as reply mentioning recipient it is related to
+func (t *Transaction) errorForRecipient(recipient string, err error) {
+	if smtpdError, ok := err.(ErrorSMTP); ok {
+		smtpdError.Message = fmt.Sprintf("<%s> %s", recipient, smtpdError.Message)
+		t.error(smtpdError)
+		return
+	}
+	t.error(fmt.Errorf("<%s> %s", recipient, err))
+}
@@ -0,0 +1,242 @@
+package msmtpd
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func TestLMTPGreeting(t *testing.T) {
+	addr, closer := RunTestServerWithoutTLS(t, &Server{
+		LMTP: true,
+	})
+	defer closer()
+	c, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	_, msg, err := c.ReadResponse(220)
+	if err != nil {
+		t.Errorf("%s : while reading greeting", err)
+	}
+	if msg != "localhost.localdomain LMTP ready." {
+		t.Errorf("wrong greeting %s", msg)
+	}
+	if err = internal.DoCommand(c, 502, "HELO localhost"); err != nil {
+		t.Errorf("HELO in LMTP mode didn't fail: %v", err)
+	}
+	if err = internal.DoCommand(c, 502, "EHLO localhost"); err != nil {
+		t.Errorf("EHLO in LMTP mode didn't fail: %v", err)
+	}
+	if err = internal.DoCommand(c, 250, "LHLO localhost"); err != nil {
+		t.Errorf("LHLO failed: %v", err)
+	}
+	if err = internal.DoCommand(c, 221, "QUIT"); err != nil {
+		t.Errorf("QUIT failed: %v", err)
+	}
+}
+
+func TestLHLOInSMTPMode(t *testing.T) {
+	addr, closer := RunTestServerWithoutTLS(t, &Server{})
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 502, "LHLO localhost"); err != nil {
+		t.Errorf("LHLO in SMTP mode didn't fail: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
+
+func TestLMTPRepliesForEveryRecipient(t *testing.T) {
+	var protocol Protocol
+	addr, closer := RunTestServerWithoutTLS(t, &Server{
+		LMTP: true,
+		DataHandlers: []DataHandler{
+			func(_ context.Context, tr *Transaction) error {
+				protocol = tr.Protocol
+				tr.ReportDelivery("alice@example.org", nil)
+				tr.ReportDelivery("bob@example.org", ErrorSMTP{
+					Code:         552,
+					EnhancedCode: "5.2.2",
+					Message:      "Mailbox is full",
+				})
+				return nil
+			},
+			func(_ context.Context, tr *Transaction) error {
+				return ErrorSMTP{
+					Code:         451,
+					EnhancedCode: "4.3.0",
+					Message:      "Try again later",
+				}
+			},
+		},
+	})
+	defer closer()
+	c, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if _, _, err = c.ReadResponse(220); err != nil {
+		t.Errorf("%s : while reading greeting", err)
+	}
+	if err = internal.DoCommand(c, 250, "LHLO localhost"); err != nil {
+		t.Errorf("LHLO failed: %v", err)
+	}
+	if err = internal.DoCommand(c, 250, "MAIL FROM:<sender@example.org>"); err != nil {
+		t.Errorf("MAIL FROM failed: %v", err)
+	}
+	for _, rcpt := range []string{"alice@example.org", "bob@example.org", "carol@example.org"} {
+		if err = internal.DoCommand(c, 250, "RCPT TO:<%s>", rcpt); err != nil {
+			t.Errorf("RCPT TO failed: %v", err)
+		}
+	}
+	if err = internal.DoCommand(c, 354, "DATA"); err != nil {
+		t.Errorf("DATA failed: %v", err)
+	}
+	dw := c.DotWriter()
+	_, err = dw.Write([]byte(internal.MakeTestMessage("sender@example.org", "alice@example.org")))
+	if err != nil {
+		t.Errorf("%s : while writing message body", err)
+	}
+	if err = dw.Close(); err != nil {
+		t.Errorf("%s : while closing message body", err)
+	}
+	expected := []struct {
+		code int
+		msg  string
+	}{
+		{250, "2.0.0 <alice@example.org> Thank you."},
+		{552, "5.2.2 <bob@example.org> Mailbox is full"},
+		{451, "4.3.0 <carol@example.org> Try again later"},
+	}
+	for _, e := range expected {
+		code, msg, readErr := c.ReadResponse(e.code)
+		if readErr != nil {
+			t.Errorf("%s : wrong reply for recipient", readErr)
+			continue
+		}
+		if code != e.code || msg != e.msg {
+			t.Errorf("wrong reply %v %s instead of %v %s", code, msg, e.code, e.msg)
+		}
+	}
+	if protocol != LMTP {
+		t.Errorf("wrong protocol %s", protocol)
+	}
+	if err = internal.DoCommand(c, 221, "QUIT"); err != nil {
+		t.Errorf("QUIT failed: %v", err)
+	}
+}
+
+func TestLMTPRejectsMessageForEveryRecipient(t *testing.T) {
+	addr, closer := RunTestServerWithoutTLS(t, &Server{
+		LMTP: true,
+		DataCheckers: []DataChecker{
+			func(_ context.Context, tr *Transaction) error {
+				return ErrorSMTP{Code: 554, EnhancedCode: "5.7.1", Message: "Spam"}
+			},
+		},
+	})
+	defer closer()
+	c, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if _, _, err = c.ReadResponse(220); err != nil {
+		t.Errorf("%s : while reading greeting", err)
+	}
+	if err = internal.DoCommand(c, 250, "LHLO localhost"); err != nil {
+		t.Errorf("LHLO failed: %v", err)
+	}
+	if err = internal.DoCommand(c, 250, "MAIL FROM:<sender@example.org>"); err != nil {
+		t.Errorf("MAIL FROM failed: %v", err)
+	}
+	for _, rcpt := range []string{"alice@example.org", "bob@example.org"} {
+		if err = internal.DoCommand(c, 250, "RCPT TO:<%s>", rcpt); err != nil {
+			t.Errorf("RCPT TO failed: %v", err)
+		}
+	}
+	if err = internal.DoCommand(c, 354, "DATA"); err != nil {
+		t.Errorf("DATA failed: %v", err)
+	}
+	dw := c.DotWriter()
+	_, err = dw.Write([]byte(internal.MakeTestMessage("sender@example.org", "alice@example.org")))
+	if err != nil {
+		t.Errorf("%s : while writing message body", err)
+	}
+	if err = dw.Close(); err != nil {
+		t.Errorf("%s : while closing message body", err)
+	}
+	for _, rcpt := range []string{"alice@example.org", "bob@example.org"} {
+		_, msg, readErr := c.ReadResponse(554)
+		if readErr != nil {
+			t.Errorf("%s : wrong reply for recipient %s", readErr, rcpt)
+			continue
+		}
+		if msg != "5.7.1 <"+rcpt+"> Spam" {
+			t.Errorf("wrong reply %s for %s", msg, rcpt)
+		}
+	}
+	if err = internal.DoCommand(c, 221, "QUIT"); err != nil {
+		t.Errorf("QUIT failed: %v", err)
+	}
+}
+
+func TestLMTPRejectsTooBigChunkForEveryRecipient(t *testing.T) {
+	server := &Server{
+		LMTP:           true,
+		MaxMessageSize: 100,
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := textproto.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if _, _, err = c.ReadResponse(220); err != nil {
+		t.Errorf("%s : while reading greeting", err)
+	}
+	if err = internal.DoCommand(c, 250, "LHLO localhost"); err != nil {
+		t.Errorf("LHLO failed: %v", err)
+	}
+	if err = internal.DoCommand(c, 250, "MAIL FROM:<sender@example.org>"); err != nil {
+		t.Errorf("MAIL FROM failed: %v", err)
+	}
+	for _, rcpt := range []string{"alice@example.org", "bob@example.org"} {
+		if err = internal.DoCommand(c, 250, "RCPT TO:<%s>", rcpt); err != nil {
+			t.Errorf("RCPT TO failed: %v", err)
+		}
+	}
+	chunk := strings.Repeat("a", 120)
+	if _, err = fmt.Fprintf(c.W, "BDAT %d LAST\r\n%s", len(chunk), chunk); err != nil {
+		t.Fatalf("%s : while sending chunk", err)
+	}
+	if err = c.W.Flush(); err != nil {
+		t.Fatalf("%s : while sending chunk", err)
+	}
+	for _, rcpt := range []string{"alice@example.org", "bob@example.org"} {
+		_, msg, readErr := c.ReadResponse(552)
+		if readErr != nil {
+			t.Errorf("%s : wrong reply for recipient %s", readErr, rcpt)
+			continue
+		}
+		if !strings.HasPrefix(msg, "5.3.4 <"+rcpt+"> ") {
+			t.Errorf("wrong reply %s for %s", msg, rcpt)
+		}
+	}
+	if err = internal.DoCommand(c, 250, "NOOP"); err != nil {
+		t.Errorf("NOOP failed after chunk is rejected: %v", err)
+	}
+	if err = internal.DoCommand(c, 221, "QUIT"); err != nil {
+		t.Errorf("QUIT failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+}
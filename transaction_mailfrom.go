@@ -1,7 +1,10 @@
 package msmtpd
 
 import (
+	"context"
+	"fmt"
 	"net/mail"
+	"strconv"
 	"strings"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -17,51 +20,91 @@ func (t *Transaction) handleMAIL(cmd command) {
 
 	if len(cmd.params) != 2 || strings.ToUpper(cmd.params[0]) != "FROM" {
 		t.Hate(missingParameterPenalty)
-		t.reply(502, "Invalid syntax.")
+		t.reply(502, "5.5.4", "Invalid syntax.")
 		return
 	}
-	if t.dataHandlersCalledProperly {
-		span.AddEvent("MAIL FROM called after DATA accepted")
-		t.LogWarn("MAIL FROM called after DATA accepted")
-		t.Hate(wrongCommandOrderPenalty)
-		t.reply(502, "wrong order of commands")
+	if !t.transition(span, "MAIL FROM", StateMail) {
 		return
 	}
-	if t.HeloName == "" {
+	var err error
+	var addr *mail.Address // null sender
+	if !t.extended && len(cmd.fields) > 2 {
+		// RFC 5321, section 4.1.1.11 - parameters are allowed only for sessions started with EHLO or LHLO
+		span.AddEvent("MAIL FROM has parameters after HELO")
+		t.LogDebug("MAIL FROM has parameters after HELO")
 		t.Hate(missingParameterPenalty)
-		span.AddEvent("MAIL FROM called without HELO/EHLO")
-		t.LogDebug("MAIL FROM called without HELO/EHLO")
-		t.reply(502, "Please introduce yourself first.")
+		t.reply(555, "5.5.4", "Parameters are not supported after HELO, use EHLO, please.")
 		return
 	}
-	if !t.Encrypted && t.server.ForceTLS {
-		span.AddEvent("MAIL FROM called without STARTTLS")
-		t.LogDebug("MAIL FROM called without STARTTLS")
+	params, err := parseParameters(cmd.fields[2:])
+	if err != nil {
+		span.AddEvent("MAIL FROM has malformed parameters")
+		t.LogDebug("MAIL FROM has malformed parameters: %s", err)
 		t.Hate(missingParameterPenalty)
-		t.reply(502, "Please turn on TLS by issuing a STARTTLS command.")
+		t.reply(501, "5.5.4", "Malformed parameters.")
 		return
 	}
-	if t.server.Authenticator != nil && t.Username == "" {
-		span.AddEvent("MAIL FROM called without authentication")
-		t.LogDebug("MAIL FROM called without authentication")
+	for keyword := range params {
+		if !mailFromParameters[keyword] {
+			span.AddEvent("MAIL FROM has unsupported parameter")
+			t.LogDebug("MAIL FROM has unsupported parameter %s", keyword)
+			t.Hate(missingParameterPenalty)
+			t.reply(555, "5.5.4", fmt.Sprintf("Parameter %s is not supported.", keyword))
+			return
+		}
+	}
+	err = validateMailFromDSN(params)
+	if err != nil {
+		span.AddEvent("MAIL FROM has malformed DSN parameters")
+		t.LogDebug("MAIL FROM has malformed DSN parameters: %s", err)
 		t.Hate(missingParameterPenalty)
-		t.reply(530, "Authentication Required.")
+		t.reply(501, "5.5.4", "Malformed RET or ENVID parameter.")
 		return
 	}
-	if t.MailFrom.Address != "" {
-		span.AddEvent("MAIL FROM was already called")
-		t.LogDebug("MAIL FROM was already called")
+	if params.Has("BODY") && !bodyTypes[strings.ToUpper(params.Get("BODY"))] {
+		span.AddEvent("MAIL FROM has unsupported BODY parameter")
+		t.LogDebug("MAIL FROM has unsupported BODY=%s", params.Get("BODY"))
 		t.Hate(missingParameterPenalty)
-		t.reply(502, "Duplicate MAIL")
+		t.reply(501, "5.5.4", "Unsupported BODY parameter, use 7BIT, 8BITMIME or BINARYMIME, please.")
 		return
 	}
-	var err error
-	var addr *mail.Address // null sender
+	if params.Has("SIZE") {
+		size, parseErr := strconv.ParseUint(params.Get("SIZE"), 10, 63)
+		if parseErr != nil {
+			span.AddEvent("MAIL FROM has malformed SIZE parameter")
+			t.LogDebug("MAIL FROM has malformed SIZE=%s", params.Get("SIZE"))
+			t.Hate(missingParameterPenalty)
+			t.reply(501, "5.5.4", "Malformed SIZE parameter.")
+			return
+		}
+		span.SetAttributes(attribute.Int64("size", int64(size)))
+		if size > uint64(t.listener.MaxMessageSize) {
+			span.AddEvent("message is too big")
+			t.LogDebug("MAIL FROM declares message of %v bytes, bigger than %v bytes",
+				size, t.listener.MaxMessageSize)
+			t.Hate(tooBigMessagePenalty)
+			t.reply(552, "5.3.4", fmt.Sprintf(
+				"Your message is too big, try to say it in less than %d bytes, please!",
+				t.listener.MaxMessageSize,
+			))
+			return
+		}
+	}
+	smtputf8 := params.Has("SMTPUTF8")
+	if !smtputf8 && !isASCII(cmd.params[1]) {
+		span.AddEvent("MAIL FROM has internationalized address without SMTPUTF8")
+		t.LogDebug("MAIL FROM has internationalized address %s without SMTPUTF8", cmd.params[1])
+		t.Hate(missingParameterPenalty)
+		t.reply(553, "5.6.7", "Please, provide SMTPUTF8 parameter for internationalized email address.")
+		return
+	}
+	t.startEnvelope()
 	// We must accept a null sender as per rfc5321 section-6.1.
 	if cmd.params[1] != "<>" {
 		addr, err = parseAddress(cmd.params[1])
 		if err != nil {
-			t.reply(502, "Malformed e-mail address")
+			t.resetEnvelope()
+			t.reply(502, "5.1.7", "Malformed e-mail address")
 			return
 		}
 		t.MailFrom = *addr
@@ -69,22 +112,39 @@ func (t *Transaction) handleMAIL(cmd command) {
 		t.MailFrom = mail.Address{}
 		t.SetFlag(NullSenderFlag)
 	}
+	t.SMTPUTF8 = smtputf8
+	t.MailFromParameters = params
+	if len(params) > 0 {
+		t.Span.SetAttributes(attribute.String("from_parameters", params.String()))
+		span.SetAttributes(attribute.String("from_parameters", params.String()))
+	}
+	if smtputf8 {
+		t.Span.SetAttributes(attribute.Bool("smtputf8", true))
+		span.SetAttributes(attribute.Bool("smtputf8", true))
+	}
 	t.LogDebug("Checking MAIL FROM %s by %v SenderCheckers...",
-		t.MailFrom.String(), len(t.server.SenderCheckers),
+		t.MailFrom.String(), len(t.listener.SenderCheckers),
 	)
 	t.Span.SetAttributes(attribute.String("from", t.MailFrom.String()))
 	span.SetAttributes(attribute.String("from", t.MailFrom.String()))
-	for k := range t.server.SenderCheckers {
-		err = t.server.SenderCheckers[k](ctxWithTracer, t)
-		if err != nil {
-			t.error(err)
-			return
-		}
+	err = t.runPhase(ctxWithTracer, PhaseSender, len(t.listener.SenderCheckers),
+		func(pluginCtx context.Context, k int) error {
+			return t.listener.SenderCheckers[k](pluginCtx, t)
+		})
+	if err == nil {
+		err = t.verdictError(span)
+	}
+	if err != nil && !t.delayRejection(span, PhaseSender, err) {
+		t.resetEnvelope()
+		t.error(err)
+		return
 	}
 	t.LogInfo("MAIL FROM %s is checked by %v SenderCheckers and accepted!",
-		t.MailFrom.String(), len(t.server.SenderCheckers),
+		t.MailFrom.String(), len(t.listener.SenderCheckers),
 	)
 	span.AddEvent("MAIL FROM accepted")
-	t.reply(250, "Ok, it makes sense, go ahead please!")
+	t.limits.envelopes++
+	t.setState(ctxWithTracer, StateMail)
+	t.reply(250, "2.1.0", "Ok, it makes sense, go ahead please!")
 	t.Love(commandExecutedProperly)
 }
@@ -3,6 +3,7 @@ package msmtpd
 import (
 	"context"
 	"fmt"
+	"net/mail"
 	"net/smtp"
 	"strings"
 	"testing"
@@ -161,3 +162,165 @@ func TestDataBeforeMailFrom(t *testing.T) {
 		t.Errorf("QUIT failed: %v", err)
 	}
 }
+
+func TestSMTPUTF8(t *testing.T) {
+	addr, closer := RunTestServerWithoutTLS(t, &Server{
+		RecipientCheckers: []RecipientChecker{
+			func(_ context.Context, tr *Transaction, recipient *mail.Address) error {
+				if !tr.SMTPUTF8 {
+					t.Errorf("SMTPUTF8 is not set for transaction")
+				}
+				if tr.MailFrom.Address != "иван@почта.рф" {
+					t.Errorf("wrong sender %s", tr.MailFrom.Address)
+				}
+				if recipient.Address != "пётр@xn--80a1acny.xn--p1ai" {
+					t.Errorf("wrong recipient %s", recipient.Address)
+				}
+				return nil
+			},
+		},
+	})
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Errorf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if supported, _ := c.Extension("SMTPUTF8"); !supported {
+		t.Error("SMTPUTF8 not supported")
+	}
+	if err = internal.DoCommand(c.Text, 553, "MAIL FROM:<иван@почта.рф>"); err != nil {
+		t.Errorf("MAIL without SMTPUTF8 failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 502, "MAIL FROM:<иван@xn--что-то.рф> SMTPUTF8"); err != nil {
+		t.Errorf("MAIL with malformed domain failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 250, "MAIL FROM: <иван@почта.рф> SMTPUTF8"); err != nil {
+		t.Errorf("MAIL with SMTPUTF8 failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 250, "RCPT TO:<пётр@xn--80a1acny.xn--p1ai>"); err != nil {
+		t.Errorf("RCPT failed: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
+
+func TestInternationalizedRecipientWithoutSMTPUTF8(t *testing.T) {
+	addr, closer := RunTestServerWithoutTLS(t, &Server{})
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Errorf("Dial failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 250, "HELO localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 250, "MAIL FROM:<ivan@xn--80a1acny.xn--p1ai>"); err != nil {
+		t.Errorf("MAIL with A-label domain failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 553, "RCPT TO:<пётр@почта.рф>"); err != nil {
+		t.Errorf("RCPT without SMTPUTF8 failed: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
+
+func TestMailFromParameters(t *testing.T) {
+	addr, closer := RunTestServerWithoutTLS(t, &Server{
+		MaxMessageSize: 1024,
+		SenderCheckers: []SenderChecker{
+			func(_ context.Context, tr *Transaction) error {
+				if tr.MailFromParameters.Get("size") != "100" {
+					t.Errorf("wrong SIZE parameter %s", tr.MailFromParameters.Get("SIZE"))
+				}
+				if tr.MailFromParameters.Get("BODY") != "8BITMIME" {
+					t.Errorf("wrong BODY parameter %s", tr.MailFromParameters.Get("BODY"))
+				}
+				if tr.MailFromParameters.Get("AUTH") != "<>" {
+					t.Errorf("wrong AUTH parameter %s", tr.MailFromParameters.Get("AUTH"))
+				}
+				return nil
+			},
+		},
+		RecipientCheckers: []RecipientChecker{
+			func(_ context.Context, tr *Transaction, recipient *mail.Address) error {
+				params := tr.RcptToParameters[recipient.Address]
+				if params.Get("NOTIFY") != "SUCCESS,FAILURE" {
+					t.Errorf("wrong NOTIFY parameter %s", params.Get("NOTIFY"))
+				}
+				if params.Get("ORCPT") != "rfc822;recipient@example.net" {
+					t.Errorf("wrong ORCPT parameter %s", params.Get("ORCPT"))
+				}
+				return nil
+			},
+		},
+	})
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Errorf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 552, "MAIL FROM:<sender@example.org> SIZE=2048"); err != nil {
+		t.Errorf("MAIL with too big SIZE failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 501, "MAIL FROM:<sender@example.org> SIZE=many"); err != nil {
+		t.Errorf("MAIL with malformed SIZE failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 501, "MAIL FROM:<sender@example.org> BODY=9BITMIME"); err != nil {
+		t.Errorf("MAIL with unsupported BODY failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 501, "MAIL FROM:<sender@example.org> SIZE=1 SIZE=2"); err != nil {
+		t.Errorf("MAIL with duplicate parameter failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 555, "MAIL FROM:<sender@example.org> SOMETHING=else"); err != nil {
+		t.Errorf("MAIL with unsupported parameter failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 250, "MAIL FROM:<sender@example.org> size=100 BODY=8BITMIME AUTH=<>"); err != nil {
+		t.Errorf("MAIL with parameters failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 555, "RCPT TO:<recipient@example.net> SIZE=100"); err != nil {
+		t.Errorf("RCPT with unsupported parameter failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 250, "RCPT TO:<recipient@example.net> NOTIFY=SUCCESS,FAILURE ORCPT=rfc822;recipient@example.net"); err != nil {
+		t.Errorf("RCPT with parameters failed: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
+
+func TestParametersAfterHELO(t *testing.T) {
+	server := &Server{}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 250, "HELO localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 555, "MAIL FROM:<sender@example.org> SIZE=100"); err != nil {
+		t.Errorf("MAIL with parameters after HELO failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 250, "MAIL FROM:<sender@example.org>"); err != nil {
+		t.Errorf("MAIL without parameters after HELO failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 555, "RCPT TO:<recipient@example.net> NOTIFY=NEVER"); err != nil {
+		t.Errorf("RCPT with parameters after HELO failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 250, "RCPT TO:<recipient@example.net>"); err != nil {
+		t.Errorf("RCPT without parameters after HELO failed: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+}
@@ -20,11 +20,11 @@ func (t *Transaction) handlePROXY(cmd command) {
 	defer span.End()
 	t.LogTrace("Proxy command: %s", cmd.line)
 	if !t.server.EnableProxyProtocol {
-		t.reply(550, "Proxy Protocol not enabled")
+		t.reply(550, "5.7.0", "Proxy Protocol not enabled")
 		return
 	}
 	if len(cmd.fields) < 6 {
-		t.reply(502, "malformed proxy command")
+		t.reply(502, "5.5.4", "malformed proxy command")
 		return
 	}
 	var (
@@ -38,24 +38,24 @@ func (t *Transaction) handlePROXY(cmd command) {
 	case "TCP6":
 		break
 	default:
-		t.reply(502, "unable to decode proxy protocol - only TCP4/TCP6 is supported")
+		t.reply(502, "5.5.4", "unable to decode proxy protocol - only TCP4/TCP6 is supported")
 		return
 	}
 
 	newAddr = net.ParseIP(cmd.fields[2])
 	if newAddr == nil {
-		t.reply(502, "malformed network address")
+		t.reply(502, "5.5.4", "malformed network address")
 		return
 	}
 	newTCPPort, err = strconv.ParseUint(cmd.fields[4], 10, 16)
 	if err != nil {
-		t.reply(502, "malformed port in proxy command")
+		t.reply(502, "5.5.4", "malformed port in proxy command")
 		return
 	}
 	tcpAddr, ok := t.Addr.(*net.TCPAddr)
 	if !ok {
-		t.reply(502, "unsupported network connection")
-		return
+		// client connected via unix domain socket gets address from command
+		tcpAddr = &net.TCPAddr{}
 	}
 	if newAddr != nil {
 		tcpAddr.IP = newAddr
@@ -1,6 +1,8 @@
 package msmtpd
 
 import (
+	"context"
+	"fmt"
 	"strings"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -15,67 +17,95 @@ func (t *Transaction) handleRCPT(cmd command) {
 	defer span.End()
 	if len(cmd.params) != 2 || strings.ToUpper(cmd.params[0]) != "TO" {
 		t.Hate(missingParameterPenalty)
-		t.reply(502, "Invalid syntax.")
+		t.reply(502, "5.5.4", "Invalid syntax.")
 		return
 	}
-	if t.dataHandlersCalledProperly {
-		t.LogWarn("RCPT TO called after DATA accepted")
-		span.AddEvent("RCPT TO called after DATA accepted")
-		t.Hate(wrongCommandOrderPenalty)
-		t.reply(502, "wrong order of commands")
+	if !t.transition(span, "RCPT TO", StateRcpt) {
 		return
 	}
-	if t.HeloName == "" {
-		t.LogDebug("RCPT TO called without HELO/EHLO")
-		span.AddEvent("RCPT TO called without HELO/EHLO")
-		t.Hate(missingParameterPenalty)
-		t.reply(502, "Please introduce yourself first.")
+	if len(t.RcptTo) >= t.listener.MaxRecipients {
+		t.LogDebug("Too many recipients")
+		span.AddEvent("Too many recipients")
+		t.Hate(tooManyRecipientsPenalty)
+		t.reply(452, "4.5.3", "Too many recipients")
 		return
 	}
-	if !t.Encrypted && t.server.ForceTLS {
-		t.LogDebug("RCPT TO called without STARTTLS")
-		span.AddEvent("RCPT TO called without STARTTLS")
+	if !t.extended && len(cmd.fields) > 2 {
+		// RFC 5321, section 4.1.1.11 - parameters are allowed only for sessions started with EHLO or LHLO
+		t.LogDebug("RCPT TO has parameters after HELO")
+		span.AddEvent("RCPT TO has parameters after HELO")
 		t.Hate(missingParameterPenalty)
-		t.reply(502, "Please turn on TLS by issuing a STARTTLS command.")
+		t.reply(555, "5.5.4", "Parameters are not supported after HELO, use EHLO, please.")
 		return
 	}
-	if t.server.Authenticator != nil && t.Username == "" {
-		t.LogDebug("RCPT TO called without authentication")
-		span.AddEvent("RCPT TO called without authentication")
+	params, err := parseParameters(cmd.fields[2:])
+	if err != nil {
+		t.LogDebug("RCPT TO has malformed parameters: %s", err)
+		span.AddEvent("RCPT TO has malformed parameters")
 		t.Hate(missingParameterPenalty)
-		t.reply(530, "Authentication Required.")
+		t.reply(501, "5.5.4", "Malformed parameters.")
 		return
 	}
-	if t.MailFrom.Address == "" && !t.IsFlagSet(NullSenderFlag) {
-		t.LogDebug("RCPT TO called without MAIL FROM")
-		span.AddEvent("RCPT TO called without MAIL FROM")
+	for keyword := range params {
+		if !rcptToParameters[keyword] {
+			t.LogDebug("RCPT TO has unsupported parameter %s", keyword)
+			span.AddEvent("RCPT TO has unsupported parameter")
+			t.Hate(missingParameterPenalty)
+			t.reply(555, "5.5.4", fmt.Sprintf("Parameter %s is not supported.", keyword))
+			return
+		}
+	}
+	err = validateRcptToDSN(params)
+	if err != nil {
+		t.LogDebug("RCPT TO has malformed DSN parameters: %s", err)
+		span.AddEvent("RCPT TO has malformed DSN parameters")
 		t.Hate(missingParameterPenalty)
-		t.reply(502, "It seems you haven't called MAIL FROM in order to explain who sends your message.")
+		t.reply(501, "5.5.4", "Malformed NOTIFY or ORCPT parameter.")
 		return
 	}
-	if len(t.RcptTo) >= t.server.MaxRecipients {
-		t.LogDebug("Too many recipients")
-		span.AddEvent("Too many recipients")
-		t.Hate(tooManyRecipientsPenalty)
-		t.reply(452, "Too many recipients")
+	if !t.SMTPUTF8 && !isASCII(cmd.params[1]) {
+		t.LogDebug("RCPT TO has internationalized address %s without SMTPUTF8", cmd.params[1])
+		span.AddEvent("RCPT TO has internationalized address without SMTPUTF8")
+		t.Hate(missingParameterPenalty)
+		t.reply(553, "5.6.7", "Please, provide SMTPUTF8 parameter to MAIL FROM for internationalized email address.")
 		return
 	}
 	addr, err := parseAddress(cmd.params[1])
 	if err != nil {
 		t.Hate(missingParameterPenalty)
-		t.reply(502, "Malformed e-mail address")
+		t.reply(502, "5.1.3", "Malformed e-mail address")
 		return
 	}
+	if t.RcptToParameters == nil {
+		t.RcptToParameters = make(map[string]Parameters, 0)
+	}
+	previousParams, alreadyAccepted := t.RcptToParameters[addr.Address]
+	t.RcptToParameters[addr.Address] = params
+	if len(params) > 0 {
+		span.SetAttributes(attribute.String("to_parameters", params.String()))
+	}
 	t.LogDebug("Checking recipient %s by %v RecipientCheckers...",
-		addr.String(), len(t.server.RecipientCheckers))
-	for k := range t.server.RecipientCheckers {
-		err = t.server.RecipientCheckers[k](ctxWithTracer, t, addr)
-		if err != nil {
-			t.Hate(unknownRecipientPenalty)
-			t.error(err)
-			return
+		addr.String(), len(t.listener.RecipientCheckers))
+	err = t.runPhase(ctxWithTracer, PhaseRecipient, len(t.listener.RecipientCheckers),
+		func(pluginCtx context.Context, k int) error {
+			return t.listener.RecipientCheckers[k](pluginCtx, t, addr)
+		})
+	if err == nil && !t.isAlwaysAccepted(addr.Address) {
+		err = t.delayedRejectionError(span, addr.Address)
+		if err == nil {
+			err = t.verdictError(span)
 		}
 	}
+	if err != nil {
+		if alreadyAccepted {
+			t.RcptToParameters[addr.Address] = previousParams
+		} else {
+			delete(t.RcptToParameters, addr.Address)
+		}
+		t.Hate(unknownRecipientPenalty)
+		t.error(err)
+		return
+	}
 	t.RcptTo = append(t.RcptTo, *addr)
 	switch len(t.RcptTo) {
 	case 1:
@@ -99,7 +129,8 @@ func (t *Transaction) handleRCPT(cmd command) {
 	}
 	t.Span.SetAttributes(attribute.StringSlice("aliases", aliasesAsStrings))
 	span.SetAttributes(attribute.StringSlice("aliases", aliasesAsStrings))
-	t.reply(250, "It seems i can handle delivery for this recipient, i'll do my best!")
+	t.setState(ctxWithTracer, StateRcpt)
+	t.reply(250, "2.1.5", "It seems i can handle delivery for this recipient, i'll do my best!")
 	if len(t.RcptTo) == 1 { // too many recipients should not give too many love for transaction
 		t.Love(commandExecutedProperly)
 	}
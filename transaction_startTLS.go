@@ -11,7 +11,7 @@ import (
 )
 
 func (t *Transaction) handleSTARTTLS(cmd command) {
-	_, span := t.server.Tracer.Start(t.Context(), "handle_start_tls",
+	ctx, span := t.server.Tracer.Start(t.Context(), "handle_start_tls",
 		trace.WithSpanKind(trace.SpanKindInternal), // важно
 	)
 	defer span.End()
@@ -20,22 +20,35 @@ func (t *Transaction) handleSTARTTLS(cmd command) {
 	if t.Encrypted {
 		t.LogDebug("Connection is already encrypted!")
 		span.AddEvent("Connection is already encrypted!")
-		t.reply(502, "Already running in TLS")
+		t.reply(502, "5.5.1", "Already running in TLS")
 		return
 	}
-	if t.server.TLSConfig == nil {
-		t.reply(502, "TLS not supported")
+	if t.tlsConfig() == nil {
+		t.reply(502, "5.5.1", "TLS not supported")
 		return
 	}
 	t.LogDebug("STARTTLS [%s] is received...", cmd.line)
-	tlsConn := tls.Server(t.conn, t.server.TLSConfig)
-	t.reply(220, "Connection is encrypted, we can talk freely now!")
+	// Everything client sends after STARTTLS in plain text, but before TLS handshake, can be
+	// injected by man-in-the-middle, and it would be processed as being received via encrypted connection,
+	// see CVE-2011-0411. So we reject pipelining past STARTTLS and close the connection
+	if t.reader.Buffered() > 0 {
+		t.LogWarn("%v bytes are pipelined after STARTTLS, closing connection", t.reader.Buffered())
+		span.AddEvent("data pipelined after STARTTLS")
+		t.Hate(unauthorizedPipeliningPenalty)
+		t.reply(554, "5.5.1", "Commands pipelined after STARTTLS are not allowed.")
+		t.reader.Discard(t.reader.Buffered())
+		t.close()
+		return
+	}
+	tlsConn := tls.Server(t.conn, t.tlsConfig())
+	t.reply(220, "2.0.0", "Connection is encrypted, we can talk freely now!")
+	t.flush()
 	err = tlsConn.Handshake()
 	if err != nil {
 		t.LogError(err, "couldn't perform handshake")
 		span.SetStatus(codes.Error, err.Error())
 		span.RecordError(err)
-		t.reply(550, "TLS Handshake error")
+		t.reply(550, "5.7.0", "TLS Handshake error")
 		return
 	}
 	t.LogInfo("Connection is encrypted via StartTLS!")
@@ -49,7 +62,7 @@ func (t *Transaction) handleSTARTTLS(cmd command) {
 		span.SetStatus(codes.Error, err.Error())
 		span.RecordError(err)
 		t.LogError(err, "error setting deadline for encrypted connection")
-		t.reply(550, "TLS Handshake error")
+		t.reply(550, "5.7.0", "TLS Handshake error")
 		return
 	}
 
@@ -57,12 +70,13 @@ func (t *Transaction) handleSTARTTLS(cmd command) {
 	t.conn = tlsConn
 	t.reader = bufio.NewReader(tlsConn)
 	t.writer = bufio.NewWriter(tlsConn)
-	t.scanner = bufio.NewScanner(t.reader)
 	t.Encrypted = true
 	// Save connection state on peer
 	state := tlsConn.ConnectionState()
 	t.TLS = &state
 	span.AddEvent("connection is encrypted")
+	t.authenticateByCertificate(ctx)
+	t.setState(ctx, StateSecured)
 	// Flush the connection to set new timeout deadlines
 	t.flush()
 	t.Love(commandExecutedProperly)
@@ -1,6 +1,7 @@
 package msmtpd
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net/smtp"
@@ -75,3 +76,35 @@ func TestSTARTTLS(t *testing.T) {
 		t.Errorf("Quit failed: %v", err)
 	}
 }
+
+func TestSTARTTLSPipeliningRejected(t *testing.T) {
+	addr, closer := RunTestServerWithTLS(t, &Server{
+		SenderCheckers: []SenderChecker{
+			func(_ context.Context, tr *Transaction) error {
+				t.Errorf("MAIL FROM pipelined after STARTTLS is accepted")
+				return nil
+			},
+		},
+	})
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Errorf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	_, err = fmt.Fprint(c.Text.W, "STARTTLS\r\nMAIL FROM:<injected@example.org>\r\n")
+	if err != nil {
+		t.Errorf("%s : while sending pipelined STARTTLS", err)
+	}
+	if err = c.Text.W.Flush(); err != nil {
+		t.Errorf("%s : while sending pipelined STARTTLS", err)
+	}
+	if _, _, err = c.Text.ReadResponse(554); err != nil {
+		t.Errorf("%s : wrong response for data pipelined after STARTTLS", err)
+	}
+	if _, _, err = c.Text.ReadResponse(250); err == nil {
+		t.Errorf("connection is not closed after data pipelined after STARTTLS")
+	}
+}
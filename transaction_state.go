@@ -0,0 +1,237 @@
+package msmtpd
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Good read - https://www.rfc-editor.org/rfc/rfc5321#section-4.1.4
+// Order of commands is enforced by state machine. Every command moving session to the next State
+// asks Transaction.transition, if it is allowed in current State, and, if command succeeds,
+// session is moved to new State via Transaction.setState, which calls Server.StateHooks.
+
+// State is phase of SMTP session, states are ordered as client is expected to pass them
+type State int
+
+const (
+	// StateConnected means client is connected, but has not greeted server yet
+	StateConnected State = iota
+	// StateSecured means connection is encrypted by TLS, but client has not greeted server
+	// via encrypted connection yet
+	StateSecured
+	// StateGreeted means client greeted server via HELO, EHLO or LHLO command
+	StateGreeted
+	// StateAuthenticated means client greeted server and is authenticated
+	StateAuthenticated
+	// StateMail means sender of message is accepted via MAIL FROM command
+	StateMail
+	// StateRcpt means at least one recipient of message is accepted via RCPT TO command
+	StateRcpt
+	// StateData means client is sending message body via DATA or BDAT commands
+	StateData
+)
+
+var stateNames = map[State]string{
+	StateConnected:     "connected",
+	StateSecured:       "secured",
+	StateGreeted:       "greeted",
+	StateAuthenticated: "authenticated",
+	StateMail:          "mail",
+	StateRcpt:          "rcpt",
+	StateData:          "data",
+}
+
+// String returns name of state
+func (s State) String() string {
+	name, found := stateNames[s]
+	if !found {
+		return fmt.Sprintf("state(%d)", int(s))
+	}
+	return name
+}
+
+// StateHook is called after Transaction moved from one State to another one. It can be used
+// by plugins to track progress of session, errors returned are only logged
+type StateHook func(ctx context.Context, transaction *Transaction, from, to State) error
+
+var (
+	errIntroduceYourself = ErrorSMTP{
+		Code:         502,
+		EnhancedCode: "5.5.1",
+		Message:      "Please introduce yourself first.",
+	}
+	errTLSRequired = ErrorSMTP{
+		Code:         502,
+		EnhancedCode: "5.7.0",
+		Message:      "Please turn on TLS by issuing a STARTTLS command.",
+	}
+	errAuthenticationRequired = ErrorSMTP{
+		Code:         530,
+		EnhancedCode: "5.7.0",
+		Message:      "Authentication Required.",
+	}
+	errAuthenticationInPlainText = ErrorSMTP{
+		Code:         502,
+		EnhancedCode: "5.7.11",
+		Message:      "Cannot AUTH in plain text mode. Use STARTTLS.",
+	}
+	errAlreadyAuthenticated = ErrorSMTP{
+		Code:         503,
+		EnhancedCode: "5.5.1",
+		Message:      "You are already authenticated.",
+	}
+	errMailTransactionInProgress = ErrorSMTP{
+		Code:         503,
+		EnhancedCode: "5.5.1",
+		Message:      "This command is not allowed during mail transaction, please, finish it or issue RSET.",
+	}
+	errDuplicateMail = ErrorSMTP{
+		Code:         502,
+		EnhancedCode: "5.5.1",
+		Message:      "Duplicate MAIL",
+	}
+	errMailFromMissing = ErrorSMTP{
+		Code:         502,
+		EnhancedCode: "5.5.1",
+		Message:      "It seems you haven't called MAIL FROM in order to explain who sends your message.",
+	}
+	errRcptToMissing = ErrorSMTP{
+		Code:         502,
+		EnhancedCode: "5.5.1",
+		Message:      "It seems you haven't called RCPT TO in order to explain for whom do you want to deliver your message.",
+	}
+	errBDATInProgress = ErrorSMTP{
+		Code:         503,
+		EnhancedCode: "5.5.1",
+		Message:      "You have already started sending message via BDAT, please, continue using it.",
+	}
+)
+
+// State returns current phase of SMTP session
+func (t *Transaction) State() State {
+	return t.state
+}
+
+// transitionError returns error explaining, why action moving session to state provided
+// is not allowed in current state, or nil, if it is allowed
+func (t *Transaction) transitionError(action string, to State) error {
+	switch to {
+	case StateConnected, StateSecured:
+		// STARTTLS can be issued at any time, it resets session
+		return nil
+	case StateGreeted:
+		if action == "XCLIENT" && t.state >= StateMail {
+			return errMailTransactionInProgress
+		}
+		return nil
+	case StateAuthenticated:
+		switch {
+		case t.state < StateGreeted:
+			return errIntroduceYourself
+		case !t.Encrypted:
+			return errAuthenticationInPlainText
+		case t.state == StateAuthenticated:
+			return errAlreadyAuthenticated
+		case t.state > StateAuthenticated:
+			return errMailTransactionInProgress
+		}
+		return nil
+	}
+	// mail transaction requires greeting, encryption and authentication, if listener enforces them
+	switch {
+	case t.state < StateGreeted:
+		return errIntroduceYourself
+	case !t.Encrypted && t.listener.forceTLS():
+		return errTLSRequired
+	case t.listener.authenticationRequired() && t.Username == "":
+		return errAuthenticationRequired
+	}
+	switch to {
+	case StateMail:
+		if t.state >= StateMail {
+			return errDuplicateMail
+		}
+	case StateRcpt:
+		if t.state < StateMail {
+			return errMailFromMissing
+		}
+		if t.state == StateData {
+			return errBDATInProgress
+		}
+	case StateData:
+		if t.state < StateMail {
+			return errMailFromMissing
+		}
+		if t.state == StateMail {
+			return errRcptToMissing
+		}
+		if t.state == StateData && action != "BDAT" {
+			return errBDATInProgress
+		}
+	}
+	return nil
+}
+
+// transition ensures action moving session to state provided is allowed in current state,
+// and complains to client, if it is not
+func (t *Transaction) transition(span trace.Span, action string, to State) bool {
+	err := t.transitionError(action, to)
+	if err == nil {
+		return true
+	}
+	t.LogDebug("%s is not allowed in state %s: %s", action, t.state, err)
+	span.AddEvent(action+" is not allowed", trace.WithAttributes(
+		attribute.String("state", t.state.String()),
+	))
+	t.Hate(wrongCommandOrderPenalty)
+	t.error(err)
+	return false
+}
+
+// setState moves session to state provided and calls Server.StateHooks
+func (t *Transaction) setState(ctx context.Context, to State) {
+	from := t.state
+	if from == to {
+		return
+	}
+	t.state = to
+	t.LogTrace("Session moved from state %s to %s", from, to)
+	t.Span.SetAttributes(attribute.String("state", to.String()))
+	ctx, cancel := t.phaseContext(ctx, PhaseState)
+	defer cancel()
+	for k := range t.listener.stateHooks {
+		err := t.callPlugin(ctx, PhaseState, k, func(pluginCtx context.Context) error {
+			return t.listener.stateHooks[k](pluginCtx, t, from, to)
+		})
+		if err != nil {
+			t.LogError(err, "while calling state hook "+t.listener.pluginName(PhaseState, k))
+		}
+	}
+}
+
+// greetedState returns state session is moved to after client greeted server
+func (t *Transaction) greetedState() State {
+	if t.Username != "" {
+		return StateAuthenticated
+	}
+	return StateGreeted
+}
+
+// ungreetedState returns state session returns to, when greeting is rejected
+func (t *Transaction) ungreetedState() State {
+	if t.Encrypted {
+		return StateSecured
+	}
+	return StateConnected
+}
+
+// idleState returns state session returns to, when mail transaction is finished or aborted
+func (t *Transaction) idleState() State {
+	if t.state < StateGreeted {
+		return t.state
+	}
+	return t.greetedState()
+}
@@ -0,0 +1,95 @@
+package msmtpd
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func TestStateString(t *testing.T) {
+	if StateRcpt.String() != "rcpt" {
+		t.Errorf("wrong name of state %s", StateRcpt)
+	}
+	if State(42).String() != "state(42)" {
+		t.Errorf("wrong name of unknown state %s", State(42))
+	}
+}
+
+func TestStateHooks(t *testing.T) {
+	var mu sync.Mutex
+	var transitions []string
+	server := &Server{
+		StateHooks: []StateHook{
+			func(_ context.Context, tr *Transaction, from, to State) error {
+				if tr.State() != to {
+					return fmt.Errorf("hook is called before transition")
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				transitions = append(transitions, from.String()+">"+to.String())
+				return nil
+			},
+		},
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 502, "RCPT TO:<recipient@example.net>"); err != nil {
+		t.Errorf("RCPT is accepted before HELO: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 502, "DATA"); err != nil {
+		t.Errorf("DATA is accepted before MAIL FROM: %v", err)
+	}
+	if err = c.Mail("sender@example.org"); err != nil {
+		t.Errorf("MAIL failed: %v", err)
+	}
+	if err = c.Rcpt("recipient@example.net"); err != nil {
+		t.Errorf("RCPT failed: %v", err)
+	}
+	id, err := c.Text.Cmd("BDAT 7\r\nHello")
+	if err != nil {
+		t.Fatalf("BDAT failed: %v", err)
+	}
+	c.Text.StartResponse(id)
+	_, _, err = c.Text.ReadResponse(250)
+	c.Text.EndResponse(id)
+	if err != nil {
+		t.Errorf("BDAT failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 503, "DATA"); err != nil {
+		t.Errorf("DATA is accepted after BDAT: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 503, "RCPT TO:<recipient2@example.net>"); err != nil {
+		t.Errorf("RCPT is accepted after BDAT: %v", err)
+	}
+	if err = c.Reset(); err != nil {
+		t.Errorf("RSET failed: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{
+		"connected>greeted",
+		"greeted>mail",
+		"mail>rcpt",
+		"rcpt>data",
+		"data>greeted",
+	}
+	if !slices.Equal(transitions, expected) {
+		t.Errorf("wrong transitions %v", transitions)
+	}
+}
@@ -0,0 +1,164 @@
+package msmtpd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Good read - https://www.rfc-editor.org/rfc/rfc5321#section-3.5
+// VRFY and EXPN commands can be used by spammers to harvest valid addresses,
+// so they are refused by default.
+
+// CommandPolicy defines how server answers VRFY, EXPN and HELP commands
+type CommandPolicy int
+
+const (
+	// CommandPolicyRefuse means command is refused with 502 reply
+	CommandPolicyRefuse CommandPolicy = iota
+	// CommandPolicyCannotVerify means VRFY and EXPN are answered with 252 reply, so client is told
+	// we cannot verify address, but will accept message and attempt delivery. HELP is answered with link to RFC 5321
+	CommandPolicyCannotVerify
+	// CommandPolicyAnswer means VRFY and EXPN check address by RecipientCheckers and reply with address,
+	// if checkers accept it. Only clients, who greeted server, and used STARTTLS and authenticated, if
+	// listener requires it, can verify addresses, others are answered like with CommandPolicyCannotVerify.
+	// RecipientCheckers should not have side effects to be used for VRFY, like ones only looking up
+	// mailboxes do, while ratelimit.Handler.RecipientChecker counts every VRFY as recipient,
+	// and karma is penalized for addresses rejected. HELP lists commands supported
+	CommandPolicyAnswer
+)
+
+func (t *Transaction) handleVRFY(cmd command) {
+	t.handleVerification(cmd, t.server.VRFYPolicy)
+}
+
+func (t *Transaction) handleEXPN(cmd command) {
+	t.handleVerification(cmd, t.server.EXPNPolicy)
+}
+
+// handleVerification answers VRFY and EXPN commands according to policy provided.
+// We do not have mailing lists, so EXPN is answered as VRFY for single mailbox
+func (t *Transaction) handleVerification(cmd command, policy CommandPolicy) {
+	ctxWithTracer, span := t.server.Tracer.Start(t.Context(), "handle_"+strings.ToLower(cmd.action),
+		trace.WithSpanKind(trace.SpanKindInternal), // важно
+	)
+	cmd.attachToSpan(span)
+	defer span.End()
+
+	if policy == CommandPolicyCannotVerify {
+		span.AddEvent(cmd.action + " answered vaguely")
+		t.reply(252, "2.5.0", "Cannot verify user, but will accept message and attempt delivery.")
+		return
+	}
+	if policy != CommandPolicyAnswer {
+		t.LogDebug("%s command is refused", cmd.action)
+		span.AddEvent(cmd.action + " refused")
+		t.reply(502, "5.5.1", fmt.Sprintf("%s command is disabled.", cmd.action))
+		return
+	}
+	if !t.verificationAllowed() {
+		t.LogDebug("%s is answered vaguely in state %s", cmd.action, t.state)
+		span.AddEvent(cmd.action + " answered vaguely")
+		t.reply(252, "2.5.0", "Cannot verify user, but will accept message and attempt delivery.")
+		return
+	}
+	if len(cmd.fields) < 2 {
+		t.reply(501, "5.5.4", "Invalid syntax.")
+		t.Hate(missingParameterPenalty)
+		return
+	}
+	addr, err := parseAddress(strings.Join(cmd.fields[1:], " "))
+	if err != nil {
+		t.LogDebug("%s : while parsing %s argument", err, cmd.action)
+		t.reply(501, "5.1.3", "Malformed address.")
+		t.Hate(missingParameterPenalty)
+		return
+	}
+	span.SetAttributes(attribute.String("address", addr.Address))
+	t.LogDebug("%s <%s> is received...", cmd.action, addr.Address)
+	err = t.runPhase(ctxWithTracer, PhaseRecipient, len(t.listener.RecipientCheckers),
+		func(pluginCtx context.Context, k int) error {
+			return t.listener.RecipientCheckers[k](pluginCtx, t, addr)
+		})
+	if err != nil {
+		t.error(err)
+		return
+	}
+	t.reply(250, "2.1.5", fmt.Sprintf("<%s>", addr.Address))
+}
+
+// verificationAllowed returns true, if client can verify addresses, so it greeted server,
+// and used STARTTLS and authenticated, if listener requires it, like for RCPT TO command
+func (t *Transaction) verificationAllowed() bool {
+	switch {
+	case t.state < StateGreeted:
+		return false
+	case !t.Encrypted && t.listener.forceTLS():
+		return false
+	case t.listener.authenticationRequired() && t.Username == "":
+		return false
+	}
+	return true
+}
+
+func (t *Transaction) handleHELP(cmd command) {
+	_, span := t.server.Tracer.Start(t.Context(), "handle_help",
+		trace.WithSpanKind(trace.SpanKindInternal), // важно
+	)
+	cmd.attachToSpan(span)
+	defer span.End()
+
+	switch t.server.HELPPolicy {
+	case CommandPolicyCannotVerify:
+		t.reply(214, "2.0.0", "See https://www.rfc-editor.org/rfc/rfc5321")
+	case CommandPolicyAnswer:
+		t.ReplyLines(214, "2.0.0",
+			"Commands supported:",
+			strings.Join(t.supportedCommands(), " "),
+		)
+	default:
+		t.LogDebug("HELP command is refused")
+		span.AddEvent("HELP refused")
+		t.reply(502, "5.5.1", "HELP command is disabled.")
+	}
+}
+
+// supportedCommands returns sorted list of commands server answers on listener client is connected to
+func (t *Transaction) supportedCommands() []string {
+	srv := t.server
+	commands := []string{"MAIL", "RCPT", "DATA", "BDAT", "RSET", "NOOP", "QUIT", "HELP"}
+	if srv.LMTP {
+		commands = append(commands, "LHLO")
+	} else {
+		commands = append(commands, "HELO", "EHLO")
+	}
+	if t.tlsConfig() != nil {
+		commands = append(commands, "STARTTLS")
+	}
+	if t.authenticationSupported() {
+		commands = append(commands, "AUTH")
+	}
+	if srv.EnableXCLIENT {
+		commands = append(commands, "XCLIENT")
+	}
+	if srv.EnableProxyProtocol {
+		commands = append(commands, "PROXY")
+	}
+	if _, custom := srv.commands["VRFY"]; custom || srv.VRFYPolicy != CommandPolicyRefuse {
+		commands = append(commands, "VRFY")
+	}
+	if _, custom := srv.commands["EXPN"]; custom || srv.EXPNPolicy != CommandPolicyRefuse {
+		commands = append(commands, "EXPN")
+	}
+	for verb := range srv.commands {
+		if !builtInCommands[verb] {
+			commands = append(commands, verb)
+		}
+	}
+	sort.Strings(commands)
+	return commands
+}
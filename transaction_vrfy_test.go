@@ -0,0 +1,141 @@
+package msmtpd
+
+import (
+	"context"
+	"net/mail"
+	"net/smtp"
+	"testing"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func TestVRFYRefusedByDefault(t *testing.T) {
+	addr, closer := RunTestServerWithoutTLS(t, &Server{})
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	for _, cmd := range []string{"VRFY somebody@example.org", "EXPN staff@example.org", "HELP"} {
+		if err = internal.DoCommand(c.Text, 502, "%s", cmd); err != nil {
+			t.Errorf("%s didn't fail: %v", cmd, err)
+		}
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
+
+func TestVRFYCannotVerify(t *testing.T) {
+	addr, closer := RunTestServerWithoutTLS(t, &Server{
+		VRFYPolicy: CommandPolicyCannotVerify,
+		EXPNPolicy: CommandPolicyCannotVerify,
+		HELPPolicy: CommandPolicyCannotVerify,
+	})
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 252, "VRFY somebody@example.org"); err != nil {
+		t.Errorf("VRFY failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 252, "EXPN staff@example.org"); err != nil {
+		t.Errorf("EXPN failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 214, "HELP"); err != nil {
+		t.Errorf("HELP failed: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
+
+func TestVRFYAnswer(t *testing.T) {
+	addr, closer := RunTestServerWithoutTLS(t, &Server{
+		VRFYPolicy: CommandPolicyAnswer,
+		HELPPolicy: CommandPolicyAnswer,
+		RecipientCheckers: []RecipientChecker{
+			func(_ context.Context, tr *Transaction, recipient *mail.Address) error {
+				if recipient.Address != "somebody@example.org" {
+					return ErrorSMTP{Code: 550, EnhancedCode: "5.1.1", Message: "no such user"}
+				}
+				return nil
+			},
+		},
+	})
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Verify("somebody@example.org"); err != nil {
+		t.Errorf("VRFY failed: %v", err)
+	}
+	if err = c.Verify("nobody@example.org"); err == nil {
+		t.Errorf("VRFY for unknown user didn't fail")
+	}
+	if err = internal.DoCommand(c.Text, 501, "VRFY"); err != nil {
+		t.Errorf("VRFY without argument didn't fail: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 502, "EXPN staff@example.org"); err != nil {
+		t.Errorf("EXPN didn't fail: %v", err)
+	}
+	id, err := c.Text.Cmd("HELP")
+	if err != nil {
+		t.Fatalf("%s : while sending HELP", err)
+	}
+	c.Text.StartResponse(id)
+	_, msg, err := c.Text.ReadResponse(214)
+	c.Text.EndResponse(id)
+	if err != nil {
+		t.Errorf("HELP failed: %v", err)
+	}
+	expected := "2.0.0 Commands supported:\n2.0.0 BDAT DATA EHLO HELO HELP MAIL NOOP QUIT RCPT RSET VRFY"
+	if msg != expected {
+		t.Errorf("wrong HELP response %q", msg)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+}
+
+func TestVRFYAnswerRequiresPolicy(t *testing.T) {
+	var checked int
+	server := &Server{
+		VRFYPolicy: CommandPolicyAnswer,
+		SASLMechanisms: []SASLMechanism{
+			PlainMechanism(func(_ context.Context, _ *Transaction, _, _ string) error {
+				return nil
+			}),
+		},
+		RecipientCheckers: []RecipientChecker{
+			func(_ context.Context, _ *Transaction, _ *mail.Address) error {
+				checked++
+				return nil
+			},
+		},
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 252, "VRFY somebody@example.org"); err != nil {
+		t.Errorf("VRFY is answered before HELO: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	if err = internal.DoCommand(c.Text, 252, "VRFY somebody@example.org"); err != nil {
+		t.Errorf("VRFY is answered before authentication: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+	if checked != 0 {
+		t.Errorf("RecipientCheckers are called %v times for VRFY", checked)
+	}
+}
@@ -10,19 +10,22 @@ import (
 )
 
 func (t *Transaction) handleXCLIENT(cmd command) {
-	_, span := t.server.Tracer.Start(t.Context(), "handle_xclient",
+	ctx, span := t.server.Tracer.Start(t.Context(), "handle_xclient",
 		trace.WithSpanKind(trace.SpanKindInternal), // важно
 	)
 	cmd.attachToSpan(span)
 	defer span.End()
 	if len(cmd.fields) < 2 {
 		span.AddEvent("Invalid syntax.")
-		t.reply(502, "Invalid syntax.")
+		t.reply(502, "5.5.4", "Invalid syntax.")
 		return
 	}
 	if !t.server.EnableXCLIENT {
 		span.AddEvent("XCLIENT not enabled")
-		t.reply(550, "XCLIENT not enabled")
+		t.reply(550, "5.7.0", "XCLIENT not enabled")
+		return
+	}
+	if !t.transition(span, "XCLIENT", StateGreeted) {
 		return
 	}
 	var (
@@ -35,7 +38,7 @@ func (t *Transaction) handleXCLIENT(cmd command) {
 	for _, item := range cmd.fields[1:] {
 		parts := strings.Split(item, "=")
 		if len(parts) != 2 {
-			t.reply(502, "Couldn't decode the command.")
+			t.reply(502, "5.5.4", "Couldn't decode the command.")
 			return
 		}
 		name := parts[0]
@@ -54,7 +57,7 @@ func (t *Transaction) handleXCLIENT(cmd command) {
 			var err error
 			newTCPPort, err = strconv.ParseUint(value, 10, 16)
 			if err != nil {
-				t.reply(502, "Couldn't decode the command.")
+				t.reply(502, "5.5.4", "Couldn't decode the command.")
 				return
 			}
 			continue
@@ -69,14 +72,14 @@ func (t *Transaction) handleXCLIENT(cmd command) {
 			}
 			continue
 		default:
-			t.reply(502, "Couldn't decode the command.")
+			t.reply(502, "5.5.4", "Couldn't decode the command.")
 			return
 		}
 	}
 	tcpAddr, ok := t.Addr.(*net.TCPAddr)
 	if !ok {
-		t.reply(502, "Unsupported network connection")
-		return
+		// client connected via unix domain socket gets address from command
+		tcpAddr = &net.TCPAddr{}
 	}
 	if newHeloName != "" {
 		t.HeloName = newHeloName
@@ -96,5 +99,9 @@ func (t *Transaction) handleXCLIENT(cmd command) {
 	if newAddr != nil && newTCPPort != 0 {
 		t.Addr = tcpAddr
 	}
+	// client overridden by XCLIENT is considered to be greeted, if greeting is provided
+	if newHeloName != "" || t.state >= StateGreeted {
+		t.setState(ctx, t.greetedState())
+	}
 	t.welcome()
 }
@@ -0,0 +1,213 @@
+package msmtpd
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Like Haraka or rspamd do, checkers can contribute weighted scores with reasons via Transaction.AddScore
+// instead of rejecting client right away. Scores are summed into Verdict, and server takes action
+// according to Server.VerdictThresholds after SenderCheckers, RecipientCheckers and DataCheckers
+// are called. Positive scores mean client looks like spammer, negative ones mean client is trusted.
+// Scores added since MAIL FROM are forgotten, when envelope is reset, while ones added by
+// ConnectionCheckers and HeloCheckers are kept for whole session.
+
+// VerdictHeader is header added to message with Verdict action, score and reasons,
+// if any scores were added
+const VerdictHeader = "MSMTPD-Verdict"
+
+// VerdictAction is action server takes according to score of transaction
+type VerdictAction int
+
+const (
+	// VerdictAccept means message is accepted and delivered as usual
+	VerdictAccept VerdictAction = iota
+	// VerdictQuarantine means message is accepted, but DataHandlers should deliver it to quarantine.
+	// QuarantineFlag is set for such message, so DataHandlers can check it via Transaction.IsFlagSet
+	VerdictQuarantine
+	// VerdictTempFail means command is answered with ErrVerdictTempFail
+	VerdictTempFail
+	// VerdictReject means command is answered with ErrVerdictReject
+	VerdictReject
+	// VerdictDiscard means message is accepted, but it is silently dropped without calling DataHandlers
+	VerdictDiscard
+)
+
+// verdictActionNames are names of verdict actions used in logs, traces and VerdictHeader
+var verdictActionNames = map[VerdictAction]string{
+	VerdictAccept:     "accept",
+	VerdictQuarantine: "quarantine",
+	VerdictTempFail:   "tempfail",
+	VerdictReject:     "reject",
+	VerdictDiscard:    "discard",
+}
+
+// String returns name of action
+func (a VerdictAction) String() string {
+	name, found := verdictActionNames[a]
+	if found {
+		return name
+	}
+	return fmt.Sprintf("action(%d)", int(a))
+}
+
+// ErrVerdictTempFail is reported to client, when score of transaction reaches VerdictThresholds.TempFail
+var ErrVerdictTempFail = ErrorSMTP{
+	Code:         451,
+	EnhancedCode: "4.7.1",
+	Message:      "Your message looks suspicious. Try again later, please.",
+}
+
+// ErrVerdictReject is reported to client, when score of transaction reaches VerdictThresholds.Reject
+var ErrVerdictReject = ErrorSMTP{
+	Code:         550,
+	EnhancedCode: "5.7.1",
+	Message:      "Your message looks like spam. It is rejected.",
+}
+
+// VerdictThresholds are scores transaction has to reach for action to be taken. If score reaches
+// few thresholds, action of the highest one is taken. Zero threshold disables action
+type VerdictThresholds struct {
+	// Quarantine is score message is accepted to be delivered to quarantine at
+	Quarantine float64
+	// TempFail is score client is asked to try again later at
+	TempFail float64
+	// Reject is score client is rejected at
+	Reject float64
+	// Discard is score message is accepted and silently dropped at
+	Discard float64
+}
+
+// action returns VerdictAction for score provided
+func (vt VerdictThresholds) action(score float64) VerdictAction {
+	thresholds := []struct {
+		action    VerdictAction
+		threshold float64
+	}{
+		{VerdictQuarantine, vt.Quarantine},
+		{VerdictTempFail, vt.TempFail},
+		{VerdictReject, vt.Reject},
+		{VerdictDiscard, vt.Discard},
+	}
+	action := VerdictAccept
+	reached := 0.0
+	for _, candidate := range thresholds {
+		if candidate.threshold == 0 || score < candidate.threshold {
+			continue
+		}
+		if action == VerdictAccept || candidate.threshold > reached {
+			action = candidate.action
+			reached = candidate.threshold
+		}
+	}
+	return action
+}
+
+// Score is contribution of plugin into Verdict
+type Score struct {
+	// Phase is phase of plugin, which added score
+	Phase Phase
+	// Plugin is name of plugin, which added score
+	Plugin string
+	// Points are added to score of transaction
+	Points float64
+	// Reason explains, why score is added
+	Reason string
+}
+
+// String returns score in format used by VerdictHeader
+func (s Score) String() string {
+	return fmt.Sprintf("%s=%s (%s)", s.Plugin, strconv.FormatFloat(s.Points, 'f', -1, 64), s.Reason)
+}
+
+// Verdict is decision server makes about transaction according to scores added
+type Verdict struct {
+	// Action is action server takes
+	Action VerdictAction
+	// Score is sum of points of all Scores
+	Score float64
+	// Scores are contributions of plugins in order they were added
+	Scores []Score
+}
+
+// String returns verdict in format used by VerdictHeader
+func (v Verdict) String() string {
+	reasons := make([]string, 0, len(v.Scores)+2)
+	reasons = append(reasons, v.Action.String(), "score="+strconv.FormatFloat(v.Score, 'f', -1, 64))
+	for i := range v.Scores {
+		reasons = append(reasons, v.Scores[i].String())
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// pluginCallKey is key of context value, which stores plugin being called
+type pluginCallKey struct{}
+
+// pluginCall identifies plugin being called
+type pluginCall struct {
+	phase Phase
+	name  string
+}
+
+// AddScore adds weighted score with reason to Verdict of transaction on behalf of plugin called with
+// context provided. Reason is recorded as event of plugin span
+func (t *Transaction) AddScore(ctx context.Context, points float64, reason string) {
+	call, _ := ctx.Value(pluginCallKey{}).(pluginCall)
+	score := Score{Phase: call.phase, Plugin: call.name, Points: points, Reason: reason}
+	if score.Plugin == "" {
+		score.Plugin = "unknown"
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.scores = append(t.scores, score)
+	t.LogDebug("Plugin %s adds score %v: %s", score.Plugin, points, reason)
+	trace.SpanFromContext(ctx).AddEvent("score", trace.WithAttributes(
+		attribute.String("plugin", score.Plugin),
+		attribute.Float64("points", points),
+		attribute.String("reason", reason),
+	))
+}
+
+// Verdict returns current verdict of transaction according to scores added and Server.VerdictThresholds
+func (t *Transaction) Verdict() Verdict {
+	verdict := Verdict{Scores: slices.Clone(t.scores)}
+	for i := range verdict.Scores {
+		verdict.Score += verdict.Scores[i].Points
+	}
+	verdict.Action = t.server.VerdictThresholds.action(verdict.Score)
+	return verdict
+}
+
+// verdictError returns error client is answered with, if verdict of transaction is to tempfail or reject
+// it. Verdict is recorded into transaction span and span of command provided
+func (t *Transaction) verdictError(span trace.Span) error {
+	if len(t.scores) == 0 {
+		return nil
+	}
+	verdict := t.Verdict()
+	attributes := []attribute.KeyValue{
+		attribute.String("verdict.action", verdict.Action.String()),
+		attribute.Float64("verdict.score", verdict.Score),
+	}
+	t.Span.SetAttributes(attributes...)
+	span.AddEvent("verdict", trace.WithAttributes(
+		append(attributes, attribute.String("verdict.reasons", verdict.String()))...,
+	))
+	switch verdict.Action {
+	case VerdictTempFail:
+		t.LogInfo("Verdict is to try again later: %s", verdict)
+		return ErrVerdictTempFail
+	case VerdictReject:
+		t.LogInfo("Verdict is to reject: %s", verdict)
+		return ErrVerdictReject
+	default:
+		t.LogDebug("Verdict is %s", verdict)
+		return nil
+	}
+}
@@ -0,0 +1,119 @@
+package msmtpd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/vodolaz095/msmtpd/internal"
+)
+
+func TestVerdictThresholds(t *testing.T) {
+	thresholds := VerdictThresholds{Quarantine: 4, TempFail: 6, Reject: 10}
+	testCases := map[float64]VerdictAction{
+		-5: VerdictAccept,
+		0:  VerdictAccept,
+		4:  VerdictQuarantine,
+		7:  VerdictTempFail,
+		10: VerdictReject,
+		50: VerdictReject,
+	}
+	for score, expected := range testCases {
+		if action := thresholds.action(score); action != expected {
+			t.Errorf("wrong action %s for score %v instead of %s", action, score, expected)
+		}
+	}
+	if action := (VerdictThresholds{}).action(100); action != VerdictAccept {
+		t.Errorf("wrong action %s when thresholds are disabled", action)
+	}
+}
+
+func TestVerdict(t *testing.T) {
+	delivered := make(chan string, 1)
+	server := &Server{
+		VerdictThresholds: VerdictThresholds{Quarantine: 4, TempFail: 6, Reject: 10, Discard: 20},
+		Plugins: []Plugin{
+			{
+				Name: "rbl",
+				ConnectionChecker: func(ctx context.Context, tr *Transaction) error {
+					tr.AddScore(ctx, 3, "listed")
+					return nil
+				},
+			},
+			{
+				Name: "sender",
+				SenderChecker: func(ctx context.Context, tr *Transaction) error {
+					scores := map[string]float64{"quarantine": 2, "tempfail": 4, "reject": 8, "discard": 20}
+					tr.AddScore(ctx, scores[strings.Split(tr.MailFrom.Address, "@")[0]], "suspicious sender")
+					return nil
+				},
+			},
+		},
+		DataHandlers: []DataHandler{
+			func(_ context.Context, tr *Transaction) error {
+				body, err := io.ReadAll(tr.BodyReader())
+				if err != nil {
+					return err
+				}
+				delivered <- fmt.Sprintf("%s %v %s", tr.Verdict().Action, tr.IsFlagSet(QuarantineFlag),
+					strings.SplitN(string(body), "\r\n", 2)[0])
+				return nil
+			},
+		},
+	}
+	addr, closer := RunTestServerWithoutTLS(t, server)
+	defer closer()
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	if err = c.Hello("localhost"); err != nil {
+		t.Errorf("HELO failed: %v", err)
+	}
+	send := func(sender string) error {
+		if err = c.Mail(sender); err != nil {
+			return err
+		}
+		if err = c.Rcpt("recipient@example.net"); err != nil {
+			return err
+		}
+		wc, dataErr := c.Data()
+		if dataErr != nil {
+			return dataErr
+		}
+		if _, err = fmt.Fprint(wc, internal.MakeTestMessage(sender, "recipient@example.net")); err != nil {
+			return err
+		}
+		return wc.Close()
+	}
+	if err = send("quarantine@example.org"); err != nil {
+		t.Errorf("message to be quarantined is not accepted: %v", err)
+	}
+	expected := "quarantine true " + VerdictHeader +
+		": quarantine; score=5; rbl=3 (listed); sender=2 (suspicious sender)"
+	if result := <-delivered; result != expected {
+		t.Errorf("wrong verdict of delivered message %s", result)
+	}
+	if err = send("tempfail@example.org"); err == nil || err.Error() != ErrVerdictTempFail.Error() {
+		t.Errorf("wrong error for score reaching tempfail threshold: %v", err)
+	}
+	if err = send("reject@example.org"); err == nil || err.Error() != ErrVerdictReject.Error() {
+		t.Errorf("wrong error for score reaching reject threshold: %v", err)
+	}
+	if err = send("discard@example.org"); err != nil {
+		t.Errorf("message to be discarded is not accepted: %v", err)
+	}
+	if err = c.Quit(); err != nil {
+		t.Errorf("Quit failed: %v", err)
+	}
+	waitForTransactionsClosed(server)
+	if len(delivered) != 0 {
+		t.Errorf("discarded message is delivered: %s", <-delivered)
+	}
+	if accepted, rejected := server.GetMessagesCount(); accepted != 1 || rejected != 1 {
+		t.Errorf("wrong number of messages %v delivered and %v rejected", accepted, rejected)
+	}
+}